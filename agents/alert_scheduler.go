@@ -0,0 +1,263 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"celeste/catalog"
+	"celeste/models"
+)
+
+const (
+	defaultAlertInterval = time.Minute
+	webhookTimeout       = 5 * time.Second
+)
+
+// alertInterval reads CELESTE_ALERT_INTERVAL (a Go duration). Alerts are
+// also checked whenever the catalogue changes.
+func alertInterval() time.Duration {
+	value := os.Getenv("CELESTE_ALERT_INTERVAL")
+	if value == "" {
+		return defaultAlertInterval
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Invalid CELESTE_ALERT_INTERVAL %q, using %s", value, defaultAlertInterval)
+		return defaultAlertInterval
+	}
+	return interval
+}
+
+// CreatePriceAlert subscribes a user to a product's price dropping to the
+// threshold. A threshold in another currency is converted to the product's.
+func (ao *AgentOrchestrator) CreatePriceAlert(userID, productID string, threshold models.Money, webhookURL string) (models.PriceAlert, error) {
+	product, ok := ao.Catalog().Product(productID)
+	if !ok {
+		return models.PriceAlert{}, catalog.ErrNotFound
+	}
+	if threshold.IsNegative() || threshold.IsZero() {
+		return models.PriceAlert{}, fmt.Errorf("%w: threshold must be positive", ErrInvalidAlert)
+	}
+	if threshold.CurrencyCode != product.PriceUsd.CurrencyCode {
+		if ao.converter == nil {
+			return models.PriceAlert{}, fmt.Errorf("%w: cannot convert %s to %s", ErrInvalidAlert, threshold.CurrencyCode, product.PriceUsd.CurrencyCode)
+		}
+		converted, err := ao.converter.Convert(threshold, product.PriceUsd.CurrencyCode)
+		if err != nil {
+			return models.PriceAlert{}, fmt.Errorf("%w: %v", ErrInvalidAlert, err)
+		}
+		threshold = converted
+	}
+	if webhookURL != "" {
+		if err := checkWebhookURL(context.Background(), webhookURL); err != nil {
+			return models.PriceAlert{}, fmt.Errorf("%w: %v", ErrInvalidAlert, err)
+		}
+	}
+
+	alert, err := ao.alerts.Add(models.PriceAlert{
+		UserID:     userID,
+		ProductID:  productID,
+		Threshold:  threshold,
+		WebhookURL: webhookURL,
+	})
+	if err != nil {
+		return alert, err
+	}
+	ao.requestAlertCheck()
+	return alert, nil
+}
+
+func (ao *AgentOrchestrator) PriceAlerts(userID string) []models.PriceAlert {
+	return ao.alerts.Alerts(userID)
+}
+
+func (ao *AgentOrchestrator) DeletePriceAlert(userID, alertID string) error {
+	return ao.alerts.Remove(userID, alertID)
+}
+
+func (ao *AgentOrchestrator) Notifications(userID string) []models.Notification {
+	return ao.alerts.Notifications(userID)
+}
+
+// requestAlertCheck asks the scheduler for an early run. It never blocks:
+// a request already queued covers this one.
+func (ao *AgentOrchestrator) requestAlertCheck() {
+	select {
+	case ao.alertCheck <- struct{}{}:
+	default:
+	}
+}
+
+// runAlertScheduler evaluates pending alerts on a timer and on request.
+func (ao *AgentOrchestrator) runAlertScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ao.alertCheck:
+		}
+		ao.evaluateAlerts(context.Background())
+	}
+}
+
+// evaluateAlerts fires every pending alert whose product now costs no more
+// than its threshold, promotions included.
+func (ao *AgentOrchestrator) evaluateAlerts(ctx context.Context) {
+	for _, alert := range ao.alerts.Pending() {
+		product, ok := ao.Catalog().Product(alert.ProductID)
+		if !ok {
+			continue
+		}
+
+		price := ao.currentPrice(product)
+		if comparison, err := price.Compare(alert.Threshold); err != nil || comparison > 0 {
+			continue
+		}
+
+		notification, fired, err := ao.alerts.Trigger(alert, models.Notification{
+			UserID:    alert.UserID,
+			AlertID:   alert.ID,
+			ProductID: product.ID,
+			Message:   fmt.Sprintf("%s is now %s, at or below your alert price of %s", product.Name, price, alert.Threshold),
+			Price:     &price,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("Failed to save price alert %s: %v", alert.ID, err)
+		}
+		if !fired {
+			continue
+		}
+		log.Printf("Price alert %s fired for user %s", alert.ID, alert.UserID)
+
+		if alert.WebhookURL != "" {
+			if err := deliverWebhook(ctx, alert.WebhookURL, notification); err != nil {
+				notification.DeliveryError = err.Error()
+			} else {
+				notification.Delivered = true
+			}
+			if err := ao.alerts.UpdateNotification(notification); err != nil {
+				log.Printf("Failed to save notification %s: %v", notification.ID, err)
+			}
+		}
+	}
+}
+
+// currentPrice is what one unit of a product costs now, promotions included.
+func (ao *AgentOrchestrator) currentPrice(product models.Product) models.Money {
+	if pricingAgent, ok := ao.agents["pricing_agent"].(*PricingAgent); ok {
+		return pricingAgent.Quote(product, nil, 1).Final
+	}
+	return product.PriceUsd
+}
+
+// Addresses webhooks may not be sent to beyond the loopback, private,
+// link-local, multicast and unspecified ones net/netip knows about.
+var reservedWebhookPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64, which can reach any IPv4 address
+}
+
+// publicAddress reports whether webhooks may be sent to addr, so that a
+// webhook URL cannot be used to reach the server's own network.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range reservedWebhookPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookURL accepts http(s) URLs whose host resolves only to public
+// addresses. The address is checked again when the webhook is sent, since
+// DNS may have changed by then.
+func checkWebhookURL(ctx context.Context, webhookURL string) error {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("webhook_url must be an http(s) URL")
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("webhook_url host does not resolve: %v", err)
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return fmt.Errorf("webhook_url must not point to a private or local address")
+		}
+	}
+	return nil
+}
+
+// webhookClient only connects to public addresses, and does not follow
+// redirects, which could lead anywhere.
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return err
+				}
+				if !publicAddress(addrPort.Addr()) {
+					return fmt.Errorf("webhook address %s is not public", addrPort.Addr())
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func deliverWebhook(ctx context.Context, webhookURL string, notification models.Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package agents
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"celeste/models"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, tt := range tests {
+		if got := publicAddress(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("publicAddress(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	for _, webhookURL := range []string{
+		"ftp://93.184.216.34/hook",
+		"http:///hook",
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://localhost/hook",
+	} {
+		if err := checkWebhookURL(context.Background(), webhookURL); err == nil {
+			t.Errorf("accepted %s", webhookURL)
+		}
+	}
+	if err := checkWebhookURL(context.Background(), "https://93.184.216.34/hook"); err != nil {
+		t.Errorf("rejected a public address: %v", err)
+	}
+}
+
+func TestDeliverWebhookRefusesLocalAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	if err := deliverWebhook(context.Background(), server.URL, models.Notification{ID: "n1"}); err == nil {
+		t.Error("delivered to a loopback address")
+	}
+	if called {
+		t.Error("connected to a loopback address")
+	}
+}
@@ -0,0 +1,193 @@
+package agents
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"celeste/catalog"
+	"celeste/models"
+)
+
+// CatalogManager is implemented by the agent that owns the product
+// catalogue and keeps its search indexes in step with changes.
+type CatalogManager interface {
+	Products() []models.Product
+	Product(id string) (models.Product, bool)
+	CreateProduct(ctx context.Context, product models.Product) (models.Product, error)
+	UpdateProduct(ctx context.Context, id string, product models.Product) (models.Product, error)
+	DeleteProduct(ctx context.Context, id string) error
+	ImportProducts(ctx context.Context, products []models.Product, dryRun bool) (*catalog.ImportReport, error)
+	Reload(ctx context.Context) (CatalogStatus, error)
+	Status() CatalogStatus
+}
+
+func (sa *SearchAgent) Products() []models.Product {
+	sa.catalogMutex.RLock()
+	defer sa.catalogMutex.RUnlock()
+
+	products := make([]models.Product, len(sa.catalog))
+	copy(products, sa.catalog)
+	return products
+}
+
+func (sa *SearchAgent) Product(id string) (models.Product, bool) {
+	sa.catalogMutex.RLock()
+	defer sa.catalogMutex.RUnlock()
+
+	if doc, ok := sa.index.docs[id]; ok {
+		return doc.product, true
+	}
+	return models.Product{}, false
+}
+
+func (sa *SearchAgent) CreateProduct(ctx context.Context, product models.Product) (models.Product, error) {
+	product = catalog.Normalize(product)
+	if err := catalog.Validate(product); err != nil {
+		return product, err
+	}
+	if product.CreatedAt.IsZero() {
+		product.CreatedAt = time.Now().UTC()
+	}
+
+	sa.writeMutex.Lock()
+	defer sa.writeMutex.Unlock()
+	sa.catalogMutex.Lock()
+	defer sa.catalogMutex.Unlock()
+
+	if _, exists := sa.index.docs[product.ID]; exists {
+		return product, catalog.ErrExists
+	}
+
+	updated := append(append([]models.Product{}, sa.catalog...), product)
+	snapshot, err := sa.store.Save(updated)
+	if err != nil {
+		return product, err
+	}
+	sa.recordSnapshot(snapshot)
+
+	sa.catalog = updated
+	sa.index.Add(product)
+	sa.upsertVector(ctx, product)
+	return product, nil
+}
+
+// UpdateProduct replaces a product. The ID in the path wins over any ID in
+// the body, and the original creation time is kept unless one is supplied.
+func (sa *SearchAgent) UpdateProduct(ctx context.Context, id string, product models.Product) (models.Product, error) {
+	product.ID = id
+	product = catalog.Normalize(product)
+	if err := catalog.Validate(product); err != nil {
+		return product, err
+	}
+
+	sa.writeMutex.Lock()
+	defer sa.writeMutex.Unlock()
+	sa.catalogMutex.Lock()
+	defer sa.catalogMutex.Unlock()
+
+	position := sa.catalogPosition(id)
+	if position < 0 {
+		return product, catalog.ErrNotFound
+	}
+	if product.CreatedAt.IsZero() {
+		product.CreatedAt = sa.catalog[position].CreatedAt
+	}
+
+	updated := append([]models.Product{}, sa.catalog...)
+	updated[position] = product
+	snapshot, err := sa.store.Save(updated)
+	if err != nil {
+		return product, err
+	}
+	sa.recordSnapshot(snapshot)
+
+	sa.catalog = updated
+	sa.index.Add(product)
+	sa.upsertVector(ctx, product)
+	return product, nil
+}
+
+func (sa *SearchAgent) DeleteProduct(ctx context.Context, id string) error {
+	sa.writeMutex.Lock()
+	defer sa.writeMutex.Unlock()
+	sa.catalogMutex.Lock()
+	defer sa.catalogMutex.Unlock()
+
+	position := sa.catalogPosition(id)
+	if position < 0 {
+		return catalog.ErrNotFound
+	}
+
+	updated := append(append([]models.Product{}, sa.catalog[:position]...), sa.catalog[position+1:]...)
+	snapshot, err := sa.store.Save(updated)
+	if err != nil {
+		return err
+	}
+	sa.recordSnapshot(snapshot)
+
+	sa.catalog = updated
+	sa.index.Remove(id)
+	if err := sa.vectors.Remove(id); err != nil {
+		log.Printf("Failed to persist product embeddings: %v", err)
+	}
+	return nil
+}
+
+// ImportProducts upserts products in bulk with a single store write. A dry
+// run only reports what would change.
+func (sa *SearchAgent) ImportProducts(ctx context.Context, products []models.Product, dryRun bool) (*catalog.ImportReport, error) {
+	sa.writeMutex.Lock()
+	defer sa.writeMutex.Unlock()
+
+	sa.catalogMutex.RLock()
+	merged, report := catalog.Merge(sa.catalog, products, time.Now().UTC())
+	sa.catalogMutex.RUnlock()
+
+	report.DryRun = dryRun
+	if dryRun || (len(report.Added) == 0 && len(report.Updated) == 0) {
+		return report, nil
+	}
+
+	snapshot, err := sa.store.Save(merged)
+	if err != nil {
+		return report, err
+	}
+
+	changed := make(map[string]bool)
+	for _, id := range report.Added {
+		changed[id] = true
+	}
+	for _, change := range report.Updated {
+		changed[change.ID] = true
+	}
+
+	sa.catalogMutex.Lock()
+	defer sa.catalogMutex.Unlock()
+	sa.catalog = merged
+	for _, product := range merged {
+		if changed[product.ID] {
+			sa.index.Add(product)
+			sa.upsertVector(ctx, product)
+		}
+	}
+	sa.recordSnapshot(snapshot)
+	return report, nil
+}
+
+func (sa *SearchAgent) catalogPosition(id string) int {
+	for i, product := range sa.catalog {
+		if product.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// upsertVector refreshes a product's embedding. A failure only degrades
+// semantic matching for that product, so it is logged rather than returned.
+func (sa *SearchAgent) upsertVector(ctx context.Context, product models.Product) {
+	if err := sa.vectors.Upsert(ctx, product); err != nil {
+		log.Printf("Failed to update embedding for %s: %v", product.ID, err)
+	}
+}
@@ -0,0 +1,174 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"celeste/catalog"
+	"celeste/models"
+)
+
+// testCatalogAgent is an initialised search agent serving products from a
+// catalogue file in a temporary directory, with polling turned off.
+func testCatalogAgent(t *testing.T, products ...models.Product) *SearchAgent {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "itemCatalogue.json")
+	if _, err := catalog.NewFileStore(path).Save(products); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CELESTE_CATALOG_PATH", path)
+	t.Setenv("CELESTE_CATALOG_POLL_INTERVAL", "0")
+	t.Setenv("CELESTE_EMBEDDER", "")
+	t.Setenv("CELESTE_SYNONYMS_PATH", "../data/synonyms.json")
+	t.Setenv("CELESTE_INTENT_TRAINING_PATH", "../data/intentTraining.json")
+
+	sa := NewSearchAgent(nil)
+	if err := sa.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return sa
+}
+
+// storedIDs lists the product IDs in the agent's catalogue file.
+func storedIDs(t *testing.T, sa *SearchAgent) []string {
+	t.Helper()
+	snapshot, err := sa.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(snapshot.Products))
+	for i, product := range snapshot.Products {
+		ids[i] = product.ID
+	}
+	return ids
+}
+
+func TestCreateProduct(t *testing.T) {
+	sa := testCatalogAgent(t, testProduct("b1", "Leather Boot", 120, "boots"))
+	ctx := context.Background()
+
+	created, err := sa.CreateProduct(ctx, testProduct("s1", " Canvas Sneaker ", 60, "Sneakers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "Canvas Sneaker" || created.Categories[0] != "sneakers" || created.CreatedAt.IsZero() {
+		t.Errorf("created %+v, want a normalised product with a creation time", created)
+	}
+	if product, ok := sa.FindProduct(ctx, "canvas sneaker"); !ok || product.ID != "s1" {
+		t.Errorf("FindProduct after create = %q, %v", product.ID, ok)
+	}
+	if ids := storedIDs(t, sa); len(ids) != 2 || ids[1] != "s1" {
+		t.Errorf("stored %v, want the new product saved", ids)
+	}
+	if status := sa.Status(); status.Version != 2 || status.Products != 2 {
+		t.Errorf("status = %+v, want version 2 with 2 products", status)
+	}
+
+	if _, err := sa.CreateProduct(ctx, testProduct("s1", "Another Sneaker", 70)); !errors.Is(err, catalog.ErrExists) {
+		t.Errorf("duplicate create error = %v, want ErrExists", err)
+	}
+
+	invalid := testProduct("j1", "", -5)
+	var ve *catalog.ValidationError
+	if _, err := sa.CreateProduct(ctx, invalid); !errors.As(err, &ve) {
+		t.Errorf("invalid create error = %v, want a ValidationError", err)
+	}
+	if _, ok := sa.Product("j1"); ok {
+		t.Error("an invalid product was added to the catalogue")
+	}
+	if ids := storedIDs(t, sa); len(ids) != 2 {
+		t.Errorf("stored %v after failed creates, want 2 products", ids)
+	}
+}
+
+func TestUpdateProduct(t *testing.T) {
+	sa := testCatalogAgent(t, testProduct("b1", "Leather Boot", 120, "boots"), testProduct("s1", "Canvas Sneaker", 60, "sneakers"))
+	ctx := context.Background()
+	original, _ := sa.Product("b1")
+
+	update := testProduct("ignored", "Suede Chelsea Boot", 140, "boots")
+	updated, err := sa.UpdateProduct(ctx, "b1", update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != "b1" || !updated.CreatedAt.Equal(original.CreatedAt) {
+		t.Errorf("updated %+v, want the path ID and the original creation time", updated)
+	}
+	if product, _ := sa.Product("b1"); product.Name != "Suede Chelsea Boot" {
+		t.Errorf("Product after update = %+v", product)
+	}
+	if product, ok := sa.FindProduct(ctx, "suede chelsea"); !ok || product.ID != "b1" {
+		t.Errorf("FindProduct after update = %q, %v", product.ID, ok)
+	}
+	if ids := sa.Products(); ids[0].ID != "b1" {
+		t.Errorf("update moved the product: %v", ids)
+	}
+
+	if _, err := sa.UpdateProduct(ctx, "x1", update); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("update of an unknown product error = %v, want ErrNotFound", err)
+	}
+	if _, err := sa.UpdateProduct(ctx, "b1", testProduct("", "", 140)); err == nil {
+		t.Error("invalid update succeeded")
+	}
+	if product, _ := sa.Product("b1"); product.Name != "Suede Chelsea Boot" {
+		t.Errorf("invalid update changed the product: %+v", product)
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	sa := testCatalogAgent(t, testProduct("b1", "Leather Boot", 120, "boots"), testProduct("s1", "Canvas Sneaker", 60, "sneakers"))
+	ctx := context.Background()
+
+	if err := sa.DeleteProduct(ctx, "b1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sa.Product("b1"); ok {
+		t.Error("deleted product is still served")
+	}
+	if product, ok := sa.FindProduct(ctx, "leather boot"); ok && product.ID == "b1" {
+		t.Error("deleted product is still found by search")
+	}
+	if ids := storedIDs(t, sa); len(ids) != 1 || ids[0] != "s1" {
+		t.Errorf("stored %v after delete, want [s1]", ids)
+	}
+
+	if err := sa.DeleteProduct(ctx, "b1"); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("second delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestImportProducts(t *testing.T) {
+	sa := testCatalogAgent(t, testProduct("b1", "Leather Boot", 120, "boots"))
+	ctx := context.Background()
+	incoming := []models.Product{
+		testProduct("b1", "Leather Boot", 99, "boots"),
+		testProduct("s1", "Canvas Sneaker", 60, "sneakers"),
+		testProduct("x1", "", 10),
+	}
+
+	report, err := sa.ImportProducts(ctx, incoming, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || len(report.Added) != 1 || len(report.Updated) != 1 || len(report.Invalid) != 1 {
+		t.Errorf("dry run report = %+v", report)
+	}
+	if len(sa.Products()) != 1 || sa.Status().Version != 1 {
+		t.Error("a dry run changed the catalogue")
+	}
+
+	if _, err := sa.ImportProducts(ctx, incoming, false); err != nil {
+		t.Fatal(err)
+	}
+	if product, _ := sa.Product("b1"); product.PriceUsd.Units != 99 {
+		t.Errorf("b1 = %+v, want the imported price", product)
+	}
+	if product, ok := sa.FindProduct(ctx, "canvas sneaker"); !ok || product.ID != "s1" {
+		t.Errorf("FindProduct after import = %q, %v", product.ID, ok)
+	}
+	if ids := storedIDs(t, sa); len(ids) != 2 {
+		t.Errorf("stored %v after import, want b1 and s1", ids)
+	}
+}
@@ -0,0 +1,154 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"celeste/catalog"
+	"celeste/models"
+)
+
+const defaultCatalogPollInterval = 5 * time.Second
+
+// CatalogStatus describes the catalogue version currently being served.
+type CatalogStatus struct {
+	Version     int       `json:"version"`
+	ETag        string    `json:"etag"`
+	Products    int       `json:"products"`
+	LoadedAt    time.Time `json:"loaded_at"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+}
+
+// catalogPollInterval reads CELESTE_CATALOG_POLL_INTERVAL (a Go duration;
+// "0" disables watching).
+func catalogPollInterval() time.Duration {
+	value := os.Getenv("CELESTE_CATALOG_POLL_INTERVAL")
+	if value == "" {
+		return defaultCatalogPollInterval
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid CELESTE_CATALOG_POLL_INTERVAL %q, using %s", value, defaultCatalogPollInterval)
+		return defaultCatalogPollInterval
+	}
+	return interval
+}
+
+// prepareCatalog normalises and validates a loaded catalogue in place.
+func prepareCatalog(products []models.Product) error {
+	seen := make(map[string]bool, len(products))
+	for i := range products {
+		products[i] = catalog.Normalize(products[i])
+		if err := catalog.Validate(products[i]); err != nil {
+			return fmt.Errorf("product %d (%s): %v", i, products[i].ID, err)
+		}
+		if seen[products[i].ID] {
+			return fmt.Errorf("duplicate product id %s", products[i].ID)
+		}
+		seen[products[i].ID] = true
+	}
+	return nil
+}
+
+// recordSnapshot notes the version now being served. Callers hold the
+// catalogue write lock (or are initialising).
+func (sa *SearchAgent) recordSnapshot(snapshot *catalog.Snapshot) {
+	sa.modTime = snapshot.ModTime
+	sa.status.Version++
+	sa.status.ETag = snapshot.ETag
+	sa.status.Products = len(snapshot.Products)
+	sa.status.LoadedAt = time.Now().UTC()
+	sa.status.LastError = ""
+	sa.status.LastErrorAt = time.Time{}
+	if sa.onChange != nil {
+		sa.onChange()
+	}
+}
+
+func (sa *SearchAgent) Status() CatalogStatus {
+	sa.catalogMutex.RLock()
+	defer sa.catalogMutex.RUnlock()
+	return sa.status
+}
+
+// Reload re-reads the catalogue store and, if its contents changed, builds
+// fresh indexes and swaps them in at once. On a read, parse or validation
+// error the current catalogue keeps being served and the error is recorded
+// in the status.
+func (sa *SearchAgent) Reload(ctx context.Context) (CatalogStatus, error) {
+	sa.writeMutex.Lock()
+	defer sa.writeMutex.Unlock()
+
+	snapshot, err := sa.store.Load()
+	if err == nil {
+		err = prepareCatalog(snapshot.Products)
+	}
+	if err != nil {
+		sa.catalogMutex.Lock()
+		defer sa.catalogMutex.Unlock()
+		if modTime, statErr := sa.store.ModTime(); statErr == nil {
+			// Do not retry the same broken file on every poll.
+			sa.modTime = modTime
+		}
+		sa.status.LastError = err.Error()
+		sa.status.LastErrorAt = time.Now().UTC()
+		return sa.status, fmt.Errorf("catalogue reload failed, keeping version %d: %v", sa.status.Version, err)
+	}
+
+	current := sa.Status()
+	if snapshot.ETag == current.ETag {
+		sa.catalogMutex.Lock()
+		sa.modTime = snapshot.ModTime
+		sa.catalogMutex.Unlock()
+		return current, nil
+	}
+
+	index := NewSearchIndex(snapshot.Products)
+	vectors := NewVectorIndex(sa.vectors.embedder, sa.vectors.path)
+	if err := vectors.Build(ctx, snapshot.Products); err != nil {
+		log.Printf("Keeping previous product embeddings: %v", err)
+		vectors = sa.vectors
+	}
+
+	sa.catalogMutex.Lock()
+	defer sa.catalogMutex.Unlock()
+	sa.catalog = snapshot.Products
+	sa.index = index
+	sa.vectors = vectors
+	sa.recordSnapshot(snapshot)
+
+	log.Printf("Catalogue reloaded: version %d, %d products, etag %s", sa.status.Version, len(sa.catalog), sa.status.ETag)
+	return sa.status, nil
+}
+
+// watchCatalog polls the store's modification time and reloads on change.
+func (sa *SearchAgent) watchCatalog(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			modTime, err := sa.store.ModTime()
+			if err != nil {
+				continue
+			}
+
+			sa.catalogMutex.RLock()
+			changed := !modTime.Equal(sa.modTime)
+			sa.catalogMutex.RUnlock()
+
+			if changed {
+				if _, err := sa.Reload(context.Background()); err != nil {
+					log.Printf("%v", err)
+				}
+			}
+		}
+	}
+}
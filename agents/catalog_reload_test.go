@@ -0,0 +1,87 @@
+package agents
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"celeste/catalog"
+	"celeste/models"
+)
+
+func TestReloadKeepsCatalogueOnError(t *testing.T) {
+	sa := testCatalogAgent(t, testProduct("b1", "Leather Boot", 120, "boots"))
+	ctx := context.Background()
+	path := sa.store.(*catalog.FileStore).Path()
+	changes := 0
+	sa.SetChangeListener(func() { changes++ })
+
+	tests := []struct {
+		name      string
+		contents  string
+		wantError string
+	}{
+		{name: "malformed JSON", contents: `{"products": [`, wantError: "unexpected end of JSON input"},
+		{name: "invalid product", contents: `{"products": [{"id": "b1", "name": "", "priceUsd": {"currency_code": "USD", "units": 120}}]}`, wantError: "name: is required"},
+		{name: "duplicate IDs", contents: `{"products": [
+			{"id": "b1", "name": "Boot", "priceUsd": {"currency_code": "USD", "units": 120}},
+			{"id": "b1", "name": "Boot", "priceUsd": {"currency_code": "USD", "units": 130}}]}`, wantError: "duplicate product id b1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := sa.Reload(ctx)
+			if err == nil || !strings.Contains(err.Error(), "keeping version 1") || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Reload error = %v, want %q keeping version 1", err, tt.wantError)
+			}
+			if status.Version != 1 || status.LastError == "" || status.LastErrorAt.IsZero() {
+				t.Errorf("status = %+v, want version 1 with the error recorded", status)
+			}
+			if product, ok := sa.Product("b1"); !ok || product.Name != "Leather Boot" {
+				t.Errorf("Product(b1) = %+v, %v, want the previous catalogue", product, ok)
+			}
+			if product, ok := sa.FindProduct(ctx, "leather boot"); !ok || product.ID != "b1" {
+				t.Errorf("FindProduct = %q, %v, want the previous index", product.ID, ok)
+			}
+		})
+	}
+	if changes != 0 {
+		t.Errorf("change listener called %d times for failed reloads", changes)
+	}
+
+	if _, err := catalog.NewFileStore(path).Save([]models.Product{testProduct("s1", "Canvas Sneaker", 60, "sneakers")}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := sa.Reload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 2 || status.Products != 1 || status.LastError != "" {
+		t.Errorf("status after a good reload = %+v, want version 2 with the error cleared", status)
+	}
+	if _, ok := sa.Product("b1"); ok {
+		t.Error("b1 is still served after a reload without it")
+	}
+	if product, ok := sa.FindProduct(ctx, "canvas sneaker"); !ok || product.ID != "s1" {
+		t.Errorf("FindProduct after reload = %q, %v", product.ID, ok)
+	}
+	if changes != 1 {
+		t.Errorf("change listener called %d times, want once", changes)
+	}
+}
+
+func TestReloadUnchangedFile(t *testing.T) {
+	sa := testCatalogAgent(t, testProduct("b1", "Leather Boot", 120, "boots"))
+
+	status, err := sa.Reload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 1 {
+		t.Errorf("version = %d after reloading an unchanged file, want 1", status.Version)
+	}
+}
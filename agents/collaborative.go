@@ -0,0 +1,138 @@
+package agents
+
+import (
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"celeste/models"
+)
+
+const (
+	defaultRecommenderInterval = 5 * time.Minute
+	maxNeighbours              = 20
+)
+
+// recommenderInterval reads CELESTE_RECOMMENDER_INTERVAL (a Go duration),
+// how often the collaborative filtering model is rebuilt.
+func recommenderInterval() time.Duration {
+	value := os.Getenv("CELESTE_RECOMMENDER_INTERVAL")
+	if value == "" {
+		return defaultRecommenderInterval
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Invalid CELESTE_RECOMMENDER_INTERVAL %q, using %s", value, defaultRecommenderInterval)
+		return defaultRecommenderInterval
+	}
+	return interval
+}
+
+type neighbour struct {
+	productID string
+	score     float64
+	via       string // The seed that contributed most to score
+}
+
+// ItemSimilarity is an item-to-item collaborative filtering model: two
+// products are similar when the same shoppers showed interest in both.
+type ItemSimilarity struct {
+	neighbours   map[string][]neighbour // Most similar first
+	Interactions int                    `json:"interactions"`
+	Users        int                    `json:"users"`
+	Products     int                    `json:"products"`
+	BuiltAt      time.Time              `json:"built_at,omitzero"`
+}
+
+// BuildItemSimilarity computes the cosine similarity between products'
+// interest vectors. A shopper's interest in a product is the weight of
+// their strongest interaction with it, so a purchase counts for more than
+// a view and repeated views count once.
+func BuildItemSimilarity(interactions []models.Interaction) *ItemSimilarity {
+	interest := make(map[string]map[string]float64)
+	for _, interaction := range interactions {
+		items := interest[interaction.UserID]
+		if items == nil {
+			items = make(map[string]float64)
+			interest[interaction.UserID] = items
+		}
+		items[interaction.ProductID] = max(items[interaction.ProductID], interactionWeights[interaction.Type])
+	}
+
+	norms := make(map[string]float64)
+	dots := make(map[string]map[string]float64)
+	for _, items := range interest {
+		for a, weightA := range items {
+			norms[a] += weightA * weightA
+			for b, weightB := range items {
+				if a == b {
+					continue
+				}
+				if dots[a] == nil {
+					dots[a] = make(map[string]float64)
+				}
+				dots[a][b] += weightA * weightB
+			}
+		}
+	}
+
+	model := &ItemSimilarity{
+		neighbours:   make(map[string][]neighbour, len(dots)),
+		Interactions: len(interactions),
+		Users:        len(interest),
+		Products:     len(norms),
+		BuiltAt:      time.Now().UTC(),
+	}
+	for a, others := range dots {
+		neighbours := make([]neighbour, 0, len(others))
+		for b, dot := range others {
+			neighbours = append(neighbours, neighbour{productID: b, score: dot / math.Sqrt(norms[a]*norms[b])})
+		}
+		sort.Slice(neighbours, func(i, j int) bool {
+			if neighbours[i].score != neighbours[j].score {
+				return neighbours[i].score > neighbours[j].score
+			}
+			return neighbours[i].productID < neighbours[j].productID
+		})
+		model.neighbours[a] = neighbours[:min(len(neighbours), maxNeighbours)]
+	}
+	return model
+}
+
+// similar scores products by their summed similarity to the seed products,
+// best first, leaving out the excluded ones.
+func (m *ItemSimilarity) similar(seeds []string, exclude map[string]bool, limit int) []neighbour {
+	scores := make(map[string]*neighbour)
+	strongest := make(map[string]float64)
+	for _, seed := range seeds {
+		for _, n := range m.neighbours[seed] {
+			if exclude[n.productID] {
+				continue
+			}
+			scored := scores[n.productID]
+			if scored == nil {
+				scored = &neighbour{productID: n.productID}
+				scores[n.productID] = scored
+			}
+			scored.score += n.score
+			if n.score > strongest[n.productID] {
+				strongest[n.productID] = n.score
+				scored.via = seed
+			}
+		}
+	}
+
+	similar := make([]neighbour, 0, len(scores))
+	for _, scored := range scores {
+		similar = append(similar, *scored)
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].score != similar[j].score {
+			return similar[i].score > similar[j].score
+		}
+		return similar[i].productID < similar[j].productID
+	})
+	return similar[:min(len(similar), limit)]
+}
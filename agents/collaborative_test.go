@@ -0,0 +1,49 @@
+package agents
+
+import (
+	"math"
+	"testing"
+
+	"celeste/models"
+)
+
+func TestItemSimilarity(t *testing.T) {
+	interactions := []models.Interaction{
+		{UserID: "alice", ProductID: "a", Type: InteractionPurchase},
+		{UserID: "alice", ProductID: "b", Type: InteractionPurchase},
+		{UserID: "bob", ProductID: "a", Type: InteractionView},
+		{UserID: "bob", ProductID: "a", Type: InteractionView}, // repeated views count once
+		{UserID: "bob", ProductID: "b", Type: InteractionView},
+		{UserID: "bob", ProductID: "c", Type: InteractionView},
+		{UserID: "carol", ProductID: "c", Type: InteractionPurchase},
+		{UserID: "dave", ProductID: "d", Type: InteractionPurchase},
+	}
+	model := BuildItemSimilarity(interactions)
+	if model.Interactions != 8 || model.Users != 4 || model.Products != 4 {
+		t.Errorf("model counts = %d interactions, %d users, %d products", model.Interactions, model.Users, model.Products)
+	}
+
+	// a and b have the same interest vectors, (5, 1, 0), so their cosine
+	// is 1; a and c, (5, 1, 0) and (0, 1, 5), share only bob's view
+	neighbours := model.neighbours["a"]
+	if len(neighbours) != 2 || neighbours[0].productID != "b" || neighbours[1].productID != "c" {
+		t.Fatalf("neighbours of a = %+v, want b then c", neighbours)
+	}
+	if math.Abs(neighbours[0].score-1) > 1e-9 || math.Abs(neighbours[1].score-1.0/26) > 1e-9 {
+		t.Errorf("similarities = %v, %v; want 1, 1/26", neighbours[0].score, neighbours[1].score)
+	}
+	if len(model.neighbours["d"]) != 0 {
+		t.Errorf("d has neighbours %+v, but no one else wanted it", model.neighbours["d"])
+	}
+
+	similar := model.similar([]string{"a", "c"}, map[string]bool{"a": true, "c": true}, 5)
+	if len(similar) != 1 || similar[0].productID != "b" || similar[0].via != "a" {
+		t.Fatalf("similar to a and c = %+v, want b via a", similar)
+	}
+	if want := 1 + 1.0/26; math.Abs(similar[0].score-want) > 1e-9 {
+		t.Errorf("b scored %v, want the summed similarity %v", similar[0].score, want)
+	}
+	if similar := model.similar([]string{"a"}, nil, 1); len(similar) != 1 || similar[0].productID != "b" {
+		t.Errorf("top product similar to a = %+v, want b", similar)
+	}
+}
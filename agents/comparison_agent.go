@@ -0,0 +1,339 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"celeste/models"
+	"google.golang.org/genai"
+)
+
+const maxComparedProducts = 4
+
+// ProductFinder resolves product references for agents that work with
+// products named in conversation.
+type ProductFinder interface {
+	Products() []models.Product
+	Product(id string) (models.Product, bool)
+	FindProduct(ctx context.Context, text string) (models.Product, bool)
+}
+
+var (
+	comparisonLeadPattern  = regexp.MustCompile(`^(?:can you |could you |please )*(?:compare|comparison of|what(?:'s| is) the difference between|difference between|which is better,?)\s*`)
+	comparisonSplitPattern = regexp.MustCompile(`\s*(?:,|\bvs\.?|\bversus\b)\s*`)
+	// "and" and "or" also appear in product names ("Black and White
+	// Sneaker"), so they only separate products after a lead such as
+	// "compare", and only once whole names have been taken out.
+	comparisonJoinPattern = regexp.MustCompile(`\s*\b(?:and|or)\b\s*`)
+)
+
+// Words that refer back to products already shown rather than naming one.
+var comparisonReferences = map[string]bool{
+	"these": true, "those": true, "them": true, "both": true, "the": true,
+	"two": true, "three": true, "ones": true, "it": true, "this": true,
+	"that": true, "one": true, "first": true, "second": true, "please": true,
+}
+
+type ComparisonAgent struct {
+	id           string
+	geminiClient *genai.Client
+	finder       ProductFinder
+	availability AvailabilitySource
+}
+
+func NewComparisonAgent(geminiClient *genai.Client, finder ProductFinder) *ComparisonAgent {
+	return &ComparisonAgent{
+		id:           "comparison_agent",
+		geminiClient: geminiClient,
+		finder:       finder,
+	}
+}
+
+func (ca *ComparisonAgent) SetAvailabilitySource(source AvailabilitySource) {
+	ca.availability = source
+}
+
+func (ca *ComparisonAgent) ID() string {
+	return ca.id
+}
+
+func (ca *ComparisonAgent) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Process compares the products named in the query ("the boots vs the
+// sneakers"). When fewer than two are named, the products shown in the
+// previous reply fill the gap, then the current search results.
+func (ca *ComparisonAgent) Process(ctx context.Context, input models.AgentMessage) (*models.AgentResponse, error) {
+	query, _ := input.Data["query"].(string)
+	searchResults, _ := input.Data["products"].([]models.Product)
+
+	var products []models.Product
+	if _, referenced := input.Data["referenced_products"]; referenced && len(searchResults) >= 2 {
+		// "compare those": the earlier products the query referred to
+		products = searchResults[:min(len(searchResults), maxComparedProducts)]
+	} else {
+		products = ca.resolveProducts(ctx, query, input.Context, searchResults)
+	}
+	if len(products) < 2 {
+		return nil, fmt.Errorf("need at least two products to compare, found %d", len(products))
+	}
+
+	table := ca.buildTable(products)
+	table.Summary = ca.summarize(ctx, query, table)
+
+	return &models.AgentResponse{
+		ID:        input.ID,
+		FromAgent: ca.id,
+		Type:      "product_comparison",
+		Data: map[string]interface{}{
+			"comparison": table,
+		},
+		NextActions: []string{"Add to cart", "See similar items"},
+		Success:     true,
+	}, nil
+}
+
+func (ca *ComparisonAgent) resolveProducts(ctx context.Context, query string, userContext *models.UserContext, searchResults []models.Product) []models.Product {
+	var products []models.Product
+	seen := make(map[string]bool)
+	add := func(product models.Product) {
+		if !seen[product.ID] && len(products) < maxComparedProducts {
+			seen[product.ID] = true
+			products = append(products, product)
+		}
+	}
+
+	text, named := namedProducts(query, ca.finder.Products())
+	for _, product := range named {
+		add(product)
+	}
+	for _, subject := range comparisonSubjects(text) {
+		if product, ok := ca.finder.FindProduct(ctx, subject); ok {
+			add(product)
+		}
+	}
+	if len(products) >= 2 {
+		return products
+	}
+
+	if userContext != nil {
+		for _, id := range userContext.RecentProducts {
+			if product, ok := ca.finder.Product(id); ok {
+				add(product)
+			}
+		}
+	}
+	for _, product := range searchResults {
+		if len(products) >= 2 {
+			break
+		}
+		add(product)
+	}
+	return products
+}
+
+// namedProducts finds the catalogue products a query names in full, in the
+// order it names them, longest names first so "Black and White Sneaker"
+// is not taken for "White Sneaker". It returns the query with those names
+// replaced by commas, leaving the rest to be split into descriptions.
+func namedProducts(query string, catalogue []models.Product) (string, []models.Product) {
+	text := normalizeQuery(query)
+	sort.SliceStable(catalogue, func(i, j int) bool {
+		return len(catalogue[i].Name) > len(catalogue[j].Name)
+	})
+
+	type match struct {
+		at      int
+		product models.Product
+	}
+	var matches []match
+	for _, product := range catalogue {
+		name := normalizeQuery(product.Name)
+		if at := phraseIndex(text, name); name != "" && at >= 0 {
+			matches = append(matches, match{at, product})
+			text = text[:at] + strings.Repeat(",", len(name)) + text[at+len(name):]
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].at < matches[j].at })
+
+	named := make([]models.Product, len(matches))
+	for i, m := range matches {
+		named[i] = m.product
+	}
+	return text, named
+}
+
+// phraseIndex is where phrase first appears in text as whole words, or -1.
+func phraseIndex(text, phrase string) int {
+	isWord := func(b byte) bool {
+		return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b >= 0x80
+	}
+	for offset := 0; ; {
+		at := strings.Index(text[offset:], phrase)
+		if at < 0 {
+			return -1
+		}
+		at += offset
+		end := at + len(phrase)
+		if (at == 0 || !isWord(text[at-1])) && (end == len(text) || !isWord(text[end])) {
+			return at
+		}
+		offset = at + 1
+	}
+}
+
+// comparisonSubjects splits "compare the leather boots and the canvas
+// sneakers" or "boots vs sneakers" into the product descriptions it names.
+func comparisonSubjects(query string) []string {
+	text := strings.TrimRight(normalizeQuery(query), "?.!")
+	lead := comparisonLeadPattern.FindString(text)
+	text = text[len(lead):]
+
+	var parts []string
+	for _, part := range comparisonSplitPattern.Split(text, -1) {
+		if lead != "" {
+			parts = append(parts, comparisonJoinPattern.Split(part, -1)...)
+		} else {
+			parts = append(parts, part)
+		}
+	}
+
+	var subjects []string
+	for _, part := range parts {
+		var words []string
+		for _, token := range tokenize(part) {
+			if !comparisonReferences[token] {
+				words = append(words, token)
+			}
+		}
+		if len(words) > 0 {
+			subjects = append(subjects, strings.Join(words, " "))
+		}
+	}
+	return subjects
+}
+
+func (ca *ComparisonAgent) buildTable(products []models.Product) *models.ComparisonTable {
+	table := &models.ComparisonTable{Products: products}
+
+	row := func(attribute string, value func(models.Product) string) models.ComparisonRow {
+		values := make(map[string]string, len(products))
+		for _, product := range products {
+			values[product.ID] = value(product)
+		}
+		return models.ComparisonRow{Attribute: attribute, Values: values}
+	}
+	best := func(r models.ComparisonRow, score func(models.Product) float64) models.ComparisonRow {
+		bestID, bestScore, tied := "", 0.0, false
+		for _, product := range products {
+			switch s := score(product); {
+			case bestID == "" || s > bestScore:
+				bestID, bestScore, tied = product.ID, s, false
+			case s == bestScore:
+				tied = true
+			}
+		}
+		if !tied && bestScore != 0 {
+			r.Best = bestID
+		}
+		return r
+	}
+
+	table.Rows = append(table.Rows,
+		row("name", func(p models.Product) string { return p.Name }),
+		best(row("price", func(p models.Product) string { return p.PriceUsd.String() }),
+			func(p models.Product) float64 { return -priceValue(p.PriceUsd) }),
+		row("brand", func(p models.Product) string { return orDash(p.Brand) }),
+		row("material", func(p models.Product) string { return orDash(p.Material) }),
+		best(row("rating", func(p models.Product) string {
+			if p.ReviewCount == 0 && p.Rating == 0 {
+				return "-"
+			}
+			return strconv.FormatFloat(p.Rating, 'f', 1, 64) + "/5"
+		}), func(p models.Product) float64 { return p.Rating }),
+		best(row("reviews", func(p models.Product) string { return strconv.Itoa(p.ReviewCount) }),
+			func(p models.Product) float64 { return float64(p.ReviewCount) }),
+		row("categories", func(p models.Product) string { return strings.Join(p.Categories, ", ") }),
+		row("sizes", func(p models.Product) string { return orDash(strings.Join(productSizes(p), ", ")) }),
+		row("colours", func(p models.Product) string { return orDash(strings.Join(productColors(p), ", ")) }),
+	)
+	if ca.availability != nil {
+		table.Rows = append(table.Rows, row("availability", func(p models.Product) string {
+			return strings.ReplaceAll(ca.availability.Availability(p), "_", " ")
+		}))
+	}
+	return table
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// summarize asks the LLM for a short comparison that may only use facts
+// from the table, falling back to a summary built from the table itself.
+func (ca *ComparisonAgent) summarize(ctx context.Context, query string, table *models.ComparisonTable) string {
+	rows, _ := json.Marshal(table.Rows)
+	prompt := fmt.Sprintf(`You are Céleste, a shopping assistant. The customer asked: "%s"
+
+Compare these products using ONLY the facts in this table (JSON rows keyed by product ID). Do not mention any feature, price or claim that is not in the table. Products: %s
+
+Table: %s
+
+Write two or three short sentences and end with which product suits which kind of shopper.`, query, productNames(table.Products), rows)
+
+	if ca.geminiClient != nil {
+		resp, err := generate(ctx, ca.geminiClient, prompt)
+		if err == nil && strings.TrimSpace(resp.Text()) != "" {
+			return strings.TrimSpace(resp.Text())
+		}
+	}
+	return tableSummary(table)
+}
+
+func productNames(products []models.Product) string {
+	names := make([]string, len(products))
+	for i, product := range products {
+		names[i] = fmt.Sprintf("%s = %s", product.ID, product.Name)
+	}
+	return strings.Join(names, "; ")
+}
+
+// tableSummary describes the winner of each attribute that has one.
+func tableSummary(table *models.ComparisonTable) string {
+	names := make(map[string]string, len(table.Products))
+	for _, product := range table.Products {
+		names[product.ID] = product.Name
+	}
+
+	var sentences []string
+	for _, row := range table.Rows {
+		if row.Best == "" {
+			continue
+		}
+		switch row.Attribute {
+		case "price":
+			sentences = append(sentences, fmt.Sprintf("%s is the cheapest at %s.", names[row.Best], row.Values[row.Best]))
+		case "rating":
+			sentences = append(sentences, fmt.Sprintf("%s is the best rated (%s).", names[row.Best], row.Values[row.Best]))
+		case "reviews":
+			sentences = append(sentences, fmt.Sprintf("%s has the most reviews (%s).", names[row.Best], row.Values[row.Best]))
+		}
+	}
+	if len(sentences) == 0 {
+		return "Here's how they compare side by side."
+	}
+	return strings.Join(sentences, " ")
+}
+
+func (ca *ComparisonAgent) Shutdown(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package agents
+
+import (
+	"slices"
+	"testing"
+
+	"celeste/models"
+)
+
+func TestNamedProducts(t *testing.T) {
+	catalogue := []models.Product{
+		{ID: "ws", Name: "White Sneaker"},
+		{ID: "bws", Name: "Black and White Sneaker"},
+		{ID: "wd", Name: "Wrap Dress with Belt"},
+		{ID: "cs", Name: "Canvas Sneaker"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"compare the Black and White Sneaker and the canvas sneaker", []string{"bws", "cs"}},
+		{"Wrap Dress with Belt vs White Sneaker", []string{"wd", "ws"}},
+		{"compare the white sneakers and the canvas ones", nil},
+		{"compare the leather boots and the canvas sneakers", nil},
+	}
+	for _, tt := range tests {
+		_, named := namedProducts(tt.query, slices.Clone(catalogue))
+		ids := make([]string, len(named))
+		for i, product := range named {
+			ids[i] = product.ID
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("namedProducts(%q) = %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+}
+
+func TestComparisonSubjects(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"compare the leather boots and the canvas sneakers", []string{"leather boots", "canvas sneakers"}},
+		{"leather boots vs canvas sneakers", []string{"leather boots", "canvas sneakers"}},
+		{"which is better, the rain jacket or the parka?", []string{"rain jacket", "parka"}},
+		{"boots, sneakers versus sandals", []string{"boots", "sneakers", "sandals"}},
+		// Without a lead, "and", "with" and "to" may be part of a name
+		{"black and white sneaker vs wrap dress with belt", []string{"black and white sneaker", "wrap dress with belt"}},
+		{"compare these", nil},
+	}
+	for _, tt := range tests {
+		if got := comparisonSubjects(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("comparisonSubjects(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	text, _ := namedProducts("compare the Black and White Sneaker and the canvas sneaker", []models.Product{{ID: "bws", Name: "Black and White Sneaker"}})
+	if got := comparisonSubjects(text); !slices.Equal(got, []string{"canvas sneaker"}) {
+		t.Errorf("subjects left after named products = %q, want [canvas sneaker]", got)
+	}
+}
@@ -0,0 +1,149 @@
+package agents
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"celeste/models"
+)
+
+// Weights of the signals in contentModel.similarity; they sum to 1.
+const (
+	categoryWeight    = 0.4
+	descriptionWeight = 0.4
+	priceWeight       = 0.2
+
+	minContentSimilarity = 0.2 // more than a price match alone can reach
+)
+
+// contentModel scores how alike two catalogue products are from their
+// categories, descriptions and prices. It needs no interaction history, so
+// it serves shoppers and products the collaborative model knows nothing
+// about.
+type contentModel struct {
+	products []models.Product // The catalogue the model was built from
+	idf      map[string]float64
+	vectors  map[string]map[string]float64 // TF-IDF of name and description, by product ID
+}
+
+func newContentModel(products []models.Product) *contentModel {
+	documentFrequency := make(map[string]int)
+	terms := make(map[string][]string, len(products))
+	for _, product := range products {
+		terms[product.ID] = analyze(product.Name + " " + product.Description)
+		seen := make(map[string]bool)
+		for _, term := range terms[product.ID] {
+			if !seen[term] {
+				seen[term] = true
+				documentFrequency[term]++
+			}
+		}
+	}
+
+	model := &contentModel{
+		products: products,
+		idf:      make(map[string]float64, len(documentFrequency)),
+		vectors:  make(map[string]map[string]float64, len(products)),
+	}
+	for term, df := range documentFrequency {
+		model.idf[term] = math.Log(1 + float64(len(products))/float64(df))
+	}
+	for id, productTerms := range terms {
+		vector := make(map[string]float64)
+		for _, term := range productTerms {
+			vector[term] += model.idf[term]
+		}
+		model.vectors[id] = vector
+	}
+	return model
+}
+
+func (cm *contentModel) similarity(a, b models.Product) float64 {
+	return categoryWeight*categoryOverlap(a, b) +
+		descriptionWeight*cosine(cm.vectors[a.ID], cm.vectors[b.ID]) +
+		priceWeight*priceProximity(a, b)
+}
+
+// categoryOverlap is the Jaccard index of two products' categories.
+func categoryOverlap(a, b models.Product) float64 {
+	categories := make(map[string]bool, len(a.Categories))
+	for _, category := range a.Categories {
+		categories[category] = true
+	}
+	shared, union := 0, len(categories)
+	for _, category := range b.Categories {
+		if categories[category] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+func cosine(a, b map[string]float64) float64 {
+	dot, normA, normB := 0.0, 0.0, 0.0
+	for term, weight := range a {
+		dot += weight * b[term]
+		normA += weight * weight
+	}
+	for _, weight := range b {
+		normB += weight * weight
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// priceProximity is 1 for equal prices, falling towards 0 as one price
+// grows relative to the other.
+func priceProximity(a, b models.Product) float64 {
+	priceA, priceB := priceValue(a.PriceUsd), priceValue(b.PriceUsd)
+	if priceA <= 0 || priceB <= 0 {
+		return 0
+	}
+	return min(priceA, priceB) / max(priceA, priceB)
+}
+
+// related scores each candidate by its similarity to the closest seed and
+// returns the best, leaving out the seeds and the excluded products. Each
+// recommendation's reason names the closest seed.
+func (cm *contentModel) related(seeds, candidates []models.Product, exclude map[string]bool, limit int) []models.Recommendation {
+	skip := make(map[string]bool, len(exclude)+len(seeds))
+	for id := range exclude {
+		skip[id] = true
+	}
+	for _, seed := range seeds {
+		skip[seed.ID] = true
+	}
+
+	recommendations := []models.Recommendation{}
+	for _, candidate := range candidates {
+		if skip[candidate.ID] {
+			continue
+		}
+		best, closest := 0.0, models.Product{}
+		for _, seed := range seeds {
+			if similarity := cm.similarity(seed, candidate); similarity > best {
+				best, closest = similarity, seed
+			}
+		}
+		if best >= minContentSimilarity {
+			recommendations = append(recommendations, models.Recommendation{
+				Product: candidate,
+				Score:   best,
+				Source:  "content",
+				Reasons: []models.Reason{{Code: ReasonSimilarTo, Message: fmt.Sprintf("Similar to %s", closest.Name)}},
+			})
+		}
+	}
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Score > recommendations[j].Score
+	})
+	return recommendations[:min(len(recommendations), limit)]
+}
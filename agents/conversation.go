@@ -0,0 +1,363 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"celeste/models"
+)
+
+const (
+	// Once a conversation has more turns than this, the older ones are
+	// folded into its summary, keeping keptConversationTurns in full.
+	maxConversationTurns  = 12
+	keptConversationTurns = 6
+	maxSummaryLines       = 5
+
+	promptConversationTurns = 4
+	maxPromptMessageLength  = 200
+)
+
+var (
+	// "the cheaper one", "the cheapest pair", "the less expensive option"
+	cheaperReferencePattern = regexp.MustCompile(`\bthe (?:cheaper|cheapest|less expensive|least expensive|lower priced|more affordable) ?(?:one|ones|pair|option)?\b`)
+	// "the pricier one", "the most expensive"
+	pricierReferencePattern = regexp.MustCompile(`\bthe (?:pricier|priciest|dearer|more expensive|most expensive) ?(?:one|ones|pair|option)?\b`)
+	// "the first one", "the second", "the last pair"
+	ordinalReferencePattern = regexp.MustCompile(`\bthe (first|second|third|fourth|fifth|last) ?(?:one|pair|option)?\b`)
+	// "those", "these boots", "them", "they"
+	pluralReferencePattern = regexp.MustCompile(`\b(?:those|these|them|they)\b`)
+	// "it", "that one", "this one"
+	singularReferencePattern = regexp.MustCompile(`\b(?:it|that one|this one|the one)\b`)
+	// A pronoun as the object of the request: "compare them", "show me
+	// those", "can I get it in black"
+	objectReferencePattern = regexp.MustCompile(`^(?:\w+ ){0,3}?(?:show me|compare|get|buy|add|take|want|like|love|prefer) (?:it|them|those|these|that one|this one)\b`)
+
+	ordinals = map[string]int{"first": 0, "second": 1, "third": 2, "fourth": 3, "fifth": 4}
+)
+
+// reference is what a follow-up referred back to.
+type reference struct {
+	products []string          // IDs of the products referred to, in the order shown
+	filters  map[string]string // What the rest of the query asked of them
+}
+
+// resolveReference resolves follow-ups that point at products shown in
+// earlier turns: "the cheaper one", "the second one", "do those come in
+// black?", "is it waterproof?". It reports false when the query refers to
+// nothing, or there is nothing earlier to refer to. userContext is the
+// snapshot the orchestrator sent; the caller holds catalogMutex.
+func (sa *SearchAgent) resolveReference(query string, userContext *models.UserContext) (reference, bool) {
+	if userContext == nil {
+		return reference{}, false
+	}
+	text := normalizeQuery(query)
+	if clearFiltersPattern.MatchString(text) {
+		return reference{}, false
+	}
+
+	shown := sa.shownEarlier(text, userContext.Conversation.Turns)
+	if len(shown) == 0 {
+		return reference{}, false
+	}
+
+	var referred []models.Product
+	var phrase string
+	switch {
+	case cheaperReferencePattern.MatchString(text):
+		phrase = cheaperReferencePattern.FindString(text)
+		referred = []models.Product{byPrice(shown)[0]}
+	case pricierReferencePattern.MatchString(text):
+		phrase = pricierReferencePattern.FindString(text)
+		ranked := byPrice(shown)
+		referred = []models.Product{ranked[len(ranked)-1]}
+	case ordinalReferencePattern.MatchString(text):
+		match := ordinalReferencePattern.FindStringSubmatch(text)
+		index, ok := ordinals[match[1]]
+		if match[1] == "last" {
+			index, ok = len(shown)-1, true
+		}
+		if !ok || index >= len(shown) {
+			return reference{}, false
+		}
+		phrase, referred = match[0], []models.Product{shown[index]}
+	case pluralReferencePattern.MatchString(text) && sa.pronounReference(text):
+		phrase, referred = pluralReferencePattern.FindString(text), shown
+	case singularReferencePattern.MatchString(text) && sa.pronounReference(text):
+		phrase, referred = singularReferencePattern.FindString(text), shown[:1]
+	default:
+		return reference{}, false
+	}
+
+	filters := sa.referenceFilters(strings.Replace(text, phrase, " ", 1), referred)
+	ids := make([]string, len(referred))
+	for i, product := range referred {
+		ids[i] = product.ID
+	}
+	return reference{products: ids, filters: filters}, true
+}
+
+// pronounReference reports whether a pronoun in text points back at earlier
+// products rather than being part of a new search: when it is the object of
+// the request ("compare them"), or when the message names no category of
+// its own ("is it waterproof?", "do those come in black?"). A category right
+// after "those" or "these" is the one referred to ("those leather boots").
+// "do they sell boots" and "shoes that go with them" are new searches.
+func (sa *SearchAgent) pronounReference(text string) bool {
+	if objectReferencePattern.MatchString(text) {
+		return true
+	}
+	tokens := tokenize(text)
+	for i, token := range tokens {
+		if _, ok := sa.categoryFor(token); !ok {
+			continue
+		}
+		if !slices.ContainsFunc(tokens[max(i-2, 0):i], isDemonstrative) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDemonstrative(word string) bool {
+	return word == "those" || word == "these"
+}
+
+// shownEarlier returns the products of the latest turn that showed any,
+// or, when the query names a category ("those boots"), of the latest turn
+// that showed products in each category named. A category nothing earlier
+// was in makes it a new search ("jackets like those"), so none are returned.
+func (sa *SearchAgent) shownEarlier(text string, turns []models.ConversationTurn) []models.Product {
+	var categories []string
+	for _, token := range tokenize(text) {
+		if category, ok := sa.categoryFor(token); ok {
+			categories = append(categories, category)
+		}
+	}
+
+	for i := len(turns) - 1; i >= 0; i-- {
+		var shown []models.Product
+		for _, id := range turns[i].Products {
+			if doc, ok := sa.index.docs[id]; ok {
+				shown = append(shown, doc.product)
+			}
+		}
+		named := len(shown) > 0
+		for _, category := range categories {
+			named = named && slices.ContainsFunc(shown, func(product models.Product) bool {
+				return hasCategory(product, category)
+			})
+		}
+		if named {
+			return shown
+		}
+	}
+	return nil
+}
+
+// referenceFilters picks out what a follow-up asks of the products it refers
+// to: a colour, size, price limit or stock ("do those come in black?", "is
+// it available in size 9?"), and a category that narrows them ("those
+// boots").
+func (sa *SearchAgent) referenceFilters(rest string, referred []models.Product) map[string]string {
+	_, filters, _ := sa.parseRefinement(rest)
+	if filters == nil {
+		filters = make(map[string]string)
+	}
+	for _, token := range tokenize(rest) {
+		if _, ok := filters["color"]; !ok {
+			if color, ok := sa.colorFor(token); ok {
+				filters["color"] = color
+				continue
+			}
+		}
+		if category, ok := sa.categoryFor(token); ok {
+			for _, product := range referred {
+				if hasCategory(product, category) {
+					filters["category"] = category
+					break
+				}
+			}
+		}
+	}
+	return filters
+}
+
+// byPrice orders products from cheapest to dearest, keeping the order shown
+// for equal prices.
+func byPrice(products []models.Product) []models.Product {
+	ranked := append([]models.Product(nil), products...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return priceValue(ranked[i].PriceUsd) < priceValue(ranked[j].PriceUsd)
+	})
+	return ranked
+}
+
+// remember adds a turn to the shopper's conversation, folding the oldest
+// turns into its summary once it grows past maxConversationTurns.
+func (ao *AgentOrchestrator) remember(ctx context.Context, userContext *models.UserContext, turn models.ConversationTurn) {
+	ao.mutex.Lock()
+	userContext.Conversation.Turns = append(userContext.Conversation.Turns, turn)
+	ao.mutex.Unlock()
+
+	ao.foldConversation(ctx, userContext)
+}
+
+// foldConversation folds all but the last keptConversationTurns turns into
+// the summary once there are more than maxConversationTurns.
+func (ao *AgentOrchestrator) foldConversation(ctx context.Context, userContext *models.UserContext) {
+	ao.mutex.Lock()
+	conversation := &userContext.Conversation
+	var folded []models.ConversationTurn
+	summary := conversation.Summary
+	if len(conversation.Turns) > maxConversationTurns {
+		cut := len(conversation.Turns) - keptConversationTurns
+		folded = append(folded, conversation.Turns[:cut]...)
+		conversation.Turns = append([]models.ConversationTurn(nil), conversation.Turns[cut:]...)
+	}
+	ao.mutex.Unlock()
+
+	if len(folded) == 0 {
+		return
+	}
+	summary = ao.summarizeConversation(ctx, summary, folded)
+
+	ao.mutex.Lock()
+	conversation.Summary = summary
+	conversation.Summarized += len(folded)
+	ao.mutex.Unlock()
+}
+
+// summarizeConversation asks the LLM to fold turns into the summary so far,
+// falling back to listing what was asked and shown.
+func (ao *AgentOrchestrator) summarizeConversation(ctx context.Context, summary string, turns []models.ConversationTurn) string {
+	prompt := fmt.Sprintf(`Summarise this shopping conversation for an assistant that will continue it. In at most four sentences, keep what the shopper is looking for, the products they were shown or liked, and any sizes, colours, budgets or occasions they mentioned.
+
+Summary so far:
+%s
+
+Further conversation:
+%s`, summary, ao.transcript(turns))
+
+	resp, err := generate(ctx, ao.geminiClient, prompt)
+	if err == nil {
+		if text := strings.TrimSpace(resp.Text()); text != "" {
+			return text
+		}
+	}
+	log.Printf("Summarising conversation locally: %v", err)
+	return ao.localSummary(summary, turns)
+}
+
+// localSummary adds a line naming the queries and products of the folded
+// turns, keeping the last maxSummaryLines lines.
+func (ao *AgentOrchestrator) localSummary(summary string, turns []models.ConversationTurn) string {
+	var queries, shown []string
+	for _, turn := range turns {
+		queries = append(queries, fmt.Sprintf("%q", turn.Query))
+		for _, id := range turn.Products {
+			if name := ao.productName(id); !contains(shown, name) {
+				shown = append(shown, name)
+			}
+		}
+	}
+	line := "The shopper asked " + strings.Join(queries, ", ") + "."
+	if len(shown) > 0 {
+		line += " They were shown " + strings.Join(shown, ", ") + "."
+	}
+
+	var lines []string
+	if summary != "" {
+		lines = strings.Split(summary, "\n")
+	}
+	lines = append(lines, line)
+	return strings.Join(lines[max(len(lines)-maxSummaryLines, 0):], "\n")
+}
+
+// conversationContext describes the conversation so far for the LLM: the
+// summary and the last few turns.
+func (ao *AgentOrchestrator) conversationContext(userContext *models.UserContext) string {
+	ao.mutex.RLock()
+	summary := userContext.Conversation.Summary
+	turns := userContext.Conversation.Turns
+	turns = append([]models.ConversationTurn(nil), turns[max(len(turns)-promptConversationTurns, 0):]...)
+	ao.mutex.RUnlock()
+
+	if summary == "" && len(turns) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString("Conversation so far:\n")
+	if summary != "" {
+		builder.WriteString("Earlier: " + summary + "\n")
+	}
+	builder.WriteString(ao.transcript(turns))
+	return builder.String()
+}
+
+// transcript writes turns out as shopper and assistant lines.
+func (ao *AgentOrchestrator) transcript(turns []models.ConversationTurn) string {
+	var builder strings.Builder
+	for _, turn := range turns {
+		fmt.Fprintf(&builder, "Shopper: %s\n", turn.Query)
+		if len(turn.Products) > 0 {
+			names := make([]string, len(turn.Products))
+			for i, id := range turn.Products {
+				names[i] = ao.productName(id)
+			}
+			fmt.Fprintf(&builder, "Shown: %s\n", strings.Join(names, "; "))
+		}
+		if turn.Message != "" {
+			message := []rune(turn.Message)
+			if len(message) > maxPromptMessageLength {
+				message = append(message[:maxPromptMessageLength], '…')
+			}
+			fmt.Fprintf(&builder, "Céleste: %s\n", string(message))
+		}
+	}
+	return builder.String()
+}
+
+// productName names a product with its price, or gives its ID when it has
+// left the catalogue.
+func (ao *AgentOrchestrator) productName(id string) string {
+	product, ok := ao.Catalog().Product(id)
+	if !ok {
+		return id
+	}
+	return fmt.Sprintf("%s (%s)", product.Name, product.PriceUsd.String())
+}
+
+// Conversation returns a copy of a shopper's conversation.
+func (ao *AgentOrchestrator) Conversation(userID string) models.Conversation {
+	userContext := ao.userContext(userID)
+
+	ao.mutex.RLock()
+	defer ao.mutex.RUnlock()
+	conversation := userContext.Conversation
+	conversation.Turns = append([]models.ConversationTurn{}, conversation.Turns...)
+	return conversation
+}
+
+// newTurn records a reply as a conversation turn.
+func newTurn(query, resolved, intent string, referenced []string, response *models.CelesteResponse) models.ConversationTurn {
+	turn := models.ConversationTurn{
+		Query:      query,
+		Intent:     intent,
+		Products:   productIDs(response.Products),
+		Referenced: referenced,
+		Message:    response.Message,
+		Agents:     response.AgentPath,
+		Timestamp:  time.Now().UTC(),
+	}
+	if resolved != query {
+		turn.Resolved = resolved
+	}
+	return turn
+}
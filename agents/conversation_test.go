@@ -0,0 +1,70 @@
+package agents
+
+import (
+	"slices"
+	"testing"
+
+	"celeste/models"
+)
+
+// testSearchAgent is a search agent over products, without embeddings or
+// intent training.
+func testSearchAgent(products []models.Product) *SearchAgent {
+	return &SearchAgent{
+		id:         "search_agent",
+		catalog:    products,
+		index:      NewSearchIndex(products),
+		classifier: NewIntentClassifier(),
+		fuzzy:      DefaultFuzzyConfig(),
+	}
+}
+
+func testProduct(id, name string, price int64, categories ...string) models.Product {
+	return models.Product{
+		ID:         id,
+		Name:       name,
+		PriceUsd:   models.Money{CurrencyCode: "USD", Units: price},
+		Categories: categories,
+		Variants:   []models.Variant{{SKU: id + "-1", Color: "black", Size: "M", Stock: 3}},
+	}
+}
+
+func TestResolveReference(t *testing.T) {
+	sa := testSearchAgent([]models.Product{
+		testProduct("s1", "Canvas Sneaker", 60, "shoes", "sneakers"),
+		testProduct("s2", "Leather Sneaker", 90, "shoes", "sneakers"),
+		testProduct("j1", "Rain Jacket", 120, "clothing", "jackets"),
+	})
+	userContext := &models.UserContext{Conversation: models.Conversation{Turns: []models.ConversationTurn{
+		{Query: "sneakers", Products: []string{"s2", "s1"}},
+	}}}
+
+	tests := []struct {
+		query      string
+		want       []string
+		referenced bool
+	}{
+		{"do those come in black?", []string{"s2", "s1"}, true},
+		{"the cheaper one", []string{"s1"}, true},
+		{"the second one", []string{"s1"}, true},
+		{"are those sneakers waterproof?", []string{"s2", "s1"}, true},
+		{"is it waterproof?", []string{"s2"}, true},
+		{"compare them", []string{"s2", "s1"}, true},
+		{"do these canvas sneakers come in black?", []string{"s2", "s1"}, true},
+		{"do you have jackets like those?", nil, false},
+		{"show me hats", nil, false},
+		// Pronouns that belong to a new search
+		{"do they sell jackets?", nil, false},
+		{"jackets that go with them", nil, false},
+		{"is it a jacket or a coat?", nil, false},
+		{"sneakers they recommend for running", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			ref, referenced := sa.resolveReference(tt.query, userContext)
+			if referenced != tt.referenced || !slices.Equal(ref.products, tt.want) {
+				t.Errorf("resolveReference = %v, %v; want %v, %v", ref.products, referenced, tt.want, tt.referenced)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"google.golang.org/genai"
+)
+
+// Embedder turns text into dense vectors for semantic matching.
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// HashingEmbedder is a local embedding model that hashes stemmed words and
+// character trigrams into a fixed-size vector. It needs no network access and
+// tolerates spelling variation better than exact term matching.
+type HashingEmbedder struct {
+	dimensions int
+}
+
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	return &HashingEmbedder{dimensions: dimensions}
+}
+
+func (he *HashingEmbedder) Name() string {
+	return fmt.Sprintf("hashing-%d", he.dimensions)
+}
+
+func (he *HashingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = he.embed(text)
+	}
+	return vectors, nil
+}
+
+func (he *HashingEmbedder) embed(text string) []float32 {
+	vector := make([]float32, he.dimensions)
+	for _, term := range analyze(text) {
+		he.addFeature(vector, "w:"+term, 1.0)
+
+		for _, gram := range trigrams(term) {
+			he.addFeature(vector, "t:"+gram, 0.5)
+		}
+	}
+	normalizeVector(vector)
+	return vector
+}
+
+func (he *HashingEmbedder) addFeature(vector []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vector[sum%uint64(he.dimensions)] += weight
+}
+
+// GeminiEmbedder computes embeddings with the Gemini embedding model.
+type GeminiEmbedder struct {
+	client *genai.Client
+	model  string
+}
+
+func NewGeminiEmbedder(client *genai.Client) *GeminiEmbedder {
+	return &GeminiEmbedder{client: client, model: "gemini-embedding-001"}
+}
+
+func (ge *GeminiEmbedder) Name() string {
+	return ge.model
+}
+
+func (ge *GeminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := embed(ctx, ge.client, ge.model, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Embeddings))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, embedding := range resp.Embeddings {
+		vectors[i] = embedding.Values
+		normalizeVector(vectors[i])
+	}
+	return vectors, nil
+}
+
+func normalizeVector(vector []float32) {
+	norm := 0.0
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+}
+
+// cosineSimilarity assumes both vectors are already L2-normalised.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	dot := 0.0
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
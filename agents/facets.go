@@ -0,0 +1,343 @@
+package agents
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"celeste/models"
+)
+
+// AvailabilitySource reports whether a product is in stock, low on stock or
+// out of stock.
+type AvailabilitySource interface {
+	Availability(product models.Product) string
+}
+
+type priceBucket struct {
+	label    string
+	min, max float64 // max of 0 means unbounded
+}
+
+var priceBuckets = []priceBucket{
+	{"0-25", 0, 25},
+	{"25-50", 25, 50},
+	{"50-100", 50, 100},
+	{"100-200", 100, 200},
+	{"200+", 200, 0},
+}
+
+var filterKeys = map[string]bool{
+	"category":     true,
+	"price":        true,
+	"min_price":    true,
+	"max_price":    true,
+	"availability": true,
+	"brand":        true,
+	"color":        true,
+	"size":         true,
+	"material":     true,
+	"min_rating":   true,
+}
+
+func validateFilters(filters map[string]string) error {
+	for key, value := range filters {
+		if !filterKeys[key] {
+			return fmt.Errorf("unknown filter %q", key)
+		}
+		switch key {
+		case "min_price", "max_price", "min_rating":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("invalid %s %q", key, value)
+			}
+		case "price":
+			if bucketByLabel(value) == nil {
+				return fmt.Errorf("unknown price bucket %q", value)
+			}
+		}
+	}
+	return nil
+}
+
+func bucketByLabel(label string) *priceBucket {
+	for i := range priceBuckets {
+		if priceBuckets[i].label == label {
+			return &priceBuckets[i]
+		}
+	}
+	return nil
+}
+
+func bucketFor(price float64) string {
+	for _, bucket := range priceBuckets {
+		if price >= bucket.min && (bucket.max == 0 || price < bucket.max) {
+			return bucket.label
+		}
+	}
+	return priceBuckets[0].label
+}
+
+// applyFilters keeps the results matching every active filter.
+func (sa *SearchAgent) applyFilters(results []models.ScoredProduct, filters map[string]string) []models.ScoredProduct {
+	if len(filters) == 0 {
+		return results
+	}
+
+	filtered := make([]models.ScoredProduct, 0, len(results))
+	for _, result := range results {
+		if sa.matchesFilters(result.Product, filters) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// matchesFilters checks a product against the filters. Size and colour
+// narrow the product to the variants having both, and price and availability
+// are then judged on those variants only.
+func (sa *SearchAgent) matchesFilters(product models.Product, filters map[string]string) bool {
+	variants := product.Variants
+	if filters["size"] != "" || filters["color"] != "" {
+		variants = matchingVariants(product, filters["size"], filters["color"])
+		if len(variants) == 0 {
+			return false
+		}
+		product.Variants = variants
+	}
+	price := lowestPrice(product, variants)
+
+	for key, value := range filters {
+		switch key {
+		case "category":
+			if !hasCategory(product, value) {
+				return false
+			}
+		case "brand":
+			if !strings.EqualFold(product.Brand, value) {
+				return false
+			}
+		case "material":
+			if !strings.EqualFold(product.Material, value) {
+				return false
+			}
+		case "min_rating":
+			if limit, _ := strconv.ParseFloat(value, 64); product.Rating < limit {
+				return false
+			}
+		case "price":
+			if bucketFor(price) != value {
+				return false
+			}
+		case "min_price":
+			if limit, _ := strconv.ParseFloat(value, 64); price < limit {
+				return false
+			}
+		case "max_price":
+			if limit, _ := strconv.ParseFloat(value, 64); price > limit {
+				return false
+			}
+		case "availability":
+			if sa.availability == nil || sa.availability.Availability(product) != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func hasCategory(product models.Product, category string) bool {
+	target := stem(strings.ToLower(category))
+	for _, c := range product.Categories {
+		if stem(strings.ToLower(c)) == target {
+			return true
+		}
+	}
+	return false
+}
+
+// computeFacets counts categories, price buckets, availability, brands,
+// materials, colours and sizes over the whole match set, not just the
+// returned page. A product counts once towards each colour and size it
+// comes in.
+func (sa *SearchAgent) computeFacets(results []models.ScoredProduct) map[string][]models.FacetValue {
+	categories := make(map[string]int)
+	prices := make(map[string]int)
+	availability := make(map[string]int)
+	attributes := map[string]map[string]int{
+		"brand":    make(map[string]int),
+		"material": make(map[string]int),
+		"color":    make(map[string]int),
+		"size":     make(map[string]int),
+	}
+
+	for _, result := range results {
+		for _, category := range result.Product.Categories {
+			categories[category]++
+		}
+		if result.Product.Brand != "" {
+			attributes["brand"][result.Product.Brand]++
+		}
+		if result.Product.Material != "" {
+			attributes["material"][result.Product.Material]++
+		}
+		for _, color := range productColors(result.Product) {
+			attributes["color"][color]++
+		}
+		for _, size := range productSizes(result.Product) {
+			attributes["size"][size]++
+		}
+		prices[bucketFor(lowestPrice(result.Product, result.Product.Variants))]++
+		if sa.availability != nil {
+			availability[sa.availability.Availability(result.Product)]++
+		}
+	}
+
+	facets := map[string][]models.FacetValue{
+		"category": sortedFacetValues(categories),
+	}
+
+	var priceValues []models.FacetValue
+	for _, bucket := range priceBuckets {
+		if count := prices[bucket.label]; count > 0 {
+			priceValues = append(priceValues, models.FacetValue{Value: bucket.label, Count: count})
+		}
+	}
+	facets["price"] = priceValues
+
+	if len(availability) > 0 {
+		facets["availability"] = sortedFacetValues(availability)
+	}
+	for name, counts := range attributes {
+		if len(counts) > 0 {
+			facets[name] = sortedFacetValues(counts)
+		}
+	}
+	return facets
+}
+
+// sortedFacetValues orders values by descending count, then alphabetically.
+func sortedFacetValues(counts map[string]int) []models.FacetValue {
+	values := make([]models.FacetValue, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, models.FacetValue{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	return values
+}
+
+var (
+	maxPricePattern     = regexp.MustCompile(`\b(?:under|below|less than|cheaper than|max(?:imum)?)\s+\$?(\d+(?:\.\d+)?)`)
+	minPricePattern     = regexp.MustCompile(`\b(?:over|above|more than|at least)\s+\$?(\d+(?:\.\d+)?)`)
+	sizePattern         = regexp.MustCompile(`\b(?:in )?(?:a )?size (\w+)\b`)
+	inStockPattern      = regexp.MustCompile(`\b(?:in stock|available now|available)\b`)
+	clearFiltersPattern = regexp.MustCompile(`\b(?:clear (?:the )?filters|show (?:me )?(?:them )?all|remove (?:the )?filters)\b`)
+)
+
+// Words that carry no meaning of their own in a refinement such as
+// "just show me the leather ones".
+var refinementFillers = map[string]bool{
+	"just": true, "only": true, "show": true, "me": true, "the": true,
+	"ones": true, "one": true, "those": true, "them": true, "please": true,
+	"in": true, "made": true, "of": true, "what": true, "about": true,
+	"and": true, "but": true, "now": true, "can": true, "you": true,
+	"i": true, "want": true, "see": true, "filter": true, "by": true,
+}
+
+// parseRefinement extracts facet filters from a query. It returns the query
+// with the filter phrases removed, the filters found, and whether the query
+// was nothing but a refinement of the previous search.
+func (sa *SearchAgent) parseRefinement(query string) (string, map[string]string, bool) {
+	text := normalizeQuery(query)
+	filters := make(map[string]string)
+
+	if clearFiltersPattern.MatchString(text) {
+		return "", nil, true
+	}
+	if match := maxPricePattern.FindStringSubmatch(text); match != nil {
+		filters["max_price"] = match[1]
+		text = strings.Replace(text, match[0], " ", 1)
+	}
+	if match := minPricePattern.FindStringSubmatch(text); match != nil {
+		filters["min_price"] = match[1]
+		text = strings.Replace(text, match[0], " ", 1)
+	}
+	if match := sizePattern.FindStringSubmatch(text); match != nil {
+		if size, ok := sa.sizeFor(match[1]); ok {
+			filters["size"] = size
+			text = strings.Replace(text, match[0], " ", 1)
+		}
+	}
+	if inStockPattern.MatchString(text) {
+		filters["availability"] = "in_stock"
+		text = inStockPattern.ReplaceAllString(text, " ")
+	}
+
+	var remaining []string
+	for _, token := range tokenize(text) {
+		if category, ok := sa.categoryFor(token); ok && refinesOnly(query) {
+			filters["category"] = category
+			continue
+		}
+		if color, ok := sa.colorFor(token); ok && refinesOnly(query) {
+			filters["color"] = color
+			continue
+		}
+		if !refinementFillers[token] {
+			remaining = append(remaining, token)
+		}
+	}
+
+	return strings.Join(remaining, " "), filters, len(filters) > 0 && len(remaining) == 0
+}
+
+// refinesOnly reports whether the query is phrased as a narrowing of the
+// previous results ("just the leather ones", "only leather").
+func refinesOnly(query string) bool {
+	text := normalizeQuery(query)
+	return strings.Contains(text, "just ") || strings.Contains(text, "only ") ||
+		strings.HasSuffix(text, " ones") || strings.HasSuffix(text, " one")
+}
+
+// categoryFor matches a word against the catalogue's categories.
+func (sa *SearchAgent) categoryFor(word string) (string, bool) {
+	target := stem(word)
+	for _, product := range sa.catalog {
+		for _, category := range product.Categories {
+			if stem(strings.ToLower(category)) == target {
+				return category, true
+			}
+		}
+	}
+	return "", false
+}
+
+// colorFor matches a word against the colours of the catalogue's variants.
+func (sa *SearchAgent) colorFor(word string) (string, bool) {
+	for _, product := range sa.catalog {
+		for _, variant := range product.Variants {
+			if variant.Color != "" && strings.EqualFold(variant.Color, word) {
+				return variant.Color, true
+			}
+		}
+	}
+	return "", false
+}
+
+// sizeFor matches a word against the sizes of the catalogue's variants.
+func (sa *SearchAgent) sizeFor(word string) (string, bool) {
+	for _, product := range sa.catalog {
+		for _, variant := range product.Variants {
+			if variant.Size != "" && strings.EqualFold(variant.Size, word) {
+				return variant.Size, true
+			}
+		}
+	}
+	return "", false
+}
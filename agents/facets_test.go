@@ -0,0 +1,201 @@
+package agents
+
+import (
+	"reflect"
+	"testing"
+
+	"celeste/models"
+)
+
+func TestValidateFilters(t *testing.T) {
+	tests := []struct {
+		filters map[string]string
+		wantErr bool
+	}{
+		{filters: nil},
+		{filters: map[string]string{"category": "boots", "price": "50-100", "min_price": "10", "max_price": "99.5", "min_rating": "4"}},
+		{filters: map[string]string{"colour": "black"}, wantErr: true},
+		{filters: map[string]string{"price": "50-75"}, wantErr: true},
+		{filters: map[string]string{"max_price": "fifty"}, wantErr: true},
+		{filters: map[string]string{"min_rating": ""}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateFilters(tt.filters); (err != nil) != tt.wantErr {
+			t.Errorf("validateFilters(%v) = %v, want error %v", tt.filters, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBucketFor(t *testing.T) {
+	tests := []struct {
+		price float64
+		want  string
+	}{
+		{0, "0-25"},
+		{24.99, "0-25"},
+		{25, "25-50"},
+		{99.99, "50-100"},
+		{100, "100-200"},
+		{200, "200+"},
+		{5000, "200+"},
+	}
+	for _, tt := range tests {
+		if got := bucketFor(tt.price); got != tt.want {
+			t.Errorf("bucketFor(%v) = %q, want %q", tt.price, got, tt.want)
+		}
+	}
+}
+
+func refinementTestAgent() *SearchAgent {
+	return testSearchAgent([]models.Product{
+		testProduct("b1", "Chelsea Boot", 120, "boots", "leather"),
+		testProduct("s1", "Canvas Sneaker", 45, "sneakers"),
+	})
+}
+
+func TestParseRefinement(t *testing.T) {
+	sa := refinementTestAgent()
+
+	tests := []struct {
+		query       string
+		wantQuery   string
+		wantFilters map[string]string
+		wantOnly    bool
+	}{
+		{"just the leather ones", "", map[string]string{"category": "leather"}, true},
+		{"only black", "", map[string]string{"color": "black"}, true},
+		{"what about in size m", "", map[string]string{"size": "M"}, true},
+		{"clear filters", "", nil, true},
+		{"show me them all", "", nil, true},
+		{"remove the filters please", "", nil, true},
+		{"sneakers under $50", "sneakers", map[string]string{"max_price": "50"}, false},
+		{"boots over 100 in stock", "boots", map[string]string{"min_price": "100", "availability": "in_stock"}, false},
+		{"cheaper than 39.99", "", map[string]string{"max_price": "39.99"}, true},
+		{"leather boots", "leather boots", map[string]string{}, false},
+		{"sneakers in size 99", "sneakers size 99", map[string]string{}, false},
+	}
+	for _, tt := range tests {
+		query, filters, only := sa.parseRefinement(tt.query)
+		if query != tt.wantQuery || !reflect.DeepEqual(filters, tt.wantFilters) || only != tt.wantOnly {
+			t.Errorf("parseRefinement(%q) = %q, %v, %v; want %q, %v, %v",
+				tt.query, query, filters, only, tt.wantQuery, tt.wantFilters, tt.wantOnly)
+		}
+	}
+}
+
+func TestResolveRefinement(t *testing.T) {
+	sa := refinementTestAgent()
+	previous := &models.UserContext{LastQuery: "boots", ActiveFilters: map[string]string{"color": "black"}}
+
+	tests := []struct {
+		name        string
+		query       string
+		explicit    map[string]string
+		context     *models.UserContext
+		wantQuery   string
+		wantFilters map[string]string
+	}{
+		{
+			name:        "narrows the previous search",
+			query:       "just the leather ones",
+			context:     previous,
+			wantQuery:   "boots",
+			wantFilters: map[string]string{"color": "black", "category": "leather"},
+		},
+		{
+			name:        "clears the previous filters",
+			query:       "clear the filters",
+			context:     previous,
+			wantQuery:   "boots",
+			wantFilters: map[string]string{},
+		},
+		{
+			name:        "new search with a price phrase",
+			query:       "sneakers under $50",
+			context:     previous,
+			wantQuery:   "sneakers",
+			wantFilters: map[string]string{"max_price": "50"},
+		},
+		{
+			name:        "explicit filters win",
+			query:       "sneakers under $50",
+			explicit:    map[string]string{"max_price": "40"},
+			wantQuery:   "sneakers",
+			wantFilters: map[string]string{"max_price": "40"},
+		},
+		{
+			name:        "refinement without a previous search",
+			query:       "just the leather ones",
+			wantQuery:   "",
+			wantFilters: map[string]string{"category": "leather"},
+		},
+		{
+			name:        "plain search",
+			query:       "leather boots",
+			context:     previous,
+			wantQuery:   "leather boots",
+			wantFilters: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		query, filters := sa.resolveRefinement(tt.query, tt.explicit, tt.context)
+		if query != tt.wantQuery || !reflect.DeepEqual(filters, tt.wantFilters) {
+			t.Errorf("%s: resolveRefinement(%q) = %q, %v; want %q, %v",
+				tt.name, tt.query, query, filters, tt.wantQuery, tt.wantFilters)
+		}
+	}
+	if want := map[string]string{"color": "black"}; !reflect.DeepEqual(previous.ActiveFilters, want) {
+		t.Errorf("resolveRefinement changed the context's filters to %v", previous.ActiveFilters)
+	}
+}
+
+type testAvailability map[string]string
+
+func (ta testAvailability) Availability(product models.Product) string {
+	return ta[product.ID]
+}
+
+func TestComputeFacets(t *testing.T) {
+	boot := testProduct("b1", "Chelsea Boot", 120, "boots", "leather")
+	boot.Brand, boot.Material = "Acme", "leather"
+	boot.Variants = []models.Variant{
+		{SKU: "b1-8", Size: "8", Color: "brown", Stock: 1},
+		{SKU: "b1-9", Size: "9", Color: "brown", Stock: 1},
+	}
+	sneaker := testProduct("s1", "Canvas Sneaker", 45, "sneakers")
+	sneaker.Brand = "Acme"
+	scarf := testProduct("x1", "Wool Scarf", 20, "scarves")
+	scarf.Material = "wool"
+	sandal := testProduct("d1", "Sandal", 210, "sandals")
+
+	sa := testSearchAgent(nil)
+	sa.availability = testAvailability{"b1": "in_stock", "s1": "in_stock", "x1": "low_stock", "d1": "out_of_stock"}
+	var results []models.ScoredProduct
+	for _, product := range []models.Product{boot, sneaker, scarf, sandal} {
+		results = append(results, models.ScoredProduct{Product: product})
+	}
+
+	facets := sa.computeFacets(results)
+	want := map[string][]models.FacetValue{
+		"category": {
+			{Value: "boots", Count: 1}, {Value: "leather", Count: 1}, {Value: "sandals", Count: 1},
+			{Value: "scarves", Count: 1}, {Value: "sneakers", Count: 1},
+		},
+		"price": {
+			{Value: "0-25", Count: 1}, {Value: "25-50", Count: 1}, {Value: "100-200", Count: 1}, {Value: "200+", Count: 1},
+		},
+		"availability": {{Value: "in_stock", Count: 2}, {Value: "low_stock", Count: 1}, {Value: "out_of_stock", Count: 1}},
+		"brand":        {{Value: "Acme", Count: 2}},
+		"material":     {{Value: "leather", Count: 1}, {Value: "wool", Count: 1}},
+		"color":        {{Value: "black", Count: 3}, {Value: "brown", Count: 1}},
+		"size":         {{Value: "M", Count: 3}, {Value: "8", Count: 1}, {Value: "9", Count: 1}},
+	}
+	if !reflect.DeepEqual(facets, want) {
+		t.Errorf("computeFacets =\n%v\nwant\n%v", facets, want)
+	}
+
+	sa.availability = nil
+	if facets := sa.computeFacets(nil); len(facets) != 2 || len(facets["category"]) != 0 || len(facets["price"]) != 0 {
+		t.Errorf("facets of no results = %v, want only empty category and price facets", facets)
+	}
+}
@@ -0,0 +1,125 @@
+package agents
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FuzzyConfig controls typo tolerance for query terms that are not in the
+// index vocabulary.
+type FuzzyConfig struct {
+	// MaxEdits caps the edit distance allowed for any term; 0 disables fuzzy matching.
+	MaxEdits int
+	// MinTermLength is the shortest term that is corrected at all.
+	MinTermLength int
+}
+
+// DefaultFuzzyConfig allows up to two edits, overridable with
+// CELESTE_FUZZY_MAX_EDITS.
+func DefaultFuzzyConfig() FuzzyConfig {
+	config := FuzzyConfig{MaxEdits: 2, MinTermLength: 4}
+	if value := os.Getenv("CELESTE_FUZZY_MAX_EDITS"); value != "" {
+		if maxEdits, err := strconv.Atoi(value); err == nil && maxEdits >= 0 {
+			config.MaxEdits = maxEdits
+		}
+	}
+	return config
+}
+
+// allowedEdits scales tolerance with term length so short words are not
+// "corrected" into unrelated ones.
+func (fc FuzzyConfig) allowedEdits(term string) int {
+	length := len([]rune(term))
+	switch {
+	case length < fc.MinTermLength:
+		return 0
+	case length < 8:
+		return min(1, fc.MaxEdits)
+	default:
+		return fc.MaxEdits
+	}
+}
+
+// editDistance is the optimal string alignment distance: insertions,
+// deletions, substitutions and adjacent transpositions each cost one.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+// trigrams returns the padded character trigrams of a term.
+func trigrams(term string) []string {
+	padded := []rune("^" + term + "$")
+	var grams []string
+	for i := 0; i+3 <= len(padded); i++ {
+		grams = append(grams, string(padded[i:i+3]))
+	}
+	return grams
+}
+
+// SynonymDictionary maps a word to related words used for query expansion.
+type SynonymDictionary map[string][]string
+
+// synonymsPath reads CELESTE_SYNONYMS_PATH, defaulting to data/synonyms.json.
+func synonymsPath() string {
+	if path := os.Getenv("CELESTE_SYNONYMS_PATH"); path != "" {
+		return path
+	}
+	return "data/synonyms.json"
+}
+
+func LoadSynonyms(path string) (SynonymDictionary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Synonyms map[string][]string `json:"synonyms"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	dictionary := make(SynonymDictionary, len(file.Synonyms))
+	for word, related := range file.Synonyms {
+		dictionary[strings.ToLower(word)] = related
+	}
+	return dictionary, nil
+}
+
+// Lookup finds synonyms for a word or its stem.
+func (sd SynonymDictionary) Lookup(word string) []string {
+	if related, ok := sd[word]; ok {
+		return related
+	}
+	for key, related := range sd {
+		if stem(key) == stem(word) {
+			return related
+		}
+	}
+	return nil
+}
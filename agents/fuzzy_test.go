@@ -0,0 +1,115 @@
+package agents
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"celeste/models"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"boot", "boot", 0},
+		{"bot", "boot", 1},
+		{"boots", "boot", 1},
+		{"boat", "boot", 1},
+		{"sneaekr", "sneaker", 1}, // adjacent transposition
+		{"lether", "leather", 1},
+		{"jaket", "jacket", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"café", "cafe", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedEdits(t *testing.T) {
+	config := FuzzyConfig{MaxEdits: 2, MinTermLength: 4}
+	tests := []struct {
+		term string
+		want int
+	}{
+		{"hat", 0},
+		{"boot", 1},
+		{"sneaker", 1},
+		{"trousers", 2},
+	}
+	for _, tt := range tests {
+		if got := config.allowedEdits(tt.term); got != tt.want {
+			t.Errorf("allowedEdits(%q) = %d, want %d", tt.term, got, tt.want)
+		}
+	}
+	if got := (FuzzyConfig{MaxEdits: 0, MinTermLength: 4}).allowedEdits("trousers"); got != 0 {
+		t.Errorf("allowedEdits with fuzzy matching off = %d, want 0", got)
+	}
+}
+
+func TestExpandQueryCorrectsTypos(t *testing.T) {
+	sa := testSearchAgent([]models.Product{
+		testProduct("b1", "Leather Boot", 120, "boots"),
+		testProduct("t1", "Linen Trousers", 70, "trousers"),
+		testProduct("h1", "Sun Hat", 30, "hats"),
+		testProduct("c1", "Cashmere Cardigan", 150, "knitwear"),
+	})
+
+	tests := []struct {
+		query     string
+		terms     []QueryTerm
+		corrected string
+	}{
+		{"leather boots", []QueryTerm{{"leather", 1}, {"boot", 1}}, ""},
+		{"lether boots", []QueryTerm{{"leather", 1 - fuzzyEditPenalty}, {"boot", 1}}, "leather boots"},
+		{"linen trusers", []QueryTerm{{"linen", 1}, {"trouser", 1 - fuzzyEditPenalty}}, "linen trousers"},
+		{"lnen trosers", []QueryTerm{{"linen", 1 - fuzzyEditPenalty}, {"trouser", 1 - fuzzyEditPenalty}}, "linen trousers"},
+		// Longer words may be two edits out
+		{"cardgain", []QueryTerm{{"cardigan", 1 - 2*fuzzyEditPenalty}}, "cardigan"},
+		// Too short to correct, and too far from anything indexed
+		{"hta", []QueryTerm{{"hta", 1}}, ""},
+		{"umbrella", []QueryTerm{{"umbrella", 1}}, ""},
+	}
+	for _, tt := range tests {
+		terms, corrected := sa.expandQuery(tt.query)
+		if corrected != tt.corrected || len(terms) != len(tt.terms) {
+			t.Errorf("expandQuery(%q) = %v, %q; want %v, %q", tt.query, terms, corrected, tt.terms, tt.corrected)
+			continue
+		}
+		for i, term := range terms {
+			if term.Term != tt.terms[i].Term || math.Abs(term.Weight-tt.terms[i].Weight) > 1e-9 {
+				t.Errorf("expandQuery(%q) = %v, want %v", tt.query, terms, tt.terms)
+				break
+			}
+		}
+	}
+}
+
+func TestSynonymsPath(t *testing.T) {
+	t.Setenv("CELESTE_SYNONYMS_PATH", "")
+	if path := synonymsPath(); path != "data/synonyms.json" {
+		t.Errorf("default synonymsPath() = %q", path)
+	}
+
+	path := filepath.Join(t.TempDir(), "synonyms.json")
+	if err := os.WriteFile(path, []byte(`{"synonyms": {"sneakers": ["trainers"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CELESTE_SYNONYMS_PATH", path)
+	if got := synonymsPath(); got != path {
+		t.Fatalf("synonymsPath() = %q, want %q", got, path)
+	}
+	synonyms, err := LoadSynonyms(synonymsPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(synonyms) == 0 {
+		t.Errorf("LoadSynonyms(%q) loaded nothing", path)
+	}
+}
@@ -0,0 +1,244 @@
+package agents
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var intentLabels = []string{
+	"product_search",
+	"style_advice",
+	"price_inquiry",
+	"size_help",
+	"occasion_shopping",
+	"comparison",
+	"general_help",
+}
+
+const (
+	defaultIntent = "product_search"
+	// Weight given to a matching keyword rule relative to the Bayes posterior.
+	intentRuleBoost = 1.5
+)
+
+type intentRule struct {
+	intent  string
+	pattern *regexp.Regexp
+}
+
+var intentRules = []intentRule{
+	{"comparison", regexp.MustCompile(`\b(compare|comparison|versus|vs\.?|difference between|side by side|which is better)\b`)},
+	{"size_help", regexp.MustCompile(`\b(size|sizes|sizing|fit|fits|fitting|run small|run large|runs small|runs large|(us|uk|eu) \d+|wear a (small|medium|large)|measurements|(chest|waist|bust|foot) is \d+)\b`)},
+	{"price_inquiry", regexp.MustCompile(`\b(price|prices|cost|costs|how much|cheap|cheaper|expensive|deal|deals|discount|discounts|sale|under \$?\d+)\b`)},
+	{"occasion_shopping", regexp.MustCompile(`\b(wedding|party|interview|holiday|vacation|birthday|gift|formal dinner|office|date night)\b`)},
+	{"style_advice", regexp.MustCompile(`\b(style|styling|goes with|go with|match|matches|outfit ideas|outfit|outfits|complete the look|complete my look|look good|fashion tips|suit me)\b`)},
+	{"general_help", regexp.MustCompile(`^(hi|hello|hey|thanks|thank you)\b|\b(return|returns|refund|delivery|shipping|order status|where is my order)\b`)},
+}
+
+// IntentPrediction is the outcome of classifying a query.
+type IntentPrediction struct {
+	Intent     string             `json:"intent"`
+	Confidence float64            `json:"confidence"`
+	Source     string             `json:"source"`
+	Scores     map[string]float64 `json:"scores,omitempty"`
+}
+
+// IntentClassifier is a local keyword and naive Bayes classifier used to
+// pre-classify queries and as a fallback when the LLM is unavailable.
+type IntentClassifier struct {
+	rules      []intentRule
+	docCounts  map[string]int
+	wordCounts map[string]map[string]int
+	totalWords map[string]int
+	vocabulary map[string]bool
+	totalDocs  int
+}
+
+func NewIntentClassifier() *IntentClassifier {
+	return &IntentClassifier{
+		rules:      intentRules,
+		docCounts:  make(map[string]int),
+		wordCounts: make(map[string]map[string]int),
+		totalWords: make(map[string]int),
+		vocabulary: make(map[string]bool),
+	}
+}
+
+// intentTrainingPath reads CELESTE_INTENT_TRAINING_PATH, defaulting to
+// data/intentTraining.json.
+func intentTrainingPath() string {
+	if path := os.Getenv("CELESTE_INTENT_TRAINING_PATH"); path != "" {
+		return path
+	}
+	return "data/intentTraining.json"
+}
+
+// LoadTrainingData trains the Bayes model from a labelled JSON file.
+func (ic *IntentClassifier) LoadTrainingData(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var training struct {
+		Examples []struct {
+			Text   string `json:"text"`
+			Intent string `json:"intent"`
+		} `json:"examples"`
+	}
+	if err := json.Unmarshal(data, &training); err != nil {
+		return err
+	}
+
+	for _, example := range training.Examples {
+		if isValidIntent(example.Intent) {
+			ic.Train(example.Text, example.Intent)
+		}
+	}
+	return nil
+}
+
+func (ic *IntentClassifier) Train(text, intent string) {
+	ic.docCounts[intent]++
+	ic.totalDocs++
+
+	if ic.wordCounts[intent] == nil {
+		ic.wordCounts[intent] = make(map[string]int)
+	}
+	for _, word := range tokenize(text) {
+		ic.wordCounts[intent][word]++
+		ic.totalWords[intent]++
+		ic.vocabulary[word] = true
+	}
+}
+
+func (ic *IntentClassifier) Classify(query string) IntentPrediction {
+	scores := ic.bayesPosterior(query)
+	normalized := normalizeQuery(query)
+
+	for _, rule := range ic.rules {
+		if rule.pattern.MatchString(normalized) {
+			scores[rule.intent] += intentRuleBoost
+		}
+	}
+
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+	for intent := range scores {
+		scores[intent] /= total
+	}
+
+	best := defaultIntent
+	for _, intent := range intentLabels {
+		if scores[intent] > scores[best] {
+			best = intent
+		}
+	}
+
+	return IntentPrediction{
+		Intent:     best,
+		Confidence: scores[best],
+		Source:     "local",
+		Scores:     scores,
+	}
+}
+
+// bayesPosterior returns P(intent|query) with Laplace smoothing. An untrained
+// model yields a uniform distribution so the keyword rules decide alone.
+func (ic *IntentClassifier) bayesPosterior(query string) map[string]float64 {
+	posterior := make(map[string]float64, len(intentLabels))
+	if ic.totalDocs == 0 {
+		for _, intent := range intentLabels {
+			posterior[intent] = 1.0 / float64(len(intentLabels))
+		}
+		return posterior
+	}
+
+	words := tokenize(query)
+	vocabSize := float64(len(ic.vocabulary))
+	logProbs := make(map[string]float64, len(intentLabels))
+	maxLog := math.Inf(-1)
+
+	for _, intent := range intentLabels {
+		logProb := math.Log(float64(ic.docCounts[intent]+1) / float64(ic.totalDocs+len(intentLabels)))
+		for _, word := range words {
+			if !ic.vocabulary[word] {
+				continue
+			}
+			count := float64(ic.wordCounts[intent][word])
+			logProb += math.Log((count + 1) / (float64(ic.totalWords[intent]) + vocabSize))
+		}
+		logProbs[intent] = logProb
+		maxLog = math.Max(maxLog, logProb)
+	}
+
+	sum := 0.0
+	for intent, logProb := range logProbs {
+		posterior[intent] = math.Exp(logProb - maxLog)
+		sum += posterior[intent]
+	}
+	for intent := range posterior {
+		posterior[intent] /= sum
+	}
+	return posterior
+}
+
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+func normalizeQuery(query string) string {
+	return whitespacePattern.ReplaceAllString(strings.ToLower(strings.TrimSpace(query)), " ")
+}
+
+func isValidIntent(intent string) bool {
+	for _, label := range intentLabels {
+		if label == intent {
+			return true
+		}
+	}
+	return false
+}
+
+// IntentMetrics compares the local classifier against the LLM.
+type IntentMetrics struct {
+	Classified    int                       `json:"classified"`
+	PreClassified int                       `json:"pre_classified"`
+	LLMCalls      int                       `json:"llm_calls"`
+	LLMFailures   int                       `json:"llm_failures"`
+	Compared      int                       `json:"compared"`
+	Agreements    int                       `json:"agreements"`
+	AgreementRate float64                   `json:"agreement_rate"`
+	Confusion     map[string]map[string]int `json:"confusion"`
+}
+
+func (m *IntentMetrics) recordComparison(llmIntent, localIntent string) {
+	m.Compared++
+	if llmIntent == localIntent {
+		m.Agreements++
+	}
+	m.AgreementRate = float64(m.Agreements) / float64(m.Compared)
+
+	if m.Confusion == nil {
+		m.Confusion = make(map[string]map[string]int)
+	}
+	if m.Confusion[llmIntent] == nil {
+		m.Confusion[llmIntent] = make(map[string]int)
+	}
+	m.Confusion[llmIntent][localIntent]++
+}
+
+func (m IntentMetrics) snapshot() IntentMetrics {
+	confusion := make(map[string]map[string]int, len(m.Confusion))
+	for llmIntent, row := range m.Confusion {
+		confusion[llmIntent] = make(map[string]int, len(row))
+		for localIntent, count := range row {
+			confusion[llmIntent][localIntent] = count
+		}
+	}
+	m.Confusion = confusion
+	return m
+}
@@ -0,0 +1,204 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// testGeminiClient is a Gemini client whose API is reply, and a count of
+// the requests it made.
+func testGeminiClient(t *testing.T, reply http.HandlerFunc) (*genai.Client, *int) {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		reply(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &calls
+}
+
+// replyText answers every generation request with text.
+func replyText(text string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"candidates": [{"content": {"role": "model", "parts": [{"text": %q}]}}]}`, text)
+	}
+}
+
+func TestClassifyRules(t *testing.T) {
+	classifier := NewIntentClassifier()
+	tests := []struct {
+		query  string
+		intent string
+	}{
+		{"Compare the boots VS the sneakers", "comparison"},
+		{"does this run small?", "size_help"},
+		{"anything under $50", "price_inquiry"},
+		{"something for a wedding", "occasion_shopping"},
+		{"what goes with these trousers", "style_advice"},
+		{"hi there", "general_help"},
+		{"where is my order", "general_help"},
+		{"blue", defaultIntent},
+	}
+	for _, tt := range tests {
+		prediction := classifier.Classify(tt.query)
+		if prediction.Intent != tt.intent || prediction.Source != "local" {
+			t.Errorf("Classify(%q) = %s from %s, want %s", tt.query, prediction.Intent, prediction.Source, tt.intent)
+		}
+	}
+
+	// Untrained, the posterior is uniform and one rule adds its boost
+	prediction := classifier.Classify("compare these")
+	uniform := 1 / float64(len(intentLabels))
+	if want := (uniform + intentRuleBoost) / (1 + intentRuleBoost); math.Abs(prediction.Confidence-want) > 1e-9 {
+		t.Errorf("confidence = %v, want %v", prediction.Confidence, want)
+	}
+	total := 0.0
+	for _, score := range prediction.Scores {
+		total += score
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("scores sum to %v, want 1", total)
+	}
+	if prediction := classifier.Classify("blue"); math.Abs(prediction.Confidence-uniform) > 1e-9 {
+		t.Errorf("confidence without a rule = %v, want %v", prediction.Confidence, uniform)
+	}
+}
+
+func TestBayesPosterior(t *testing.T) {
+	classifier := NewIntentClassifier()
+	classifier.Train("show me leather boots", "product_search")
+	classifier.Train("find black boots", "product_search")
+	classifier.Train("what should I wear to a wedding", "occasion_shopping")
+
+	// Words never seen in training leave the smoothed prior: (docs + 1) /
+	// (total docs + intents)
+	prior := classifier.bayesPosterior("zzz")
+	for intent, want := range map[string]float64{"product_search": 0.3, "occasion_shopping": 0.2, "comparison": 0.1} {
+		if math.Abs(prior[intent]-want) > 1e-9 {
+			t.Errorf("prior %s = %v, want %v", intent, prior[intent], want)
+		}
+	}
+
+	posterior := classifier.bayesPosterior("wedding")
+	if posterior["occasion_shopping"] <= posterior["product_search"] || posterior["occasion_shopping"] <= prior["occasion_shopping"] {
+		t.Errorf("posterior %v does not favour occasion_shopping for wedding", posterior)
+	}
+	if posterior := classifier.bayesPosterior("boots"); posterior["product_search"] <= prior["product_search"] {
+		t.Errorf("posterior %v does not favour product_search for boots", posterior)
+	}
+
+	// The rule boost outweighs a posterior that leans the other way
+	if prediction := classifier.Classify("boots vs sneakers"); prediction.Intent != "comparison" {
+		t.Errorf("Classify(boots vs sneakers) = %+v, want comparison", prediction)
+	}
+}
+
+func TestClassifyIntent(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		reply  http.HandlerFunc
+		intent string
+		source string
+		calls  int
+		want   IntentMetrics
+	}{
+		{
+			name: "confident local prediction", query: "which is better, the boots or the sneakers", reply: replyText("comparison"),
+			intent: "comparison", source: "local", calls: 0,
+			want: IntentMetrics{Classified: 1, PreClassified: 1},
+		},
+		{
+			name: "LLM decides", query: "blue", reply: replyText("Style_Advice."),
+			intent: "style_advice", source: "llm", calls: 1,
+			want: IntentMetrics{Classified: 1, LLMCalls: 1, Compared: 1},
+		},
+		{
+			name: "LLM agrees", query: "blue", reply: replyText("product_search"),
+			intent: "product_search", source: "llm", calls: 1,
+			want: IntentMetrics{Classified: 1, LLMCalls: 1, Compared: 1, Agreements: 1, AgreementRate: 1},
+		},
+		{
+			name: "unknown classification", query: "blue", reply: replyText("banana"),
+			intent: defaultIntent, source: "local", calls: 1,
+			want: IntentMetrics{Classified: 1, LLMCalls: 1, LLMFailures: 1},
+		},
+		{
+			name: "LLM unavailable", query: "blue",
+			reply: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error": {"code": 400}}`, http.StatusBadRequest)
+			},
+			intent: defaultIntent, source: "local", calls: 1,
+			want: IntentMetrics{Classified: 1, LLMCalls: 1, LLMFailures: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := testSearchAgent(nil)
+			if err := sa.classifier.LoadTrainingData("../data/intentTraining.json"); err != nil {
+				t.Fatal(err)
+			}
+			client, calls := testGeminiClient(t, tt.reply)
+			sa.geminiClient = client
+
+			prediction := sa.classifyIntent(context.Background(), tt.query)
+			if prediction.Intent != tt.intent || prediction.Source != tt.source {
+				t.Errorf("prediction = %s from %s, want %s from %s", prediction.Intent, prediction.Source, tt.intent, tt.source)
+			}
+			if *calls != tt.calls {
+				t.Errorf("LLM called %d times, want %d", *calls, tt.calls)
+			}
+			metrics := sa.IntentMetrics()
+			if metrics.Classified != tt.want.Classified || metrics.PreClassified != tt.want.PreClassified ||
+				metrics.LLMCalls != tt.want.LLMCalls || metrics.LLMFailures != tt.want.LLMFailures ||
+				metrics.Compared != tt.want.Compared || metrics.Agreements != tt.want.Agreements ||
+				metrics.AgreementRate != tt.want.AgreementRate {
+				t.Errorf("metrics = %+v, want %+v", metrics, tt.want)
+			}
+			if tt.want.Compared > 0 && metrics.Confusion[tt.intent][defaultIntent] != 1 {
+				t.Errorf("confusion = %v, want %s against %s", metrics.Confusion, tt.intent, defaultIntent)
+			}
+		})
+	}
+}
+
+func TestIntentTrainingPath(t *testing.T) {
+	t.Setenv("CELESTE_INTENT_TRAINING_PATH", "")
+	if path := intentTrainingPath(); path != "data/intentTraining.json" {
+		t.Errorf("default intentTrainingPath() = %q", path)
+	}
+
+	path := filepath.Join(t.TempDir(), "training.json")
+	training := `{"examples": [{"text": "what size should I get", "intent": "size_help"}]}`
+	if err := os.WriteFile(path, []byte(training), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CELESTE_INTENT_TRAINING_PATH", path)
+
+	classifier := NewIntentClassifier()
+	if err := classifier.LoadTrainingData(intentTrainingPath()); err != nil {
+		t.Fatal(err)
+	}
+	if classifier.docCounts["size_help"] != 1 {
+		t.Errorf("docCounts = %v, want one size_help example", classifier.docCounts)
+	}
+}
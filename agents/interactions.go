@@ -0,0 +1,175 @@
+package agents
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"celeste/catalog"
+	"celeste/models"
+)
+
+// Interaction types, from weakest to strongest signal of interest.
+const (
+	InteractionView     = "view"
+	InteractionCartAdd  = "cart_add"
+	InteractionPurchase = "purchase"
+)
+
+var interactionWeights = map[string]float64{
+	InteractionView:     1,
+	InteractionCartAdd:  3,
+	InteractionPurchase: 5,
+}
+
+var ErrInvalidInteraction = errors.New("invalid interaction")
+
+// InteractionsPath reads CELESTE_INTERACTIONS_PATH, defaulting to
+// data/interactions.jsonl.
+func InteractionsPath() string {
+	if path := os.Getenv("CELESTE_INTERACTIONS_PATH"); path != "" {
+		return path
+	}
+	return "data/interactions.jsonl"
+}
+
+// InteractionLog records interactions in memory and appends each one as a
+// JSON line to its file.
+type InteractionLog struct {
+	path         string
+	interactions []models.Interaction
+	mutex        sync.RWMutex
+}
+
+// NewInteractionLog loads the log from path, skipping lines that do not
+// parse. An empty path keeps the log in memory only.
+func NewInteractionLog(path string) *InteractionLog {
+	interactionLog := &InteractionLog{path: path}
+	if path == "" {
+		return interactionLog
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return interactionLog
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	skipped := 0
+	for scanner.Scan() {
+		var interaction models.Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil || validateInteraction(interaction) != nil {
+			skipped++
+			continue
+		}
+		interactionLog.interactions = append(interactionLog.interactions, interaction)
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d unreadable lines in %s", skipped, path)
+	}
+	return interactionLog
+}
+
+func validateInteraction(interaction models.Interaction) error {
+	if interaction.UserID == "" || interaction.ProductID == "" {
+		return fmt.Errorf("%w: user and product are required", ErrInvalidInteraction)
+	}
+	if _, ok := interactionWeights[interaction.Type]; !ok {
+		return fmt.Errorf("%w: type must be view, cart_add or purchase", ErrInvalidInteraction)
+	}
+	return nil
+}
+
+func (il *InteractionLog) Record(interaction models.Interaction) (models.Interaction, error) {
+	if err := validateInteraction(interaction); err != nil {
+		return interaction, err
+	}
+	if interaction.Timestamp.IsZero() {
+		interaction.Timestamp = time.Now().UTC()
+	}
+
+	il.mutex.Lock()
+	defer il.mutex.Unlock()
+	if il.path != "" {
+		line, err := json.Marshal(interaction)
+		if err != nil {
+			return interaction, err
+		}
+		file, err := os.OpenFile(il.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return interaction, err
+		}
+		_, err = file.Write(append(line, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return interaction, err
+		}
+	}
+	il.interactions = append(il.interactions, interaction)
+	return interaction, nil
+}
+
+// All returns a copy of every interaction, oldest first.
+func (il *InteractionLog) All() []models.Interaction {
+	il.mutex.RLock()
+	defer il.mutex.RUnlock()
+	return append([]models.Interaction(nil), il.interactions...)
+}
+
+func (il *InteractionLog) Len() int {
+	il.mutex.RLock()
+	defer il.mutex.RUnlock()
+	return len(il.interactions)
+}
+
+// RecordInteraction logs a shopper's interaction with a product, learns
+// from it and keeps their cart in step: a cart add puts the product in it
+// and a purchase takes it out.
+func (ao *AgentOrchestrator) RecordInteraction(userID, productID, interactionType string) (models.Interaction, error) {
+	product, ok := ao.Catalog().Product(productID)
+	if !ok {
+		return models.Interaction{}, catalog.ErrNotFound
+	}
+	recommendationAgent, ok := ao.agents["recommendation_agent"].(*RecommendationAgent)
+	if !ok {
+		return models.Interaction{}, fmt.Errorf("recommendation agent not registered")
+	}
+
+	interaction, err := recommendationAgent.RecordInteraction(models.Interaction{
+		UserID:    userID,
+		ProductID: productID,
+		Type:      interactionType,
+	})
+	if err != nil {
+		return interaction, err
+	}
+
+	userContext := ao.userContext(userID)
+	ao.learnFromInteraction(userContext, product, interactionType)
+
+	ao.mutex.Lock()
+	defer ao.mutex.Unlock()
+	switch interactionType {
+	case InteractionCartAdd:
+		if !contains(userContext.CartItems, productID) {
+			userContext.CartItems = append(userContext.CartItems, productID)
+		}
+	case InteractionPurchase:
+		cart := userContext.CartItems[:0]
+		for _, id := range userContext.CartItems {
+			if id != productID {
+				cart = append(cart, id)
+			}
+		}
+		userContext.CartItems = cart
+	}
+	return interaction, nil
+}
@@ -4,21 +4,28 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 
 	"celeste/models"
 	"google.golang.org/genai"
 )
 
+const lowStockThreshold = 10
+
 type InventoryAgent struct {
 	id           string
 	geminiClient *genai.Client
+	stock        map[string]int
+	mutex        sync.Mutex
 }
 
 func NewInventoryAgent(geminiClient *genai.Client) *InventoryAgent {
 	return &InventoryAgent{
 		id:           "inventory_agent",
 		geminiClient: geminiClient,
+		stock:        make(map[string]int),
 	}
 }
 
@@ -38,6 +45,12 @@ func (ia *InventoryAgent) Process(ctx context.Context, input models.AgentMessage
 
 	inventoryStatus := ia.simulateInventoryCheck(products)
 	recommendations := ia.generateInventoryRecommendations(inventoryStatus)
+	reasons := make(map[string][]models.Reason)
+	for _, product := range products {
+		if productReasons := ia.StockReasons(product); len(productReasons) > 0 {
+			reasons[product.ID] = productReasons
+		}
+	}
 
 	return &models.AgentResponse{
 		ID:        input.ID,
@@ -46,6 +59,7 @@ func (ia *InventoryAgent) Process(ctx context.Context, input models.AgentMessage
 		Data: map[string]interface{}{
 			"inventory_status": inventoryStatus,
 			"recommendations":  recommendations,
+			"reasons":          reasons,
 			"checked_at":       time.Now().Format(time.RFC3339),
 		},
 		NextActions: []string{"generate_recommendations", "update_user_context"},
@@ -55,23 +69,108 @@ func (ia *InventoryAgent) Process(ctx context.Context, input models.AgentMessage
 
 func (ia *InventoryAgent) simulateInventoryCheck(products []models.Product) map[string]interface{} {
 	status := make(map[string]interface{})
-	rand.Seed(time.Now().UnixNano())
 
 	for _, product := range products {
-		stockLevel := rand.Intn(50) + 1
+		stockLevel := ia.stockLevel(product)
 		demand := []string{"low", "medium", "high"}[rand.Intn(3)]
 
-		status[product.ID] = map[string]interface{}{
-			"stock_level": stockLevel,
-			"demand":      demand,
-			"trending":    stockLevel < 10,
-			"seasonal":    ia.isSeasonalItem(product),
+		productStatus := map[string]interface{}{
+			"stock_level":  stockLevel,
+			"availability": availabilityFor(stockLevel),
+			"demand":       demand,
+			"trending":     stockLevel < lowStockThreshold,
+			"seasonal":     ia.isSeasonalItem(product),
 		}
+		if len(product.Variants) > 0 {
+			productStatus["variants"] = variantStatus(product)
+		}
+		status[product.ID] = productStatus
 	}
 
 	return status
 }
 
+// variantStatus reports stock per SKU from the catalogue's variant stock.
+func variantStatus(product models.Product) map[string]interface{} {
+	status := make(map[string]interface{}, len(product.Variants))
+	for _, variant := range product.Variants {
+		status[variant.SKU] = map[string]interface{}{
+			"size":         variant.Size,
+			"color":        variant.Color,
+			"stock_level":  variant.Stock,
+			"availability": availabilityFor(variant.Stock),
+		}
+	}
+	return status
+}
+
+// stockLevel is the total stock across a product's variants. Products
+// without variants get a simulated level the first time they are seen,
+// kept stable afterwards so availability is consistent between requests.
+func (ia *InventoryAgent) stockLevel(product models.Product) int {
+	if len(product.Variants) > 0 {
+		total := 0
+		for _, variant := range product.Variants {
+			total += variant.Stock
+		}
+		return total
+	}
+
+	ia.mutex.Lock()
+	defer ia.mutex.Unlock()
+
+	level, ok := ia.stock[product.ID]
+	if !ok {
+		level = rand.Intn(50) + 1
+		ia.stock[product.ID] = level
+	}
+	return level
+}
+
+func (ia *InventoryAgent) Availability(product models.Product) string {
+	return availabilityFor(ia.stockLevel(product))
+}
+
+// StockReasons explains a product's stock when it is worth acting on: the
+// product is out of stock or nearly gone, or some of its sizes are.
+func (ia *InventoryAgent) StockReasons(product models.Product) []models.Reason {
+	stockLevel := ia.stockLevel(product)
+	switch availabilityFor(stockLevel) {
+	case "out_of_stock":
+		return []models.Reason{{Code: ReasonOutOfStock, Message: "Out of stock"}}
+	case "low_stock":
+		return []models.Reason{{Code: ReasonLowStock, Message: fmt.Sprintf("Only %d left", stockLevel)}}
+	}
+
+	var lowSizes []string
+	for _, size := range productSizes(product) {
+		for _, variant := range matchingVariants(product, size, "") {
+			if availabilityFor(variant.Stock) == "low_stock" {
+				lowSizes = append(lowSizes, size)
+				break
+			}
+		}
+	}
+	switch len(lowSizes) {
+	case 0:
+		return nil
+	case 1:
+		return []models.Reason{{Code: ReasonLowStock, Message: fmt.Sprintf("Low stock in size %s", lowSizes[0])}}
+	}
+	return []models.Reason{{Code: ReasonLowStock, Message: fmt.Sprintf("Low stock in sizes %s", strings.Join(lowSizes, ", "))}}
+}
+
+func availabilityFor(stockLevel int) string {
+	switch {
+	case stockLevel <= 0:
+		return "out_of_stock"
+	case stockLevel < lowStockThreshold:
+		return "low_stock"
+	default:
+		return "in_stock"
+	}
+}
+
 func (ia *InventoryAgent) isSeasonalItem(product models.Product) bool {
 	seasonalKeywords := []string{"summer", "winter", "spring", "fall", "holiday"}
 	for _, keyword := range seasonalKeywords {
@@ -87,12 +186,19 @@ func (ia *InventoryAgent) generateInventoryRecommendations(status map[string]int
 
 	for productID, info := range status {
 		if infoMap, ok := info.(map[string]interface{}); ok {
-			if stockLevel, ok := infoMap["stock_level"].(int); ok && stockLevel < 10 {
+			if stockLevel, ok := infoMap["stock_level"].(int); ok && stockLevel < lowStockThreshold {
 				recommendations = append(recommendations, fmt.Sprintf("Low stock alert for %s", productID))
 			}
 			if trending, ok := infoMap["trending"].(bool); ok && trending {
 				recommendations = append(recommendations, fmt.Sprintf("Trending item: %s", productID))
 			}
+			variants, _ := infoMap["variants"].(map[string]interface{})
+			for sku, variant := range variants {
+				variantMap, _ := variant.(map[string]interface{})
+				if variantMap["availability"] == "low_stock" {
+					recommendations = append(recommendations, fmt.Sprintf("Low stock alert for %s variant %s", productID, sku))
+				}
+			}
 		}
 	}
 
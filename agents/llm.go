@@ -0,0 +1,50 @@
+package agents
+
+import (
+	"context"
+	"math"
+
+	"celeste/ratelimit"
+	"google.golang.org/genai"
+)
+
+// generate asks the LLM to respond to prompt, charging the tokens used to
+// the quota of the request behind ctx.
+func generate(ctx context.Context, client *genai.Client, prompt string) (*genai.GenerateContentResponse, error) {
+	resp, err := client.Models.GenerateContent(ctx, "gemini-2.5-flash", genai.Text(prompt), nil)
+	if err == nil && resp.UsageMetadata != nil {
+		ratelimit.ChargeTokens(ctx, int(resp.UsageMetadata.TotalTokenCount))
+	}
+	return resp, err
+}
+
+// Rough size of a token, for when the API does not say how many it used.
+const charactersPerToken = 4
+
+// embed embeds texts with model, charging the tokens embedded to the quota
+// of the request behind ctx. Only Vertex reports how many those were, so
+// otherwise they are estimated from the texts' length.
+func embed(ctx context.Context, client *genai.Client, model string, texts []string) (*genai.EmbedContentResponse, error) {
+	contents := make([]*genai.Content, len(texts))
+	for i, text := range texts {
+		contents[i] = genai.NewContentFromText(text, genai.RoleUser)
+	}
+
+	resp, err := client.Models.EmbedContent(ctx, model, contents, nil)
+	if err == nil {
+		ratelimit.ChargeTokens(ctx, embeddingTokens(resp, texts))
+	}
+	return resp, err
+}
+
+func embeddingTokens(resp *genai.EmbedContentResponse, texts []string) int {
+	tokens := 0
+	for i, text := range texts {
+		if i < len(resp.Embeddings) && resp.Embeddings[i] != nil && resp.Embeddings[i].Statistics != nil && resp.Embeddings[i].Statistics.TokenCount > 0 {
+			tokens += int(resp.Embeddings[i].Statistics.TokenCount)
+		} else {
+			tokens += int(math.Ceil(float64(len(text)) / charactersPerToken))
+		}
+	}
+	return tokens
+}
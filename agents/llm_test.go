@@ -0,0 +1,23 @@
+package agents
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestEmbeddingTokens(t *testing.T) {
+	texts := []string{"red leather boots", "hat"}
+	estimated := &genai.EmbedContentResponse{Embeddings: []*genai.ContentEmbedding{{}, {}}}
+	if tokens := embeddingTokens(estimated, texts); tokens != 5+1 {
+		t.Errorf("estimated %d tokens, want 6", tokens)
+	}
+
+	reported := &genai.EmbedContentResponse{Embeddings: []*genai.ContentEmbedding{
+		{Statistics: &genai.ContentEmbeddingStatistics{TokenCount: 3}},
+		{Statistics: &genai.ContentEmbeddingStatistics{TokenCount: 1}},
+	}}
+	if tokens := embeddingTokens(reported, texts); tokens != 4 {
+		t.Errorf("counted %d tokens, want 4", tokens)
+	}
+}
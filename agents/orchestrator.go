@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
+	"celeste/catalog"
+	"celeste/currency"
 	"celeste/models"
 	"google.golang.org/genai"
 )
@@ -16,6 +19,11 @@ type AgentOrchestrator struct {
 	agents       map[string]models.Agent
 	messageBus   chan models.AgentMessage
 	contextStore map[string]*models.UserContext
+	converter    *currency.Converter // nil when no rate table could be loaded
+	alerts       *PriceAlertStore
+	alertCheck   chan struct{}
+	rankingLog   *RankingLog // nil until Initialize
+	sessionStore *SessionStore
 	mutex        sync.RWMutex
 }
 
@@ -25,6 +33,9 @@ func NewAgentOrchestrator(geminiClient *genai.Client) *AgentOrchestrator {
 		agents:       make(map[string]models.Agent),
 		messageBus:   make(chan models.AgentMessage, 100),
 		contextStore: make(map[string]*models.UserContext),
+		alerts:       NewPriceAlertStore(""),
+		alertCheck:   make(chan struct{}, 1),
+		sessionStore: NewSessionStore(defaultSessionTTL, defaultMaxSessions),
 	}
 }
 
@@ -44,9 +55,28 @@ func (ao *AgentOrchestrator) RegisterAgent(agent models.Agent) error {
 func (ao *AgentOrchestrator) Initialize() error {
 	inventoryAgent := NewInventoryAgent(ao.geminiClient)
 	searchAgent := NewSearchAgent(ao.geminiClient)
-	recommendationAgent := NewRecommendationAgent(ao.geminiClient)
+	recommendationAgent := NewRecommendationAgent(ao.geminiClient, searchAgent)
+	pricingAgent := NewPricingAgent(ao.geminiClient)
+	comparisonAgent := NewComparisonAgent(ao.geminiClient, searchAgent)
+	stylistAgent := NewStylistAgent(ao.geminiClient, searchAgent)
+	sizeAgent := NewSizeAgent(ao.geminiClient, searchAgent)
+
+	searchAgent.SetAvailabilitySource(inventoryAgent)
+	comparisonAgent.SetAvailabilitySource(inventoryAgent)
+	recommendationAgent.SetStockReasonSource(inventoryAgent)
+	searchAgent.SetChangeListener(func() {
+		ao.requestAlertCheck()
+		recommendationAgent.CatalogChanged()
+	})
+	alerts, err := LoadPriceAlertStore(alertsPath())
+	if err != nil {
+		return fmt.Errorf("loading price alerts: %v", err)
+	}
+	ao.alerts = alerts
+	ao.rankingLog = NewRankingLog(RankingsPath(), maxRankingLogBytes())
+	ao.sessionStore = NewSessionStore(sessionTTL(), maxSessions())
 
-	agents := []models.Agent{inventoryAgent, searchAgent, recommendationAgent}
+	agents := []models.Agent{inventoryAgent, searchAgent, recommendationAgent, pricingAgent, comparisonAgent, stylistAgent, sizeAgent}
 
 	for _, agent := range agents {
 		if err := ao.RegisterAgent(agent); err != nil {
@@ -54,7 +84,16 @@ func (ao *AgentOrchestrator) Initialize() error {
 		}
 	}
 
+	if table, err := currency.LoadTable(currency.DefaultPath()); err != nil {
+		log.Printf("Currency conversion disabled: %v", err)
+	} else {
+		ao.converter = currency.NewConverter(table)
+		log.Printf("Loaded %d exchange rates (base %s, as of %s)", len(table.Rates), table.Base, table.AsOf)
+	}
+
 	go ao.processMessages()
+	go ao.runAlertScheduler(alertInterval())
+	go ao.runSessionSweeper(min(ao.sessionStore.ttl, maxSessionSweepEvery))
 
 	log.Printf("Agent orchestrator initialized with %d agents", len(ao.agents))
 	return nil
@@ -93,8 +132,11 @@ func (ao *AgentOrchestrator) processMessages() {
 	}
 }
 
-func (ao *AgentOrchestrator) ProcessUserRequest(ctx context.Context, userID, query string) (*models.CelesteResponse, error) {
-	userContext := ao.GetUserContext(userID)
+func (ao *AgentOrchestrator) userContext(userID string) *models.UserContext {
+	ao.mutex.Lock()
+	defer ao.mutex.Unlock()
+
+	userContext := ao.contextStore[userID]
 	if userContext == nil {
 		userContext = &models.UserContext{
 			UserID:      userID,
@@ -102,25 +144,120 @@ func (ao *AgentOrchestrator) ProcessUserRequest(ctx context.Context, userID, que
 			History:     []string{},
 			CartItems:   []string{},
 		}
-		ao.UpdateUserContext(userID, userContext)
+		ao.contextStore[userID] = userContext
+	}
+	return userContext
+}
+
+// snapshot copies what agents read of a user's context, so they can work
+// on it while later requests update the original.
+func (ao *AgentOrchestrator) snapshot(userContext *models.UserContext) *models.UserContext {
+	ao.mutex.RLock()
+	defer ao.mutex.RUnlock()
+
+	copied := *userContext
+	copied.Preferences = make(map[string]string, len(userContext.Preferences))
+	for key, value := range userContext.Preferences {
+		copied.Preferences[key] = value
+	}
+	copied.Learned = copyProfile(userContext.Learned)
+	copied.History = append([]string(nil), userContext.History...)
+	copied.CartItems = append([]string(nil), userContext.CartItems...)
+	copied.RecentProducts = append([]string(nil), userContext.RecentProducts...)
+	copied.ActiveFilters = make(map[string]string, len(userContext.ActiveFilters))
+	for key, value := range userContext.ActiveFilters {
+		copied.ActiveFilters[key] = value
+	}
+	copied.Conversation.Turns = append([]models.ConversationTurn(nil), userContext.Conversation.Turns...)
+	return &copied
+}
+
+// SetUserLocale records where the user is and the currency they want prices
+// shown in. Either may be empty to leave it unchanged.
+func (ao *AgentOrchestrator) SetUserLocale(userID, location, currencyCode string) error {
+	currencyCode = strings.ToUpper(strings.TrimSpace(currencyCode))
+	if currencyCode != "" && !ao.SupportsCurrency(currencyCode) {
+		return fmt.Errorf("unsupported currency %q", currencyCode)
+	}
+
+	userContext := ao.userContext(userID)
+	ao.mutex.Lock()
+	defer ao.mutex.Unlock()
+	if location != "" {
+		userContext.Location = location
+	}
+	if currencyCode != "" {
+		userContext.Preferences["currency"] = currencyCode
+	}
+	return nil
+}
+
+func (ao *AgentOrchestrator) SupportsCurrency(code string) bool {
+	return ao.converter != nil && ao.converter.Supports(code)
+}
+
+// displayCurrency is the user's chosen currency, else the one for their
+// location, else none (prices are shown as listed).
+func (ao *AgentOrchestrator) displayCurrency(userContext *models.UserContext) string {
+	ao.mutex.RLock()
+	defer ao.mutex.RUnlock()
+
+	if code := userContext.Preferences["currency"]; code != "" {
+		return code
+	}
+	if code, ok := currency.ForLocation(userContext.Location); ok && ao.SupportsCurrency(code) {
+		return code
+	}
+	return ""
+}
+
+// DisplayPrices converts each product's price into the given currency.
+// Products whose price cannot be converted are left out.
+func (ao *AgentOrchestrator) DisplayPrices(products []models.Product, currencyCode string) map[string]models.Money {
+	if currencyCode == "" || ao.converter == nil {
+		return nil
+	}
+
+	prices := make(map[string]models.Money, len(products))
+	for _, product := range products {
+		converted, err := ao.converter.Convert(product.PriceUsd, currencyCode)
+		if err != nil {
+			log.Printf("Price conversion for %s: %v", product.ID, err)
+			continue
+		}
+		prices[product.ID] = converted
 	}
+	return prices
+}
+
+func (ao *AgentOrchestrator) ProcessUserRequest(ctx context.Context, userID, query string, opts models.SearchOptions) (*models.CelesteResponse, error) {
+	userContext := ao.userContext(userID)
 
+	ao.mutex.Lock()
 	userContext.History = append(userContext.History, query)
 	if len(userContext.History) > 10 {
 		userContext.History = userContext.History[1:]
 	}
-	ao.UpdateUserContext(userID, userContext)
+	ao.mutex.Unlock()
 
 	workflowID := fmt.Sprintf("workflow_%s_%d", userID, time.Now().Unix())
 	agentPath := []string{}
 
+	if request, ok := parsePriceAlert(query); ok {
+		response, err := ao.subscribeFromChat(ctx, userContext, request, workflowID)
+		if err == nil {
+			ao.remember(ctx, userContext, newTurn(query, query, "price_alert", nil, response))
+		}
+		return response, err
+	}
+
 	searchMsg := models.AgentMessage{
 		ID:        fmt.Sprintf("%s_search", workflowID),
 		FromAgent: "orchestrator",
 		ToAgent:   "search_agent",
 		Type:      "product_search",
-		Data:      map[string]interface{}{"query": query},
-		Context:   userContext,
+		Data:      map[string]interface{}{"query": query, "options": opts},
+		Context:   ao.snapshot(userContext),
 		Timestamp: time.Now(),
 	}
 
@@ -131,13 +268,37 @@ func (ao *AgentOrchestrator) ProcessUserRequest(ctx context.Context, userID, que
 	}
 	agentPath = append(agentPath, "search_agent")
 
+	// A follow-up about earlier products leaves the search they came from in
+	// place for later refinements
+	referenced, _ := searchResponse.Data["referenced_products"].([]string)
+	ao.mutex.Lock()
+	if referenced == nil {
+		userContext.LastQuery, _ = searchResponse.Data["query"].(string)
+		userContext.ActiveFilters, _ = searchResponse.Data["filters"].(map[string]string)
+	}
+	filters := userContext.ActiveFilters
+	ao.mutex.Unlock()
+
+	// Learn from this search, then let what the shopper tends to like lift
+	// matching results when they are ranked by relevance
+	products, _ := searchResponse.Data["products"].([]models.Product)
+	ao.learnFromSearch(userContext, filters, products)
+	agentContext := ao.snapshot(userContext)
+	resultRanking := models.Ranking{Baseline: productIDs(products), Personalized: productIDs(products)}
+	if resolved, _ := searchResponse.Data["options"].(models.SearchOptions); resolved.Sort == "relevance" {
+		scores, _ := searchResponse.Data["scores"].(map[string]float64)
+		personalized := personalizeProducts(products, scores, agentContext.Learned)
+		searchResponse.Data["products"] = personalized
+		resultRanking.Personalized = productIDs(personalized)
+	}
+
 	inventoryMsg := models.AgentMessage{
 		ID:        fmt.Sprintf("%s_inventory", workflowID),
 		FromAgent: "orchestrator",
 		ToAgent:   "inventory_agent",
 		Type:      "check_inventory",
 		Data:      searchResponse.Data,
-		Context:   userContext,
+		Context:   agentContext,
 		Timestamp: time.Now(),
 	}
 
@@ -159,7 +320,7 @@ func (ao *AgentOrchestrator) ProcessUserRequest(ctx context.Context, userID, que
 			"search_results": searchResponse.Data,
 			"inventory_info": inventoryResponse.Data,
 		},
-		Context:   userContext,
+		Context:   agentContext,
 		Timestamp: time.Now(),
 	}
 
@@ -172,51 +333,402 @@ func (ao *AgentOrchestrator) ProcessUserRequest(ctx context.Context, userID, que
 		agentPath = append(agentPath, "recommendation_agent")
 	}
 
-	return ao.synthesizeResponse(query, searchResponse, inventoryResponse, recResponse, workflowID, agentPath)
+	// Specialist agents for intents that need more than search results
+	var pricingResponse, comparisonResponse, stylistResponse, sizeResponse *models.AgentResponse
+	intent, _ := searchResponse.Data["intent"].(string)
+	switch {
+	case intent == "price_inquiry":
+		pricingResponse = ao.consult(ctx, "pricing_agent", "price_quote", workflowID, searchResponse.Data, agentContext)
+	case intent == "comparison" && len(referenced) != 1:
+		comparisonResponse = ao.consult(ctx, "comparison_agent", "compare_products", workflowID, searchResponse.Data, agentContext)
+	case intent == "size_help":
+		sizeResponse = ao.consult(ctx, "size_agent", "size_guidance", workflowID, searchResponse.Data, agentContext)
+	case intent == "style_advice" || intent == "occasion_shopping" || completeLookPattern.MatchString(normalizeQuery(query)):
+		stylistResponse = ao.consult(ctx, "stylist_agent", "compose_outfits", workflowID, searchResponse.Data, agentContext)
+	}
+	specialists := []*models.AgentResponse{pricingResponse, comparisonResponse, stylistResponse, sizeResponse}
+	for _, specialist := range specialists {
+		if specialist != nil {
+			agentPath = append(agentPath, specialist.FromAgent)
+		}
+	}
+
+	response, err := ao.synthesizeResponse(ctx, query, userContext, searchResponse, inventoryResponse, recResponse, specialistMessage(comparisonResponse, stylistResponse, sizeResponse), workflowID, agentPath)
+	if err != nil {
+		return nil, err
+	}
+	if pricingResponse != nil {
+		response.Prices, _ = pricingResponse.Data["quotes"].(map[string]models.PriceQuote)
+		response.Actions = mergeActions(pricingResponse.NextActions, response.Actions)
+	}
+	if comparisonResponse != nil {
+		if table, ok := comparisonResponse.Data["comparison"].(*models.ComparisonTable); ok {
+			response.Comparison = table
+			response.Products = table.Products
+		}
+		response.Actions = mergeActions(comparisonResponse.NextActions, response.Actions)
+	}
+	if stylistResponse != nil {
+		response.Outfits, _ = stylistResponse.Data["outfits"].([]models.Outfit)
+		response.Actions = mergeActions(stylistResponse.NextActions, response.Actions)
+	}
+	response.RecommendedProducts, _ = recResponse.Data["recommended_products"].([]models.Recommendation)
+	if sizeResponse != nil {
+		if products, _ := sizeResponse.Data["products"].([]models.Product); len(products) > 0 {
+			response.Products = products
+		}
+		response.SizeAdvice, _ = sizeResponse.Data["size_advice"].(map[string]models.SizeRecommendation)
+		response.SizeCharts, _ = sizeResponse.Data["size_charts"].(map[string]models.SizeChart)
+		response.Actions = mergeActions(sizeResponse.NextActions, response.Actions)
+		if profile, _ := sizeResponse.Data["fit_profile"].(map[string]string); len(profile) > 0 {
+			ao.mutex.Lock()
+			for key, value := range profile {
+				userContext.Preferences[key] = value
+			}
+			ao.mutex.Unlock()
+		}
+	}
+
+	response.ReferencedProducts = referenced
+	response.ProductReasons = ao.productReasons(response.Products, products, query, agentContext, inventoryResponse, recResponse)
+	response.ActionReasons = actionReasons(response.Actions, recResponse, specialists)
+
+	recommendationRanking, _ := recResponse.Data["recommendation_ranking"].(models.Ranking)
+	response.PersonalizationScore = personalizationScore(resultRanking, recommendationRanking)
+	response.Personalized = response.PersonalizationScore > 0
+	ao.logRankings(models.RankingEvent{
+		UserID:          userID,
+		Query:           query,
+		WorkflowID:      workflowID,
+		Timestamp:       time.Now().UTC(),
+		Results:         resultRanking,
+		Recommendations: recommendationRanking,
+		Score:           response.PersonalizationScore,
+	})
+
+	ao.mutex.Lock()
+	userContext.RecentProducts = make([]string, len(response.Products))
+	for i, product := range response.Products {
+		userContext.RecentProducts[i] = product.ID
+	}
+	ao.mutex.Unlock()
+	resolved, _ := searchResponse.Data["query"].(string)
+	ao.remember(ctx, userContext, newTurn(query, resolved, intent, referenced, response))
+	if code := ao.displayCurrency(userContext); code != "" {
+		response.Currency = code
+		response.DisplayPrices = ao.DisplayPrices(response.Products, code)
+	}
+	return response, nil
+}
+
+// logRankings records a reply's rankings for offline evaluation. Replies
+// with nothing ranked are not worth keeping.
+func (ao *AgentOrchestrator) logRankings(event models.RankingEvent) {
+	if ao.rankingLog == nil || (len(event.Results.Baseline) == 0 && len(event.Recommendations.Baseline) == 0) {
+		return
+	}
+	if err := ao.rankingLog.Record(event); err != nil {
+		log.Printf("Failed to log rankings for %s: %v", event.UserID, err)
+	}
+}
+
+// productReasons merges why the inventory and recommendation agents think
+// each product shown is worth the shopper's attention. Products a specialist
+// brought in after those agents ran are explained directly.
+func (ao *AgentOrchestrator) productReasons(shown, searched []models.Product, query string, userContext *models.UserContext, invResp, recResp *models.AgentResponse) map[string][]models.Reason {
+	stockReasons, _ := invResp.Data["reasons"].(map[string][]models.Reason)
+	matchReasons, _ := recResp.Data["product_reasons"].(map[string][]models.Reason)
+	searchedIDs := make(map[string]bool, len(searched))
+	for _, product := range searched {
+		searchedIDs[product.ID] = true
+	}
+	inventoryAgent, _ := ao.agents["inventory_agent"].(*InventoryAgent)
+	recommendationAgent, _ := ao.agents["recommendation_agent"].(*RecommendationAgent)
+
+	reasons := make(map[string][]models.Reason)
+	for _, product := range shown {
+		var productReasons []models.Reason
+		if searchedIDs[product.ID] {
+			productReasons = append(append([]models.Reason{}, matchReasons[product.ID]...), stockReasons[product.ID]...)
+		} else {
+			if recommendationAgent != nil {
+				productReasons = recommendationAgent.ProductReasons([]models.Product{product}, query, userContext)[product.ID]
+			}
+			if inventoryAgent != nil {
+				productReasons = append(productReasons, inventoryAgent.StockReasons(product)...)
+			}
+		}
+		if len(productReasons) > 0 {
+			reasons[product.ID] = productReasons
+		}
+	}
+	return reasons
+}
+
+// actionReasons explains each action offered: the recommendation agent's
+// own reasons, and the specialist that suggested the rest.
+func actionReasons(actions []string, recResp *models.AgentResponse, specialists []*models.AgentResponse) map[string][]models.Reason {
+	suggested, _ := recResp.Data["action_reasons"].(map[string][]models.Reason)
+	reasons := make(map[string][]models.Reason)
+	for _, specialist := range specialists {
+		if specialist == nil {
+			continue
+		}
+		reason := models.Reason{Code: ReasonSpecialist, Message: fmt.Sprintf("Suggested by the %s", strings.ReplaceAll(specialist.FromAgent, "_", " "))}
+		for _, action := range specialist.NextActions {
+			addActionReason(reasons, action, reason)
+		}
+	}
+	for _, action := range actions {
+		for _, reason := range suggested[action] {
+			addActionReason(reasons, action, reason)
+		}
+	}
+	for action := range reasons {
+		if !contains(actions, action) {
+			delete(reasons, action)
+		}
+	}
+	return reasons
+}
+
+// consult runs a specialist agent on the search results with a snapshot of
+// the user's context. A failure is logged and leaves the rest of the reply
+// intact.
+func (ao *AgentOrchestrator) consult(ctx context.Context, agentID, messageType, workflowID string, data map[string]interface{}, userContext *models.UserContext) *models.AgentResponse {
+	message := models.AgentMessage{
+		ID:        fmt.Sprintf("%s_%s", workflowID, messageType),
+		FromAgent: "orchestrator",
+		ToAgent:   agentID,
+		Type:      messageType,
+		Data:      data,
+		Context:   userContext,
+		Timestamp: time.Now(),
+	}
+
+	response, err := ao.agents[agentID].Process(ctx, message)
+	if err != nil {
+		log.Printf("Agent %s failed: %v", agentID, err)
+		return nil
+	}
+	return response
+}
+
+// subscribeFromChat sets up a price alert asked for in conversation. The
+// product is the one named in the message, else the first one shown in the
+// last reply.
+func (ao *AgentOrchestrator) subscribeFromChat(ctx context.Context, userContext *models.UserContext, request priceAlertRequest, workflowID string) (*models.CelesteResponse, error) {
+	response := &models.CelesteResponse{
+		WorkflowID: workflowID,
+		AgentPath:  []string{},
+		Actions:    []string{"View my price alerts", "Continue shopping"},
+	}
+
+	var product models.Product
+	found := false
+	if request.Subject != "" {
+		opts, _ := ResolveSearchOptions(models.SearchOptions{Limit: 1})
+		page, err := ao.SearchCatalog(ctx, request.Subject, opts)
+		if err != nil {
+			return nil, err
+		}
+		response.AgentPath = append(response.AgentPath, "search_agent")
+		if len(page.Products) > 0 {
+			product, found = page.Products[0], true
+		}
+	} else {
+		ao.mutex.RLock()
+		recent := append([]string{}, userContext.RecentProducts...)
+		ao.mutex.RUnlock()
+		if len(recent) > 0 {
+			product, found = ao.Catalog().Product(recent[0])
+		}
+	}
+	if !found {
+		response.Message = "Which product should I watch? Find it first, then ask me again."
+		return response, nil
+	}
+
+	defaultCurrency := ao.displayCurrency(userContext)
+	if defaultCurrency == "" {
+		defaultCurrency = product.PriceUsd.CurrencyCode
+	}
+	threshold, err := catalog.ParsePrice(request.Price, defaultCurrency)
+	if err == nil {
+		_, err = ao.CreatePriceAlert(userContext.UserID, product.ID, threshold, "")
+	}
+	if err != nil {
+		response.Message = fmt.Sprintf("Sorry, I couldn't set that alert: %v", err)
+		return response, nil
+	}
+
+	response.Products = []models.Product{product}
+	response.Message = fmt.Sprintf("Done! I'll let you know when %s drops to %s or below. It's %s right now.", product.Name, threshold, ao.currentPrice(product))
+	return response, nil
+}
+
+// SearchCatalog runs a plain catalogue search without the rest of the
+// agent workflow.
+func (ao *AgentOrchestrator) SearchCatalog(ctx context.Context, query string, opts models.SearchOptions) (*models.SearchPage, error) {
+	searchMsg := models.AgentMessage{
+		ID:        fmt.Sprintf("search_%d", time.Now().UnixNano()),
+		FromAgent: "orchestrator",
+		ToAgent:   "search_agent",
+		Type:      "catalog_search",
+		Data:      map[string]interface{}{"query": query, "options": opts},
+		Timestamp: time.Now(),
+	}
+
+	searchResponse, err := ao.agents["search_agent"].Process(ctx, searchMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, _ := searchResponse.Data["options"].(models.SearchOptions)
+	page := &models.SearchPage{
+		Query:  query,
+		Offset: resolved.Offset,
+		Limit:  resolved.Limit,
+		Sort:   resolved.Sort,
+	}
+	page.Products, _ = searchResponse.Data["products"].([]models.Product)
+	page.Scores, _ = searchResponse.Data["scores"].(map[string]float64)
+	page.TotalMatches, _ = searchResponse.Data["total_matches"].(int)
+	page.NextCursor, _ = searchResponse.Data["next_cursor"].(string)
+	page.Facets, _ = searchResponse.Data["facets"].(map[string][]models.FacetValue)
+	page.Filters, _ = searchResponse.Data["filters"].(map[string]string)
+	page.DidYouMean, _ = searchResponse.Data["did_you_mean"].(string)
+	return page, nil
+}
+
+// specialistMessage is the reply a specialist wrote, if any: the comparison
+// summary, the stylist's outfits or the size advice.
+func specialistMessage(comparison, stylist, size *models.AgentResponse) string {
+	var message string
+	if comparison != nil {
+		if table, ok := comparison.Data["comparison"].(*models.ComparisonTable); ok {
+			message = table.Summary
+		}
+	}
+	if stylist != nil {
+		if outfits, _ := stylist.Data["outfits"].([]models.Outfit); len(outfits) > 0 {
+			message, _ = stylist.Data["message"].(string)
+		}
+	}
+	if size != nil {
+		message, _ = size.Data["message"].(string)
+	}
+	return message
 }
 
-func (ao *AgentOrchestrator) synthesizeResponse(query string, searchResp, invResp, recResp *models.AgentResponse, workflowID string, agentPath []string) (*models.CelesteResponse, error) {
+// synthesizeResponse assembles the reply from the agents' results. The LLM
+// writes its message unless a specialist already has.
+func (ao *AgentOrchestrator) synthesizeResponse(ctx context.Context, query string, userContext *models.UserContext, searchResp, invResp, recResp *models.AgentResponse, message, workflowID string, agentPath []string) (*models.CelesteResponse, error) {
 	var products []models.Product
 	if searchData, ok := searchResp.Data["products"].([]models.Product); ok {
 		products = searchData
 	}
+	scores, _ := searchResp.Data["scores"].(map[string]float64)
+	totalMatches, _ := searchResp.Data["total_matches"].(int)
+	nextCursor, _ := searchResp.Data["next_cursor"].(string)
+	facets, _ := searchResp.Data["facets"].(map[string][]models.FacetValue)
+	filters, _ := searchResp.Data["filters"].(map[string]string)
+	didYouMean, _ := searchResp.Data["did_you_mean"].(string)
 
 	actions := []string{"Browse similar items", "Add to wishlist", "Get size guidance"}
 	if recActions, ok := recResp.Data["actions"].([]string); ok {
 		actions = recActions
 	}
 
-	message := ao.generateAgentCoordinatedResponse(query, searchResp, invResp, recResp)
+	if message == "" {
+		message = ao.generateAgentCoordinatedResponse(ctx, query, userContext, products)
+	}
 
 	return &models.CelesteResponse{
 		Message:      message,
 		Products:     products,
+		Scores:       scores,
+		TotalMatches: totalMatches,
+		NextCursor:   nextCursor,
+		Facets:       facets,
+		Filters:      filters,
+		DidYouMean:   didYouMean,
 		Actions:      actions,
 		WorkflowID:   workflowID,
 		AgentPath:    agentPath,
-		Personalized: len(agentPath) > 1,
 	}, nil
 }
 
-func (ao *AgentOrchestrator) generateAgentCoordinatedResponse(query string, searchResp, invResp, recResp *models.AgentResponse) string {
+// mergeActions puts the first list's actions ahead of the second's,
+// dropping duplicates.
+func mergeActions(first, second []string) []string {
+	merged := make([]string, 0, len(first)+len(second))
+	for _, action := range append(append([]string{}, first...), second...) {
+		if !contains(merged, action) {
+			merged = append(merged, action)
+		}
+	}
+	return merged
+}
+
+// generateAgentCoordinatedResponse writes the reply, giving the LLM the
+// conversation so far so it can answer follow-ups in context.
+func (ao *AgentOrchestrator) generateAgentCoordinatedResponse(ctx context.Context, query string, userContext *models.UserContext, products []models.Product) string {
+	found := "none"
+	if len(products) > 0 {
+		names := make([]string, len(products))
+		for i, product := range products {
+			names[i] = fmt.Sprintf("%s (%s)", product.Name, product.PriceUsd.String())
+		}
+		found = strings.Join(names, "; ")
+	}
+
 	prompt := fmt.Sprintf(`You are Céleste, a shopping assistant with multiple AI agents.
 
+%s
 Customer query: "%s"
 
-Your agents found products and checked inventory. Provide a brief, helpful response listing the products found. Keep it concise and avoid lengthy explanations about agent coordination.`, query)
+Products found: %s
+
+Your agents found products and checked inventory. Provide a brief, helpful response listing the products found. If the query refers to something earlier in the conversation, answer it in that light. Keep it concise and avoid lengthy explanations about agent coordination.`, ao.conversationContext(userContext), query, found)
 
-	resp, err := ao.geminiClient.Models.GenerateContent(
-		context.Background(),
-		"gemini-2.5-flash",
-		genai.Text(prompt),
-		nil,
-	)
+	resp, err := generate(ctx, ao.geminiClient, prompt)
 	if err != nil {
 		return "I've found some options for you!"
 	}
 
 	return resp.Text()
 }
+
+// Catalog returns the agent that manages the product catalogue.
+func (ao *AgentOrchestrator) Catalog() CatalogManager {
+	ao.mutex.RLock()
+	defer ao.mutex.RUnlock()
+	return ao.agents["search_agent"].(CatalogManager)
+}
+
+// CatalogStatus reports the catalogue version being served.
+func (ao *AgentOrchestrator) CatalogStatus() CatalogStatus {
+	return ao.Catalog().Status()
+}
+
+// Metrics reports agent-level counters for monitoring.
+func (ao *AgentOrchestrator) Metrics() map[string]interface{} {
+	metrics := make(map[string]interface{})
+	if searchAgent, ok := ao.agents["search_agent"].(*SearchAgent); ok {
+		metrics["intent_classifier"] = searchAgent.IntentMetrics()
+	}
+	if recommendationAgent, ok := ao.agents["recommendation_agent"].(*RecommendationAgent); ok {
+		metrics["recommender"] = recommendationAgent.Similarity()
+	}
+	metrics["sessions"] = map[string]interface{}{
+		"active": ao.sessionStore.Len(),
+		"max":    ao.sessionStore.limit,
+		"ttl":    ao.sessionStore.ttl.String(),
+	}
+	return metrics
+}
+
 func (ao *AgentOrchestrator) ListAgents() []string {
 	ao.mutex.RLock()
 	defer ao.mutex.RUnlock()
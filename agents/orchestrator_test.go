@@ -0,0 +1,43 @@
+package agents
+
+import (
+	"sync"
+	"testing"
+
+	"celeste/models"
+)
+
+func TestSnapshotWhileUpdating(t *testing.T) {
+	ao := NewAgentOrchestrator(nil)
+	userContext := ao.userContext("shopper")
+	userContext.RecentProducts = []string{"p1", "p2"}
+	snapshot := ao.snapshot(userContext)
+
+	// Run with -race: specialists read the snapshot while the orchestrator
+	// keeps the original up to date
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			ao.mutex.Lock()
+			userContext.Preferences["fit"] = "regular"
+			userContext.RecentProducts[0] = "p3"
+			ao.mutex.Unlock()
+			ao.learnFromInteraction(userContext, models.Product{ID: "p3", Brand: "Acme"}, "view")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = snapshot.Preferences["fit"]
+			_ = snapshot.RecentProducts[0]
+			_ = snapshot.Learned.Brands["acme"]
+		}
+	}()
+	wg.Wait()
+
+	if snapshot.RecentProducts[0] != "p1" || snapshot.Preferences["fit"] != "" {
+		t.Errorf("snapshot changed with the original: %v, %v", snapshot.RecentProducts, snapshot.Preferences)
+	}
+}
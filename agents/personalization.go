@@ -0,0 +1,365 @@
+package agents
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"celeste/models"
+)
+
+// rankingChange measures how far personalization moved a ranking: the
+// Spearman footrule distance between the two orders (the sum of how many
+// places each product moved) over its maximum, so 0 means unchanged and 1
+// means reversed. Products in only one of the lists are ignored.
+func rankingChange(baseline, personalized []string) float64 {
+	positions := make(map[string]int, len(personalized))
+	for i, id := range personalized {
+		positions[id] = i
+	}
+	var shared []string
+	for _, id := range baseline {
+		if _, ok := positions[id]; ok {
+			shared = append(shared, id)
+		}
+	}
+	if len(shared) < 2 {
+		return 0
+	}
+
+	// Rank the shared products within the personalized list alone
+	order := append([]string(nil), shared...)
+	sort.SliceStable(order, func(i, j int) bool { return positions[order[i]] < positions[order[j]] })
+	ranks := make(map[string]int, len(order))
+	for i, id := range order {
+		ranks[id] = i
+	}
+
+	distance := 0
+	for i, id := range shared {
+		distance += abs(i - ranks[id])
+	}
+	n := len(shared)
+	return float64(distance) / float64(n*n/2)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// personalizationScore is the mean ranking change over the rankings with
+// at least two products to reorder.
+func personalizationScore(rankings ...models.Ranking) float64 {
+	total, counted := 0.0, 0
+	for _, ranking := range rankings {
+		if len(ranking.Baseline) < 2 {
+			continue
+		}
+		total += rankingChange(ranking.Baseline, ranking.Personalized)
+		counted++
+	}
+	if counted == 0 {
+		return 0
+	}
+	return round3(total / float64(counted))
+}
+
+func productIDs(products []models.Product) []string {
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	return ids
+}
+
+func recommendationIDs(recommendations []models.Recommendation) []string {
+	ids := make([]string, len(recommendations))
+	for i, recommendation := range recommendations {
+		ids[i] = recommendation.Product.ID
+	}
+	return ids
+}
+
+const defaultMaxRankingLogBytes = 64 << 20
+
+// RankingsPath reads CELESTE_RANKINGS_PATH, defaulting to
+// data/rankings.jsonl.
+func RankingsPath() string {
+	if path := os.Getenv("CELESTE_RANKINGS_PATH"); path != "" {
+		return path
+	}
+	return "data/rankings.jsonl"
+}
+
+// maxRankingLogBytes reads CELESTE_RANKINGS_MAX_BYTES, how large the
+// ranking log grows before it is rotated.
+func maxRankingLogBytes() int64 {
+	value := os.Getenv("CELESTE_RANKINGS_MAX_BYTES")
+	if value == "" {
+		return defaultMaxRankingLogBytes
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit <= 0 {
+		log.Printf("Invalid CELESTE_RANKINGS_MAX_BYTES %q, using %d", value, defaultMaxRankingLogBytes)
+		return defaultMaxRankingLogBytes
+	}
+	return limit
+}
+
+// RankingLog appends each reply's rankings as a JSON line to its file.
+// Once the file would grow past limit it is moved to path.1, replacing the
+// previous one, so at most two files' worth are kept.
+type RankingLog struct {
+	path  string
+	limit int64
+	mutex sync.Mutex
+}
+
+func NewRankingLog(path string, limit int64) *RankingLog {
+	return &RankingLog{path: path, limit: limit}
+}
+
+func (rl *RankingLog) Record(event models.RankingEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	if info, err := os.Stat(rl.path); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > rl.limit {
+		if err := os.Rename(rl.path, rotatedPath(rl.path)); err != nil {
+			return fmt.Errorf("rotating %s: %v", rl.path, err)
+		}
+	}
+	file, err := os.OpenFile(rl.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(line)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func rotatedPath(path string) string {
+	return path + ".1"
+}
+
+// LoadRankings reads a ranking log and the file it last rotated to, oldest
+// first, skipping lines that do not parse.
+func LoadRankings(path string) ([]models.RankingEvent, error) {
+	events, err := readRankings(rotatedPath(path), nil)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if events, err = readRankings(path, events); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	return events, nil
+}
+
+func readRankings(path string, events []models.RankingEvent) ([]models.RankingEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return events, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event models.RankingEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || event.UserID == "" {
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return events, nil
+}
+
+// LoadInteractions reads an interaction log, skipping lines that do not
+// parse.
+func LoadInteractions(path string) ([]models.Interaction, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return NewInteractionLog(path).All(), nil
+}
+
+// RankingMetrics are the mean quality of a set of rankings, judged by what
+// shoppers went on to interact with.
+type RankingMetrics struct {
+	NDCG    float64 `json:"ndcg"`     // Normalized discounted cumulative gain at K
+	MRR     float64 `json:"mrr"`      // Mean reciprocal rank of the first product interacted with
+	HitRate float64 `json:"hit_rate"` // Share of rankings with an interaction in the top K
+}
+
+// RankingEvaluation compares the baseline and personalized orders of one
+// kind of ranking.
+type RankingEvaluation struct {
+	Rankings     int            `json:"rankings"` // Rankings with at least one interaction to judge by
+	MeanChange   float64        `json:"mean_change"`
+	Baseline     RankingMetrics `json:"baseline"`
+	Personalized RankingMetrics `json:"personalized"`
+	NDCGLift     float64        `json:"ndcg_lift"` // Personalized minus baseline NDCG
+}
+
+// PersonalizationReport is the outcome of EvaluatePersonalization.
+type PersonalizationReport struct {
+	Replies         int               `json:"replies"`
+	Evaluated       int               `json:"evaluated"` // Replies followed by an interaction with a product shown
+	K               int               `json:"k"`
+	Window          string            `json:"window"`
+	Results         RankingEvaluation `json:"results"`
+	Recommendations RankingEvaluation `json:"recommendations"`
+}
+
+// EvaluatePersonalization replays logged replies against the interactions
+// that followed them. A product counts as relevant to a reply when the
+// shopper interacted with it within window of the reply and before their
+// next one, weighted as the collaborative model weighs interactions. Each
+// ranking is then scored in its baseline and personalized order.
+//
+// Shoppers saw the personalized order, so position bias favours it; treat
+// a small lift with caution.
+func EvaluatePersonalization(replies []models.RankingEvent, interactions []models.Interaction, k int, window time.Duration) PersonalizationReport {
+	report := PersonalizationReport{Replies: len(replies), K: k, Window: window.String()}
+
+	byUser := make(map[string][]models.Interaction)
+	for _, interaction := range interactions {
+		byUser[interaction.UserID] = append(byUser[interaction.UserID], interaction)
+	}
+	nextReply := make(map[int]time.Time)
+	lastByUser := make(map[string]int)
+	for i, reply := range replies {
+		if previous, ok := lastByUser[reply.UserID]; ok {
+			nextReply[previous] = reply.Timestamp
+		}
+		lastByUser[reply.UserID] = i
+	}
+
+	var results, recommendations rankingTotals
+	for i, reply := range replies {
+		end := reply.Timestamp.Add(window)
+		if next, ok := nextReply[i]; ok && next.Before(end) {
+			end = next
+		}
+		relevance := make(map[string]float64)
+		for _, interaction := range byUser[reply.UserID] {
+			if interaction.Timestamp.Before(reply.Timestamp) || !interaction.Timestamp.Before(end) {
+				continue
+			}
+			relevance[interaction.ProductID] = max(relevance[interaction.ProductID], interactionWeights[interaction.Type])
+		}
+
+		judgedResults := results.add(reply.Results, relevance, k)
+		judgedRecommendations := recommendations.add(reply.Recommendations, relevance, k)
+		if judgedResults || judgedRecommendations {
+			report.Evaluated++
+		}
+	}
+	report.Results = results.evaluation()
+	report.Recommendations = recommendations.evaluation()
+	return report
+}
+
+type rankingTotals struct {
+	rankings               int
+	change                 float64
+	baseline, personalized RankingMetrics
+}
+
+// add scores a ranking if any of its products are relevant, reporting
+// whether it did.
+func (rt *rankingTotals) add(ranking models.Ranking, relevance map[string]float64, k int) bool {
+	relevant := false
+	for _, id := range ranking.Baseline {
+		relevant = relevant || relevance[id] > 0
+	}
+	if !relevant {
+		return false
+	}
+
+	rt.rankings++
+	rt.change += rankingChange(ranking.Baseline, ranking.Personalized)
+	for _, pair := range []struct {
+		ids     []string
+		metrics *RankingMetrics
+	}{{ranking.Baseline, &rt.baseline}, {ranking.Personalized, &rt.personalized}} {
+		ndcg, reciprocalRank, hit := judge(pair.ids, relevance, k)
+		pair.metrics.NDCG += ndcg
+		pair.metrics.MRR += reciprocalRank
+		pair.metrics.HitRate += hit
+	}
+	return true
+}
+
+func (rt *rankingTotals) evaluation() RankingEvaluation {
+	evaluation := RankingEvaluation{Rankings: rt.rankings}
+	if rt.rankings == 0 {
+		return evaluation
+	}
+	n := float64(rt.rankings)
+	mean := func(totals RankingMetrics) RankingMetrics {
+		return RankingMetrics{NDCG: round3(totals.NDCG / n), MRR: round3(totals.MRR / n), HitRate: round3(totals.HitRate / n)}
+	}
+	evaluation.MeanChange = round3(rt.change / n)
+	evaluation.Baseline = mean(rt.baseline)
+	evaluation.Personalized = mean(rt.personalized)
+	evaluation.NDCGLift = round3(evaluation.Personalized.NDCG - evaluation.Baseline.NDCG)
+	return evaluation
+}
+
+// judge scores one ranking: its NDCG at k, the reciprocal rank of its
+// first relevant product, and 1 if a relevant product is in the top k.
+func judge(ids []string, relevance map[string]float64, k int) (ndcg, reciprocalRank, hit float64) {
+	dcg := 0.0
+	var gains []float64
+	for i, id := range ids {
+		gain := relevance[id]
+		if gain == 0 {
+			continue
+		}
+		gains = append(gains, gain)
+		if i < k {
+			dcg += gain / math.Log2(float64(i+2))
+			hit = 1
+		}
+		if reciprocalRank == 0 {
+			reciprocalRank = 1 / float64(i+1)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.Float64Slice(gains)))
+	ideal := 0.0
+	for i, gain := range gains[:min(len(gains), k)] {
+		ideal += gain / math.Log2(float64(i+2))
+	}
+	if ideal > 0 {
+		ndcg = dcg / ideal
+	}
+	return ndcg, reciprocalRank, hit
+}
+
+func round3(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
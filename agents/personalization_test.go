@@ -0,0 +1,109 @@
+package agents
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"celeste/models"
+)
+
+func TestRankingChange(t *testing.T) {
+	tests := []struct {
+		name                   string
+		baseline, personalized []string
+		want                   float64
+	}{
+		{"unchanged", []string{"a", "b", "c", "d"}, []string{"a", "b", "c", "d"}, 0},
+		{"reversed", []string{"a", "b", "c", "d"}, []string{"d", "c", "b", "a"}, 1},
+		{"one swap", []string{"a", "b", "c", "d"}, []string{"b", "a", "c", "d"}, 0.25},
+		{"products in one list only", []string{"a", "x", "b"}, []string{"b", "y", "a"}, 1},
+		{"one shared product", []string{"a", "b"}, []string{"a", "c"}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rankingChange(tt.baseline, tt.personalized); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("rankingChange = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJudge(t *testing.T) {
+	tests := []struct {
+		name                  string
+		ids                   []string
+		relevance             map[string]float64
+		k                     int
+		ndcg, reciprocal, hit float64
+	}{
+		{"ideal order", []string{"a", "b", "c"}, map[string]float64{"a": 5, "b": 1}, 3, 1, 1, 1},
+		{"nothing relevant", []string{"a", "b"}, map[string]float64{}, 3, 0, 0, 0},
+		{
+			"swapped", []string{"b", "a", "c"}, map[string]float64{"a": 5, "b": 1}, 3,
+			(1 + 5/math.Log2(3)) / (5 + 1/math.Log2(3)), 1, 1,
+		},
+		{"relevant below k", []string{"c", "d", "a"}, map[string]float64{"a": 3}, 2, 0, 1.0 / 3, 0},
+		{"relevant second", []string{"c", "a"}, map[string]float64{"a": 3}, 2, 1 / math.Log2(3), 0.5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ndcg, reciprocal, hit := judge(tt.ids, tt.relevance, tt.k)
+			if math.Abs(ndcg-tt.ndcg) > 1e-9 || math.Abs(reciprocal-tt.reciprocal) > 1e-9 || hit != tt.hit {
+				t.Errorf("judge = %v, %v, %v; want %v, %v, %v", ndcg, reciprocal, hit, tt.ndcg, tt.reciprocal, tt.hit)
+			}
+		})
+	}
+}
+
+func TestEvaluatePersonalization(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	replies := []models.RankingEvent{
+		{UserID: "alice", Timestamp: start, Results: models.Ranking{Baseline: []string{"a", "b"}, Personalized: []string{"b", "a"}}},
+		{UserID: "alice", Timestamp: start.Add(10 * time.Minute), Results: models.Ranking{Baseline: []string{"c", "d"}, Personalized: []string{"c", "d"}}},
+	}
+	interactions := []models.Interaction{
+		{UserID: "alice", ProductID: "b", Type: InteractionPurchase, Timestamp: start.Add(time.Minute)},
+		// After alice's next reply, so it is not credited to the first
+		{UserID: "alice", ProductID: "a", Type: InteractionPurchase, Timestamp: start.Add(11 * time.Minute)},
+		{UserID: "bob", ProductID: "c", Type: InteractionView, Timestamp: start.Add(11 * time.Minute)},
+	}
+
+	report := EvaluatePersonalization(replies, interactions, 10, 30*time.Minute)
+	if report.Replies != 2 || report.Evaluated != 1 {
+		t.Fatalf("replies = %d, evaluated = %d; want 2, 1", report.Replies, report.Evaluated)
+	}
+	if got := report.Results; got.Personalized.NDCG != 1 || got.Baseline.MRR != 0.5 || got.MeanChange != 1 {
+		t.Errorf("results = %+v", got)
+	}
+}
+
+func TestRankingLogRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rankings.jsonl")
+	event := func(query string) models.RankingEvent {
+		return models.RankingEvent{UserID: "alice", Query: query, Timestamp: time.Now().UTC()}
+	}
+	rankingLog := NewRankingLog(path, 150)
+	for _, query := range []string{"first", "second", "third"} {
+		if err := rankingLog.Record(event(query)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	current, err := readRankings(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 1 || current[0].Query != "third" {
+		t.Errorf("current log = %+v, want only the third reply", current)
+	}
+	all, err := LoadRankings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Query != "second" {
+		t.Errorf("loaded %+v, want the second and third replies", all)
+	}
+}
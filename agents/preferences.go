@@ -0,0 +1,311 @@
+package agents
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"celeste/models"
+)
+
+const (
+	defaultPreferenceHalfLife = 7 * 24 * time.Hour
+	minPreferenceWeight       = 0.01
+
+	// A search counts for less than looking at a product, and a filter the
+	// shopper chose for more than the categories that happened to match.
+	searchFilterWeight   = 1.0
+	searchCategoryWeight = 0.3
+
+	// How far a perfect match with the learned profile can lift a score.
+	personalizationBoost = 0.5
+)
+
+// Shares of the affinity score in preferenceAffinity; they sum to 1.
+var affinityWeights = struct {
+	category, color, size, brand, price float64
+}{0.4, 0.2, 0.15, 0.1, 0.15}
+
+// preferenceHalfLife reads CELESTE_PREFERENCE_HALF_LIFE (a Go duration),
+// how long it takes a learned preference to lose half its weight.
+func preferenceHalfLife() time.Duration {
+	value := os.Getenv("CELESTE_PREFERENCE_HALF_LIFE")
+	if value == "" {
+		return defaultPreferenceHalfLife
+	}
+	halfLife, err := time.ParseDuration(value)
+	if err != nil || halfLife <= 0 {
+		log.Printf("Invalid CELESTE_PREFERENCE_HALF_LIFE %q, using %s", value, defaultPreferenceHalfLife)
+		return defaultPreferenceHalfLife
+	}
+	return halfLife
+}
+
+// decayProfile ages a profile's weights to now, dropping those that have
+// faded away.
+func decayProfile(profile *models.PreferenceProfile, now time.Time, halfLife time.Duration) {
+	if !profile.UpdatedAt.IsZero() && now.After(profile.UpdatedAt) {
+		factor := math.Pow(0.5, float64(now.Sub(profile.UpdatedAt))/float64(halfLife))
+		for _, weights := range []map[string]float64{profile.Categories, profile.Colors, profile.Sizes, profile.Brands} {
+			for key := range weights {
+				weights[key] *= factor
+				if weights[key] < minPreferenceWeight {
+					delete(weights, key)
+				}
+			}
+		}
+		profile.PriceWeight *= factor
+		profile.PriceSum *= factor
+		profile.PriceSquares *= factor
+	}
+	profile.UpdatedAt = now
+}
+
+func addWeight(weights *map[string]float64, key string, weight float64) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if key == "" {
+		return
+	}
+	if *weights == nil {
+		*weights = make(map[string]float64)
+	}
+	(*weights)[key] += weight
+}
+
+// observePrice adds a price to the profile's band. Prices in a currency
+// other than the band's are converted when possible and skipped otherwise.
+func (ao *AgentOrchestrator) observePrice(profile *models.PreferenceProfile, price models.Money, weight float64) {
+	if profile.PriceBand != nil && profile.PriceBand.Currency != "" && price.CurrencyCode != profile.PriceBand.Currency {
+		if ao.converter == nil {
+			return
+		}
+		converted, err := ao.converter.Convert(price, profile.PriceBand.Currency)
+		if err != nil {
+			return
+		}
+		price = converted
+	}
+
+	value := price.Float64()
+	if value <= 0 {
+		return
+	}
+	profile.PriceWeight += weight
+	profile.PriceSum += weight * value
+	profile.PriceSquares += weight * value * value
+	profile.PriceBand = priceBand(profile, price.CurrencyCode)
+}
+
+// priceBand is one standard deviation either side of the weighted mean
+// price, and never narrower than a quarter of the mean either side.
+func priceBand(profile *models.PreferenceProfile, currencyCode string) *models.PriceBand {
+	mean := profile.PriceSum / profile.PriceWeight
+	spread := math.Sqrt(math.Max(profile.PriceSquares/profile.PriceWeight-mean*mean, 0))
+	spread = math.Max(spread, mean/4)
+	return &models.PriceBand{
+		Min:      math.Round(math.Max(mean-spread, 0)*100) / 100,
+		Max:      math.Round((mean+spread)*100) / 100,
+		Currency: currencyCode,
+	}
+}
+
+// learnFromSearch takes the filters a shopper searched with as strong
+// signals, and the categories of the top results as weak ones.
+func (ao *AgentOrchestrator) learnFromSearch(userContext *models.UserContext, filters map[string]string, products []models.Product) {
+	ao.mutex.Lock()
+	defer ao.mutex.Unlock()
+
+	profile := &userContext.Learned
+	decayProfile(profile, time.Now().UTC(), preferenceHalfLife())
+	for key, value := range filters {
+		switch key {
+		case "category":
+			addWeight(&profile.Categories, value, searchFilterWeight)
+		case "color":
+			addWeight(&profile.Colors, value, searchFilterWeight)
+		case "size":
+			addWeight(&profile.Sizes, value, searchFilterWeight)
+		case "brand":
+			addWeight(&profile.Brands, value, searchFilterWeight)
+		}
+	}
+	for _, product := range products[:min(len(products), 3)] {
+		for _, category := range product.Categories {
+			addWeight(&profile.Categories, category, searchCategoryWeight/float64(len(product.Categories)))
+		}
+	}
+}
+
+// learnFromInteraction credits a product's categories, brand and price with
+// the interaction's weight, and its colour and size when it only comes in
+// one.
+func (ao *AgentOrchestrator) learnFromInteraction(userContext *models.UserContext, product models.Product, interactionType string) {
+	weight := interactionWeights[interactionType]
+
+	ao.mutex.Lock()
+	defer ao.mutex.Unlock()
+
+	profile := &userContext.Learned
+	decayProfile(profile, time.Now().UTC(), preferenceHalfLife())
+	for _, category := range product.Categories {
+		addWeight(&profile.Categories, category, weight/float64(len(product.Categories)))
+	}
+	addWeight(&profile.Brands, product.Brand, weight)
+	if colors := productColors(product); len(colors) == 1 {
+		addWeight(&profile.Colors, colors[0], weight)
+	}
+	if sizes := productSizes(product); len(sizes) == 1 {
+		addWeight(&profile.Sizes, sizes[0], weight)
+	}
+	ao.observePrice(profile, product.PriceUsd, weight)
+}
+
+// preferenceAffinity scores from 0 to 1 how well a product matches the
+// learned profile. Each weight is taken relative to the profile's strongest
+// in its kind, so affinity does not grow just because a profile is old.
+func preferenceAffinity(product models.Product, profile models.PreferenceProfile) float64 {
+	relative := func(weights map[string]float64, values []string) float64 {
+		strongest := 0.0
+		for _, weight := range weights {
+			strongest = max(strongest, weight)
+		}
+		best := 0.0
+		for _, value := range values {
+			best = max(best, weights[strings.ToLower(value)])
+		}
+		if strongest == 0 {
+			return 0
+		}
+		return best / strongest
+	}
+
+	affinity := affinityWeights.category*relative(profile.Categories, product.Categories) +
+		affinityWeights.color*relative(profile.Colors, productColors(product)) +
+		affinityWeights.size*relative(profile.Sizes, productSizes(product)) +
+		affinityWeights.brand*relative(profile.Brands, []string{product.Brand})
+	if band := profile.PriceBand; band != nil && (band.Currency == "" || band.Currency == product.PriceUsd.CurrencyCode) {
+		if price := product.PriceUsd.Float64(); price >= band.Min && price <= band.Max {
+			affinity += affinityWeights.price
+		}
+	}
+	return affinity
+}
+
+// personalizeProducts re-ranks products by their score lifted by up to
+// personalizationBoost for a perfect match with the learned profile. Without
+// scores, rank order stands in for relevance.
+func personalizeProducts(products []models.Product, scores map[string]float64, profile models.PreferenceProfile) []models.Product {
+	adjusted := make(map[string]float64, len(products))
+	for i, product := range products {
+		score, ok := scores[product.ID]
+		if !ok {
+			score = 1 / float64(i+1)
+		}
+		adjusted[product.ID] = score * (1 + personalizationBoost*preferenceAffinity(product, profile))
+	}
+
+	ranked := append([]models.Product(nil), products...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return adjusted[ranked[i].ID] > adjusted[ranked[j].ID]
+	})
+	return ranked
+}
+
+// personalizeRecommendations re-ranks recommendations the same way.
+func personalizeRecommendations(recommendations []models.Recommendation, profile models.PreferenceProfile) []models.Recommendation {
+	ranked := append([]models.Recommendation(nil), recommendations...)
+	for i := range ranked {
+		ranked[i].Score *= 1 + personalizationBoost*preferenceAffinity(ranked[i].Product, profile)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// UserPreferences returns copies of a shopper's stated preferences and
+// learned profile, the latter aged to now.
+func (ao *AgentOrchestrator) UserPreferences(userID string) (map[string]string, models.PreferenceProfile) {
+	userContext := ao.userContext(userID)
+
+	ao.mutex.Lock()
+	defer ao.mutex.Unlock()
+	decayProfile(&userContext.Learned, time.Now().UTC(), preferenceHalfLife())
+
+	preferences := make(map[string]string, len(userContext.Preferences))
+	for key, value := range userContext.Preferences {
+		preferences[key] = value
+	}
+	return preferences, copyProfile(userContext.Learned)
+}
+
+// SetUserPreferences replaces a shopper's stated preferences and, when
+// learned is not nil, their learned profile. A price band given without the
+// history behind it is treated as one observation spanning the band, so it
+// shifts gradually as new interest is recorded.
+func (ao *AgentOrchestrator) SetUserPreferences(userID string, preferences map[string]string, learned *models.PreferenceProfile) error {
+	if code := strings.ToUpper(preferences["currency"]); code != "" && !ao.SupportsCurrency(code) {
+		return fmt.Errorf("unsupported currency %q", code)
+	}
+	if learned != nil {
+		for _, weights := range []map[string]float64{learned.Categories, learned.Colors, learned.Sizes, learned.Brands} {
+			for key, weight := range weights {
+				if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+					return fmt.Errorf("weight for %q must be a non-negative number", key)
+				}
+			}
+		}
+		if band := learned.PriceBand; band != nil && (band.Min < 0 || band.Max < band.Min) {
+			return fmt.Errorf("price_band needs 0 <= min <= max")
+		}
+	}
+
+	userContext := ao.userContext(userID)
+	ao.mutex.Lock()
+	defer ao.mutex.Unlock()
+
+	userContext.Preferences = make(map[string]string, len(preferences))
+	for key, value := range preferences {
+		if key == "currency" {
+			value = strings.ToUpper(value)
+		}
+		userContext.Preferences[key] = value
+	}
+	if learned != nil {
+		profile := copyProfile(*learned)
+		profile.UpdatedAt = time.Now().UTC()
+		if band := profile.PriceBand; band != nil {
+			mean, spread := (band.Min+band.Max)/2, (band.Max-band.Min)/2
+			profile.PriceWeight, profile.PriceSum, profile.PriceSquares = 1, mean, mean*mean+spread*spread
+		}
+		userContext.Learned = profile
+	}
+	return nil
+}
+
+func copyProfile(profile models.PreferenceProfile) models.PreferenceProfile {
+	copyWeights := func(weights map[string]float64) map[string]float64 {
+		if weights == nil {
+			return nil
+		}
+		copied := make(map[string]float64, len(weights))
+		for key, weight := range weights {
+			copied[strings.ToLower(key)] = weight
+		}
+		return copied
+	}
+	copied := profile
+	copied.Categories = copyWeights(profile.Categories)
+	copied.Colors = copyWeights(profile.Colors)
+	copied.Sizes = copyWeights(profile.Sizes)
+	copied.Brands = copyWeights(profile.Brands)
+	if profile.PriceBand != nil {
+		band := *profile.PriceBand
+		copied.PriceBand = &band
+	}
+	return copied
+}
@@ -0,0 +1,108 @@
+package agents
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"celeste/models"
+)
+
+func TestDecayProfile(t *testing.T) {
+	updated := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	halfLife := 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    map[string]float64
+	}{
+		{"no time passed", 0, map[string]float64{"shoes": 1, "hats": 0.016}},
+		{"one half-life", halfLife, map[string]float64{"shoes": 0.5}},
+		{"two half-lives", 2 * halfLife, map[string]float64{"shoes": 0.25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := models.PreferenceProfile{
+				Categories:  map[string]float64{"shoes": 1, "hats": 0.016},
+				PriceWeight: 2,
+				UpdatedAt:   updated,
+			}
+			now := updated.Add(tt.elapsed)
+			decayProfile(&profile, now, halfLife)
+
+			if len(profile.Categories) != len(tt.want) {
+				t.Fatalf("categories = %v, want %v", profile.Categories, tt.want)
+			}
+			for key, weight := range tt.want {
+				if math.Abs(profile.Categories[key]-weight) > 1e-9 {
+					t.Errorf("%s = %v, want %v", key, profile.Categories[key], weight)
+				}
+			}
+			if want := 2 * tt.want["shoes"]; math.Abs(profile.PriceWeight-want) > 1e-9 {
+				t.Errorf("price weight = %v, want %v", profile.PriceWeight, want)
+			}
+			if !profile.UpdatedAt.Equal(now) {
+				t.Errorf("updated at = %v, want %v", profile.UpdatedAt, now)
+			}
+		})
+	}
+}
+
+func TestDecayProfileNew(t *testing.T) {
+	var profile models.PreferenceProfile
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	decayProfile(&profile, now, time.Hour)
+	if !profile.UpdatedAt.Equal(now) {
+		t.Errorf("updated at = %v, want %v", profile.UpdatedAt, now)
+	}
+}
+
+func TestSnapshotIsolatesLearning(t *testing.T) {
+	ao := NewAgentOrchestrator(nil)
+	userContext := ao.userContext("shopper")
+	userContext.Preferences["size"] = "M"
+
+	snapshot := ao.snapshot(userContext)
+	ao.learnFromInteraction(userContext, models.Product{ID: "p1", Brand: "Acme", Categories: []string{"shoes"}}, "purchase")
+	userContext.Preferences["size"] = "L"
+
+	if len(snapshot.Learned.Brands) != 0 || len(snapshot.Learned.Categories) != 0 {
+		t.Errorf("snapshot learned %+v after it was taken", snapshot.Learned)
+	}
+	if snapshot.Preferences["size"] != "M" {
+		t.Errorf("snapshot size = %q, want M", snapshot.Preferences["size"])
+	}
+	if userContext.Learned.Brands["acme"] == 0 {
+		t.Errorf("original did not learn the brand: %+v", userContext.Learned)
+	}
+}
+
+func TestPriceBand(t *testing.T) {
+	tests := []struct {
+		name     string
+		prices   []float64
+		min, max float64
+	}{
+		// A single price has no spread, so the band is a quarter of the
+		// mean either side
+		{"one price", []float64{100}, 75, 125},
+		{"close prices", []float64{98, 102}, 75, 125},
+		{"spread prices", []float64{50, 150}, 50, 150},
+		{"never below zero", []float64{10, 10, 10, 400}, 0, 276.37},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var profile models.PreferenceProfile
+			for _, price := range tt.prices {
+				profile.PriceWeight++
+				profile.PriceSum += price
+				profile.PriceSquares += price * price
+			}
+			band := priceBand(&profile, "EUR")
+			if band.Min != tt.min || band.Max != tt.max || band.Currency != "EUR" {
+				t.Errorf("band = %+v, want %v to %v EUR", band, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package agents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"celeste/models"
+)
+
+const maxNotificationsPerUser = 100
+
+var (
+	ErrAlertNotFound = errors.New("price alert not found")
+	ErrInvalidAlert  = errors.New("invalid price alert")
+)
+
+// alertsPath reads CELESTE_ALERTS_PATH, defaulting to data/priceAlerts.json.
+func alertsPath() string {
+	if path := os.Getenv("CELESTE_ALERTS_PATH"); path != "" {
+		return path
+	}
+	return "data/priceAlerts.json"
+}
+
+type alertsFile struct {
+	NextID        int                   `json:"next_id"`
+	Alerts        []models.PriceAlert   `json:"alerts"`
+	Notifications []models.Notification `json:"notifications"`
+}
+
+// PriceAlertStore keeps price alerts and notifications per user, saved to a
+// JSON file after every change.
+type PriceAlertStore struct {
+	path          string
+	alerts        map[string][]models.PriceAlert
+	notifications map[string][]models.Notification
+	nextID        int
+	mutex         sync.Mutex
+}
+
+// NewPriceAlertStore returns an empty store saved to path, or kept in
+// memory only when path is empty.
+func NewPriceAlertStore(path string) *PriceAlertStore {
+	return &PriceAlertStore{
+		path:          path,
+		alerts:        make(map[string][]models.PriceAlert),
+		notifications: make(map[string][]models.Notification),
+		nextID:        1,
+	}
+}
+
+// LoadPriceAlertStore loads the store saved at path, starting an empty one
+// if there is no file yet. A file that cannot be read is an error rather
+// than an empty store, which the next save would write over it.
+func LoadPriceAlertStore(path string) (*PriceAlertStore, error) {
+	store := NewPriceAlertStore(path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file alertsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for _, alert := range file.Alerts {
+		store.alerts[alert.UserID] = append(store.alerts[alert.UserID], alert)
+	}
+	for _, notification := range file.Notifications {
+		store.notifications[notification.UserID] = append(store.notifications[notification.UserID], notification)
+	}
+	store.nextID = max(file.NextID, 1)
+	return store, nil
+}
+
+func (ps *PriceAlertStore) Add(alert models.PriceAlert) (models.PriceAlert, error) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	alert.ID = fmt.Sprintf("alert_%d", ps.nextID)
+	ps.nextID++
+	alert.CreatedAt = time.Now().UTC()
+	ps.alerts[alert.UserID] = append(ps.alerts[alert.UserID], alert)
+	return alert, ps.save()
+}
+
+func (ps *PriceAlertStore) Alerts(userID string) []models.PriceAlert {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	return append([]models.PriceAlert{}, ps.alerts[userID]...)
+}
+
+func (ps *PriceAlertStore) Remove(userID, alertID string) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	alerts := ps.alerts[userID]
+	for i, alert := range alerts {
+		if alert.ID == alertID {
+			ps.alerts[userID] = append(alerts[:i:i], alerts[i+1:]...)
+			return ps.save()
+		}
+	}
+	return ErrAlertNotFound
+}
+
+// Reassign moves one user's alerts and notifications to another, as when
+// an anonymous session logs in.
+func (ps *PriceAlertStore) Reassign(fromUserID, toUserID string) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if len(ps.alerts[fromUserID]) == 0 && len(ps.notifications[fromUserID]) == 0 {
+		return nil
+	}
+	for _, alert := range ps.alerts[fromUserID] {
+		alert.UserID = toUserID
+		ps.alerts[toUserID] = append(ps.alerts[toUserID], alert)
+	}
+	for _, notification := range ps.notifications[fromUserID] {
+		notification.UserID = toUserID
+		ps.appendNotification(notification)
+	}
+	delete(ps.alerts, fromUserID)
+	delete(ps.notifications, fromUserID)
+	return ps.save()
+}
+
+// RemoveUser deletes a user's alerts and notifications.
+func (ps *PriceAlertStore) RemoveUser(userID string) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if len(ps.alerts[userID]) == 0 && len(ps.notifications[userID]) == 0 {
+		return nil
+	}
+	delete(ps.alerts, userID)
+	delete(ps.notifications, userID)
+	return ps.save()
+}
+
+// Pending lists every alert, across users, that has not fired yet.
+func (ps *PriceAlertStore) Pending() []models.PriceAlert {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	var pending []models.PriceAlert
+	for _, alerts := range ps.alerts {
+		for _, alert := range alerts {
+			if alert.TriggeredAt.IsZero() {
+				pending = append(pending, alert)
+			}
+		}
+	}
+	return pending
+}
+
+// Trigger marks an alert as fired and records its notification. It
+// returns false if the alert has since been removed or already fired.
+func (ps *PriceAlertStore) Trigger(alert models.PriceAlert, notification models.Notification) (models.Notification, bool, error) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	alerts := ps.alerts[alert.UserID]
+	for i := range alerts {
+		if alerts[i].ID != alert.ID || !alerts[i].TriggeredAt.IsZero() {
+			continue
+		}
+		alerts[i].TriggeredAt = notification.CreatedAt
+
+		notification.ID = fmt.Sprintf("notification_%d", ps.nextID)
+		ps.nextID++
+		ps.appendNotification(notification)
+		return notification, true, ps.save()
+	}
+	return notification, false, nil
+}
+
+// UpdateNotification replaces a stored notification, e.g. to record how
+// its webhook delivery went.
+func (ps *PriceAlertStore) UpdateNotification(notification models.Notification) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	for i, existing := range ps.notifications[notification.UserID] {
+		if existing.ID == notification.ID {
+			ps.notifications[notification.UserID][i] = notification
+			return ps.save()
+		}
+	}
+	return nil
+}
+
+// Notifications lists a user's notifications, newest first.
+func (ps *PriceAlertStore) Notifications(userID string) []models.Notification {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	stored := ps.notifications[userID]
+	notifications := make([]models.Notification, len(stored))
+	for i, notification := range stored {
+		notifications[len(stored)-1-i] = notification
+	}
+	return notifications
+}
+
+func (ps *PriceAlertStore) appendNotification(notification models.Notification) {
+	notifications := append(ps.notifications[notification.UserID], notification)
+	if len(notifications) > maxNotificationsPerUser {
+		notifications = notifications[len(notifications)-maxNotificationsPerUser:]
+	}
+	ps.notifications[notification.UserID] = notifications
+}
+
+// save writes the store to a temporary file and renames it into place, so
+// a failed write leaves the previous file intact; callers hold the mutex.
+func (ps *PriceAlertStore) save() error {
+	if ps.path == "" {
+		return nil
+	}
+
+	file := alertsFile{NextID: ps.nextID, Alerts: []models.PriceAlert{}, Notifications: []models.Notification{}}
+	for _, alerts := range ps.alerts {
+		file.Alerts = append(file.Alerts, alerts...)
+	}
+	for _, notifications := range ps.notifications {
+		file.Notifications = append(file.Notifications, notifications...)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ps.path), ".priceAlerts-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ps.path)
+}
+
+var priceAlertPattern = regexp.MustCompile(`\b(?:tell|let|notify|alert|ping|message) me\b.*?\b(?:when|if|once)\b(.*?)\b(?:drops?|falls?|goes|gets|is|comes)\s+(?:down\s+)?(?:below|under|to|beneath)\s+([$£€]?)\s*(\d+(?:\.\d{1,2})?)`)
+
+// Words that do not name a product in "tell me when the price of it drops".
+var alertSubjectFillers = map[string]bool{
+	"it": true, "this": true, "that": true, "one": true, "the": true,
+	"price": true, "of": true, "its": true, "cost": true, "they": true,
+}
+
+// priceAlertRequest is a "tell me when this drops below $50" chat message.
+type priceAlertRequest struct {
+	Subject string // product description, empty for "it"/"this"
+	Price   string // amount with its currency symbol, if one was given
+}
+
+func parsePriceAlert(query string) (priceAlertRequest, bool) {
+	match := priceAlertPattern.FindStringSubmatch(normalizeQuery(query))
+	if match == nil {
+		return priceAlertRequest{}, false
+	}
+
+	var subject []string
+	for _, token := range tokenize(match[1]) {
+		if !alertSubjectFillers[token] {
+			subject = append(subject, token)
+		}
+	}
+	return priceAlertRequest{
+		Subject: strings.Join(subject, " "),
+		Price:   match[2] + match[3],
+	}, true
+}
@@ -0,0 +1,49 @@
+package agents
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"celeste/models"
+)
+
+func TestPriceAlertStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "priceAlerts.json")
+
+	store, err := LoadPriceAlertStore(path)
+	if err != nil {
+		t.Fatalf("loading a missing file: %v", err)
+	}
+	alert, err := store.Add(models.PriceAlert{UserID: "alice", ProductID: "p1", Threshold: models.Money{CurrencyCode: "USD", Units: 50}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadPriceAlertStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts := loaded.Alerts("alice"); len(alerts) != 1 || alerts[0].ID != alert.ID {
+		t.Errorf("alerts = %+v, want %s", alerts, alert.ID)
+	}
+	if next, _ := loaded.Add(models.PriceAlert{UserID: "bob"}); next.ID == alert.ID {
+		t.Errorf("reused alert ID %s", next.ID)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("left temporary files behind: %v", entries)
+	}
+}
+
+func TestLoadPriceAlertStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "priceAlerts.json")
+	if err := os.WriteFile(path, []byte(`{"alerts": [`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPriceAlertStore(path); err == nil {
+		t.Error("loaded a corrupt file as an empty store")
+	}
+}
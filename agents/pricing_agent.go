@@ -0,0 +1,126 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"celeste/models"
+	"celeste/pricing"
+	"google.golang.org/genai"
+)
+
+type PricingAgent struct {
+	id           string
+	geminiClient *genai.Client
+	engine       *pricing.Engine
+}
+
+func NewPricingAgent(geminiClient *genai.Client) *PricingAgent {
+	return &PricingAgent{
+		id:           "pricing_agent",
+		geminiClient: geminiClient,
+		engine:       pricing.NewEngine(nil),
+	}
+}
+
+func (pa *PricingAgent) ID() string {
+	return pa.id
+}
+
+// Initialize loads the promotion rules. Without a promotions file every
+// product is quoted at its list price.
+func (pa *PricingAgent) Initialize(ctx context.Context) error {
+	path := pricing.DefaultPath()
+	promotions, err := pricing.LoadPromotions(path)
+	if os.IsNotExist(err) {
+		log.Printf("No promotions file at %s, quoting list prices", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("loading promotions: %v", err)
+	}
+
+	pa.engine = pricing.NewEngine(promotions)
+	log.Printf("Loaded %d promotions (%d active)", len(promotions), len(pa.engine.Active()))
+	return nil
+}
+
+func (pa *PricingAgent) Process(ctx context.Context, input models.AgentMessage) (*models.AgentResponse, error) {
+	products, ok := input.Data["products"].([]models.Product)
+	if !ok {
+		return nil, fmt.Errorf("no products to price")
+	}
+	quantities, _ := input.Data["quantities"].(map[string]int)
+	filters, _ := input.Data["filters"].(map[string]string)
+
+	quotes := make(map[string]models.PriceQuote, len(products))
+	onSale := 0
+	for _, product := range products {
+		quote := pa.Quote(product, quotedVariant(product, filters), quantities[product.ID])
+		if quote.Promotion != nil {
+			onSale++
+		}
+		quotes[product.ID] = quote
+	}
+
+	actions := []string{"Price alerts", "Compare alternatives"}
+	if onSale > 0 || len(pa.ActivePromotions()) > 0 {
+		actions = append([]string{"See deals"}, actions...)
+	}
+
+	return &models.AgentResponse{
+		ID:        input.ID,
+		FromAgent: pa.id,
+		Type:      "price_quotes",
+		Data: map[string]interface{}{
+			"quotes":            quotes,
+			"on_sale":           onSale,
+			"active_promotions": pa.ActivePromotions(),
+			"priced_at":         time.Now().Format(time.RFC3339),
+		},
+		NextActions: actions,
+		Success:     true,
+	}, nil
+}
+
+// Quote prices a quantity of a product, or of one of its variants, under
+// the current promotions.
+func (pa *PricingAgent) Quote(product models.Product, variant *models.Variant, quantity int) models.PriceQuote {
+	return pa.engine.Quote(product, variant, quantity)
+}
+
+// quotedVariant is the variant a search's size and colour filters pick out,
+// the cheapest if several match, as the price filters judge it. Without
+// those filters the product is quoted at its own price.
+func quotedVariant(product models.Product, filters map[string]string) *models.Variant {
+	if filters["size"] == "" && filters["color"] == "" {
+		return nil
+	}
+	var cheapest *models.Variant
+	for _, variant := range matchingVariants(product, filters["size"], filters["color"]) {
+		if cheapest == nil || priceValue(variantPrice(product, variant)) < priceValue(variantPrice(product, *cheapest)) {
+			cheapest = &variant
+		}
+	}
+	return cheapest
+}
+
+// ActivePromotions summarises the promotions running now.
+func (pa *PricingAgent) ActivePromotions() []models.PromotionSummary {
+	summaries := []models.PromotionSummary{}
+	for _, promotion := range pa.engine.Active() {
+		summaries = append(summaries, models.PromotionSummary{
+			ID:          promotion.ID,
+			Name:        promotion.Name,
+			Description: promotion.Description(),
+		})
+	}
+	return summaries
+}
+
+func (pa *PricingAgent) Shutdown(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+package agents
+
+import "testing"
+
+func TestQuotedVariant(t *testing.T) {
+	product := testVariantProduct()
+	tests := []struct {
+		filters map[string]string
+		want    string
+	}{
+		{nil, ""},
+		{map[string]string{"category": "boots"}, ""},
+		{map[string]string{"color": "black"}, "boot-bla-8"},
+		// Both size 9s match; the brown one has its own, lower price
+		{map[string]string{"size": "9"}, "boot-bro-9"},
+		{map[string]string{"size": "8", "color": "brown"}, ""},
+	}
+	for _, tt := range tests {
+		sku := ""
+		if variant := quotedVariant(product, tt.filters); variant != nil {
+			sku = variant.SKU
+		}
+		if sku != tt.want {
+			t.Errorf("quotedVariant(%v) = %q, want %q", tt.filters, sku, tt.want)
+		}
+	}
+
+	pa := NewPricingAgent(nil)
+	if quote := pa.Quote(product, quotedVariant(product, map[string]string{"size": "9"}), 2); quote.Final.Units != 90 || quote.SKU != "boot-bro-9" {
+		t.Errorf("quote = %+v, want two brown size 9s at 45", quote)
+	}
+}
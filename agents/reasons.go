@@ -0,0 +1,163 @@
+package agents
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"celeste/models"
+	"celeste/sizing"
+)
+
+// Reason codes. They are part of the API: the UI and QA match on them, so
+// existing codes must not change meaning.
+const (
+	ReasonSearchedFor         = "searched_for"
+	ReasonCustomersAlsoBought = "customers_also_bought"
+	ReasonSimilarTo           = "similar_to"
+	ReasonSavedSize           = "matches_saved_size"
+	ReasonFavouriteCategory   = "favourite_category"
+	ReasonFavouriteColor      = "favourite_color"
+	ReasonFavouriteBrand      = "favourite_brand"
+	ReasonPriceBand           = "in_price_band"
+	ReasonLowStock            = "low_stock"
+	ReasonOutOfStock          = "out_of_stock"
+	ReasonIntent              = "intent"
+	ReasonResultsFound        = "results_found"
+	ReasonSizedProducts       = "sized_products"
+	ReasonSeveralColors       = "several_colors"
+	ReasonReturningShopper    = "returning_shopper"
+	ReasonSpecialist          = "specialist"
+)
+
+// A learned preference counts as a favourite when it is at least this
+// share of the strongest of its kind and weighs at least as much as a
+// search filter, so one search does not make a favourite of every category.
+const (
+	favouriteShare     = 0.5
+	minFavouriteWeight = searchFilterWeight
+)
+
+// StockReasonSource explains a product's stock situation.
+type StockReasonSource interface {
+	StockReasons(product models.Product) []models.Reason
+}
+
+// preferenceReasons explains how a product matches what the shopper
+// searched for, their saved sizes and what they tend to like.
+func preferenceReasons(product models.Product, query string, userContext *models.UserContext) []models.Reason {
+	var reasons []models.Reason
+
+	queryTerms := make(map[string]bool)
+	for _, term := range analyze(query) {
+		queryTerms[term] = true
+	}
+	for _, category := range product.Categories {
+		terms := analyze(category)
+		matched := len(terms) > 0
+		for _, term := range terms {
+			matched = matched && queryTerms[term]
+		}
+		if matched {
+			reasons = append(reasons, models.Reason{Code: ReasonSearchedFor, Message: fmt.Sprintf("Because you searched for %s", category)})
+			break
+		}
+	}
+	if userContext == nil {
+		return reasons
+	}
+
+	for _, size := range savedSizes(userContext) {
+		if len(matchingVariants(product, size, "")) > 0 {
+			reasons = append(reasons, models.Reason{Code: ReasonSavedSize, Message: fmt.Sprintf("Comes in your size %s", size)})
+			break
+		}
+	}
+
+	learned := userContext.Learned
+	if category, ok := favourite(learned.Categories, product.Categories); ok {
+		reasons = append(reasons, models.Reason{Code: ReasonFavouriteCategory, Message: fmt.Sprintf("You often look at %s", category)})
+	}
+	colors := append(preferenceList(userContext.Preferences, "colors"), favourites(learned.Colors)...)
+	for _, color := range productColors(product) {
+		if containsFold(colors, color) {
+			reasons = append(reasons, models.Reason{Code: ReasonFavouriteColor, Message: fmt.Sprintf("Comes in %s, one of your colours", color)})
+			break
+		}
+	}
+	brands := append(preferenceList(userContext.Preferences, "brands"), favourites(learned.Brands)...)
+	if product.Brand != "" && containsFold(brands, product.Brand) {
+		reasons = append(reasons, models.Reason{Code: ReasonFavouriteBrand, Message: fmt.Sprintf("From %s, a brand you like", product.Brand)})
+	}
+	if band := learned.PriceBand; band != nil && band.Currency == product.PriceUsd.CurrencyCode {
+		if price := product.PriceUsd.Float64(); price >= band.Min && price <= band.Max {
+			reasons = append(reasons, models.Reason{Code: ReasonPriceBand, Message: fmt.Sprintf("Within your usual price range of %.2f to %.2f %s", band.Min, band.Max, band.Currency)})
+		}
+	}
+	return reasons
+}
+
+// savedSizes are the sizes in the shopper's fit profile that name a size
+// label directly ("M", "32"), then the sizes they most often pick.
+func savedSizes(userContext *models.UserContext) []string {
+	var sizes []string
+	for _, group := range sizing.Groups {
+		if system, size := sizing.ParseSize(userContext.Preferences[sizing.SizeKey(group)]); size != "" && (system == "" || system == sizing.SystemInt) {
+			sizes = append(sizes, size)
+		}
+	}
+	return append(sizes, favourites(userContext.Learned.Sizes)...)
+}
+
+// favourites lists the learned values weighted at least favouriteShare of
+// the strongest, strongest first.
+func favourites(weights map[string]float64) []string {
+	strongest := 0.0
+	for _, weight := range weights {
+		strongest = max(strongest, weight)
+	}
+	var values []string
+	for value, weight := range weights {
+		if weight >= favouriteShare*strongest && weight >= minFavouriteWeight {
+			values = append(values, value)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if weights[values[i]] != weights[values[j]] {
+			return weights[values[i]] > weights[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	return values
+}
+
+// favourite returns the first of values that is a learned favourite.
+func favourite(weights map[string]float64, values []string) (string, bool) {
+	for _, preferred := range favourites(weights) {
+		for _, value := range values {
+			if strings.EqualFold(value, preferred) {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// addActionReason records why an action was suggested, once per code.
+func addActionReason(reasons map[string][]models.Reason, action string, reason models.Reason) {
+	for _, existing := range reasons[action] {
+		if existing.Code == reason.Code {
+			return
+		}
+	}
+	reasons[action] = append(reasons[action], reason)
+}
@@ -3,21 +3,44 @@ package agents
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"celeste/models"
 	"google.golang.org/genai"
 )
 
+const (
+	maxRecommendedProducts = 5
+	maxRecommendationSeeds = 3
+)
+
 type RecommendationAgent struct {
 	id           string
 	geminiClient *genai.Client
+	catalog      ProductCatalog
+	interactions *InteractionLog
+	similarity   *ItemSimilarity
+	content      *contentModel
+	modelMutex   sync.RWMutex
+	stopRebuild  chan struct{}
+	// Signals a new catalogue version, for the content model to be rebuilt
+	catalogChanged chan struct{}
+	stockReasons   StockReasonSource
 }
 
-func NewRecommendationAgent(geminiClient *genai.Client) *RecommendationAgent {
+func NewRecommendationAgent(geminiClient *genai.Client, catalog ProductCatalog) *RecommendationAgent {
 	return &RecommendationAgent{
 		id:           "recommendation_agent",
 		geminiClient: geminiClient,
+		catalog:      catalog,
+		interactions: NewInteractionLog(""),
+		similarity:   BuildItemSimilarity(nil),
+		content:      newContentModel(nil),
+
+		catalogChanged: make(chan struct{}, 1),
 	}
 }
 
@@ -25,48 +48,217 @@ func (ra *RecommendationAgent) ID() string {
 	return ra.id
 }
 
+// SetStockReasonSource lets recommended products say when they are running
+// out. Without one, recommendations carry no stock reasons.
+func (ra *RecommendationAgent) SetStockReasonSource(source StockReasonSource) {
+	ra.stockReasons = source
+}
+
+// Initialize loads the interaction history, builds the collaborative
+// filtering model from it and the content model from the catalogue, and
+// starts rebuilding them in the background.
 func (ra *RecommendationAgent) Initialize(ctx context.Context) error {
+	ra.interactions = NewInteractionLog(InteractionsPath())
+	ra.rebuild()
+	ra.rebuildContent()
+
+	ra.stopRebuild = make(chan struct{})
+	go ra.rebuildPeriodically(recommenderInterval(), ra.stopRebuild)
 	return nil
 }
 
+// RecordInteraction adds an interaction to the history. The model picks it
+// up at its next rebuild.
+func (ra *RecommendationAgent) RecordInteraction(interaction models.Interaction) (models.Interaction, error) {
+	return ra.interactions.Record(interaction)
+}
+
+func (ra *RecommendationAgent) rebuild() {
+	model := BuildItemSimilarity(ra.interactions.All())
+
+	ra.modelMutex.Lock()
+	ra.similarity = model
+	ra.modelMutex.Unlock()
+	log.Printf("Item similarity built from %d interactions (%d users, %d products)", model.Interactions, model.Users, model.Products)
+}
+
+func (ra *RecommendationAgent) rebuildContent() {
+	model := newContentModel(ra.catalog.Products())
+
+	ra.modelMutex.Lock()
+	ra.content = model
+	ra.modelMutex.Unlock()
+}
+
+// CatalogChanged asks for the content model to be rebuilt from the new
+// catalogue. It never blocks, so it can be a catalogue change listener.
+func (ra *RecommendationAgent) CatalogChanged() {
+	select {
+	case ra.catalogChanged <- struct{}{}:
+	default:
+	}
+}
+
+// rebuildPeriodically rebuilds the collaborative model on a timer when
+// interactions have been recorded since the last build, and the content
+// model when the catalogue changes.
+func (ra *RecommendationAgent) rebuildPeriodically(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ra.catalogChanged:
+			ra.rebuildContent()
+		case <-ticker.C:
+			if ra.interactions.Len() != ra.Similarity().Interactions {
+				ra.rebuild()
+			}
+		}
+	}
+}
+
+// Similarity returns the current collaborative filtering model.
+func (ra *RecommendationAgent) Similarity() *ItemSimilarity {
+	ra.modelMutex.RLock()
+	defer ra.modelMutex.RUnlock()
+	return ra.similarity
+}
+
+// RecommendProducts suggests products related to the top results: first
+// what shoppers interested in them also bought, then, for results the
+// interaction history says little about, the most similar products in the
+// catalogue. Products already shown or in the cart are left out, and the
+// rest are re-ranked by the shopper's learned preferences. Each carries the
+// reasons it was suggested.
+func (ra *RecommendationAgent) RecommendProducts(products []models.Product, userContext *models.UserContext) []models.Recommendation {
+	recommended, _ := ra.recommendProducts(products, userContext)
+	return recommended
+}
+
+// recommendProducts also returns the order the recommendations had before
+// personalization.
+func (ra *RecommendationAgent) recommendProducts(products []models.Product, userContext *models.UserContext) ([]models.Recommendation, models.Ranking) {
+	seeds := products[:min(len(products), maxRecommendationSeeds)]
+	seedIDs := make([]string, len(seeds))
+	for i, product := range seeds {
+		seedIDs[i] = product.ID
+	}
+	exclude := make(map[string]bool)
+	for _, product := range products {
+		exclude[product.ID] = true
+	}
+	if userContext != nil {
+		for _, id := range userContext.CartItems {
+			exclude[id] = true
+		}
+	}
+
+	recommended := ra.CustomersAlsoBought(seedIDs, exclude, maxRecommendedProducts)
+	if len(recommended) < maxRecommendedProducts && len(seeds) > 0 {
+		for _, recommendation := range recommended {
+			exclude[recommendation.Product.ID] = true
+		}
+		ra.modelMutex.RLock()
+		content := ra.content
+		ra.modelMutex.RUnlock()
+		related := content.related(seeds, content.products, exclude, maxRecommendedProducts-len(recommended))
+		recommended = append(recommended, related...)
+	}
+	ranking := models.Ranking{Baseline: recommendationIDs(recommended)}
+	if userContext != nil {
+		recommended = personalizeRecommendations(recommended, userContext.Learned)
+	}
+	ranking.Personalized = recommendationIDs(recommended)
+	for i := range recommended {
+		product := recommended[i].Product
+		recommended[i].Reasons = append(recommended[i].Reasons, preferenceReasons(product, "", userContext)...)
+		if ra.stockReasons != nil {
+			recommended[i].Reasons = append(recommended[i].Reasons, ra.stockReasons.StockReasons(product)...)
+		}
+	}
+	return recommended, ranking
+}
+
+// ProductReasons explains how each product matches the query and what the
+// shopper is known to like, by product ID. Products with nothing to say are
+// left out.
+func (ra *RecommendationAgent) ProductReasons(products []models.Product, query string, userContext *models.UserContext) map[string][]models.Reason {
+	reasons := make(map[string][]models.Reason)
+	for _, product := range products {
+		if productReasons := preferenceReasons(product, query, userContext); len(productReasons) > 0 {
+			reasons[product.ID] = productReasons
+		}
+	}
+	return reasons
+}
+
+// CustomersAlsoBought recommends products that shoppers interested in the
+// seed products were also interested in, leaving out the seeds and the
+// excluded products.
+func (ra *RecommendationAgent) CustomersAlsoBought(seeds []string, exclude map[string]bool, limit int) []models.Recommendation {
+	skip := make(map[string]bool, len(seeds)+len(exclude))
+	for id := range exclude {
+		skip[id] = true
+	}
+	for _, id := range seeds {
+		skip[id] = true
+	}
+
+	recommendations := []models.Recommendation{}
+	for _, n := range ra.Similarity().similar(seeds, skip, limit*2) {
+		product, ok := ra.catalog.Product(n.productID)
+		if !ok {
+			continue
+		}
+		recommendation := models.Recommendation{
+			Product: product,
+			Score:   n.score,
+			Source:  "collaborative",
+		}
+		if seed, ok := ra.catalog.Product(n.via); ok {
+			recommendation.Reasons = []models.Reason{{Code: ReasonCustomersAlsoBought, Message: fmt.Sprintf("Shoppers who liked %s also bought this", seed.Name)}}
+		}
+		recommendations = append(recommendations, recommendation)
+		if len(recommendations) == limit {
+			break
+		}
+	}
+	return recommendations
+}
+
 func (ra *RecommendationAgent) Process(ctx context.Context, input models.AgentMessage) (*models.AgentResponse, error) {
 	searchResults, ok := input.Data["search_results"].(map[string]interface{})
 	if !ok {
 		return nil, fmt.Errorf("no search results for recommendations")
 	}
 
-	inventoryInfo, _ := input.Data["inventory_info"].(map[string]interface{})
 	userContext := input.Context
+	actions, actionReasons := ra.generateNextActions(searchResults, userContext)
 
-	recommendations := ra.generatePersonalizedRecommendations(ctx, searchResults, inventoryInfo, userContext)
-	actions := ra.generateNextActions(searchResults, userContext)
+	products, _ := searchResults["products"].([]models.Product)
+	query, _ := searchResults["query"].(string)
+	recommended, ranking := ra.recommendProducts(products, userContext)
 
 	return &models.AgentResponse{
 		ID:        input.ID,
 		FromAgent: ra.id,
 		Type:      "personalized_recommendations",
 		Data: map[string]interface{}{
-			"recommendations":       recommendations,
-			"actions":               actions,
-			"personalization_score": ra.calculatePersonalizationScore(userContext),
+			"actions":                actions,
+			"personalization_score":  personalizationScore(ranking),
+			"recommended_products":   recommended,
+			"recommendation_ranking": ranking,
+			"product_reasons":        ra.ProductReasons(products, query, userContext),
+			"action_reasons":         actionReasons,
 		},
 		NextActions: actions,
 		Success:     true,
 	}, nil
 }
 
-func (ra *RecommendationAgent) generatePersonalizedRecommendations(ctx context.Context, searchResults, inventoryInfo map[string]interface{}, userContext *models.UserContext) []string {
-	intent, _ := searchResults["intent"].(string)
-
-	baseRecommendations := ra.getBaseRecommendations(intent)
-
-	if userContext != nil && len(userContext.History) > 0 {
-		return ra.personalizeRecommendations(baseRecommendations, userContext)
-	}
-
-	return baseRecommendations
-}
-
 func (ra *RecommendationAgent) getBaseRecommendations(intent string) []string {
 	recommendations := map[string][]string{
 		"product_search":    {"View similar items", "Add to cart", "Compare prices"},
@@ -83,86 +275,105 @@ func (ra *RecommendationAgent) getBaseRecommendations(intent string) []string {
 	return []string{"Browse categories", "Get recommendations", "Contact support"}
 }
 
-func (ra *RecommendationAgent) personalizeRecommendations(baseRecs []string, userContext *models.UserContext) []string {
-	personalized := make([]string, 0, len(baseRecs))
+// intentSuggestions are the suggestions for an intent that are relevant to
+// the shopper, or all of them when none is.
+func (ra *RecommendationAgent) intentSuggestions(intent string, userContext *models.UserContext) []string {
+	suggestions := ra.getBaseRecommendations(intent)
+	if userContext == nil {
+		return suggestions
+	}
 
-	for _, rec := range baseRecs {
-		if ra.isRelevantToUser(rec, userContext) {
-			personalized = append(personalized, rec)
+	relevant := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		if ra.isRelevantToUser(suggestion, userContext) {
+			relevant = append(relevant, suggestion)
 		}
 	}
-
-	if len(personalized) == 0 {
-		return baseRecs
+	if len(relevant) == 0 {
+		return suggestions
 	}
-
-	return personalized
+	return relevant
 }
 
+// isRelevantToUser keeps suggestions about style, price, size or occasions
+// for shoppers whose recent queries touched on them. Other suggestions are
+// always relevant.
 func (ra *RecommendationAgent) isRelevantToUser(recommendation string, userContext *models.UserContext) bool {
 	if len(userContext.History) == 0 {
 		return true
 	}
 
-	recentQueries := strings.Join(userContext.History, " ")
+	recentQueries := strings.ToLower(strings.Join(userContext.History, " "))
+	recommendation = strings.ToLower(recommendation)
 
 	relevanceMap := map[string][]string{
-		"style":    {"style", "outfit", "look", "fashion"},
-		"price":    {"price", "cost", "cheap", "expensive", "deal"},
+		"style":    {"style", "outfit", "look", "fashion", "wear"},
+		"price":    {"price", "cost", "cheap", "expensive", "deal", "sale", "discount"},
 		"size":     {"size", "fit", "large", "small", "medium"},
-		"occasion": {"wedding", "party", "work", "casual", "formal"},
+		"occasion": {"wedding", "party", "work", "casual", "formal", "occasion"},
 	}
 
 	for category, keywords := range relevanceMap {
-		if strings.Contains(recommendation, category) {
-			for _, keyword := range keywords {
-				if strings.Contains(strings.ToLower(recentQueries), keyword) {
-					return true
-				}
+		if !strings.Contains(recommendation, category) {
+			continue
+		}
+		for _, keyword := range keywords {
+			if strings.Contains(recentQueries, keyword) {
+				return true
 			}
 		}
+		return false
 	}
 
 	return true
 }
 
-func (ra *RecommendationAgent) generateNextActions(searchResults map[string]interface{}, userContext *models.UserContext) []string {
+// generateNextActions suggests what the shopper could do next, with the
+// reasons for each action.
+func (ra *RecommendationAgent) generateNextActions(searchResults map[string]interface{}, userContext *models.UserContext) ([]string, map[string][]models.Reason) {
 	actions := []string{}
+	reasons := make(map[string][]models.Reason)
+	suggest := func(reason models.Reason, suggested ...string) {
+		for _, action := range suggested {
+			actions = append(actions, action)
+			addActionReason(reasons, action, reason)
+		}
+	}
 
 	products, ok := searchResults["products"].([]models.Product)
 	if ok && len(products) > 0 {
-		actions = append(actions, "Add to cart", "Save to wishlist")
+		suggest(models.Reason{Code: ReasonResultsFound, Message: fmt.Sprintf("%d products match your search", len(products))}, "Add to cart", "Save to wishlist")
 	}
 
-	if userContext != nil && len(userContext.History) > 2 {
-		actions = append(actions, "View browsing history", "Get personalized suggestions")
+	sized, multiColor := false, false
+	for _, product := range products {
+		sized = sized || len(productSizes(product)) > 0
+		multiColor = multiColor || len(productColors(product)) > 1
 	}
-
-	actions = append(actions, "Continue shopping", "Get styling advice")
-
-	return actions
-}
-
-func (ra *RecommendationAgent) calculatePersonalizationScore(userContext *models.UserContext) float64 {
-	if userContext == nil {
-		return 0.0
+	if sized {
+		suggest(models.Reason{Code: ReasonSizedProducts, Message: "These products come in several sizes"}, "Get size guidance")
 	}
-
-	score := 0.0
-
-	if len(userContext.History) > 0 {
-		score += 0.3
+	if multiColor {
+		suggest(models.Reason{Code: ReasonSeveralColors, Message: "Some of these products come in more than one colour"}, "See other colours")
 	}
-	if len(userContext.Preferences) > 0 {
-		score += 0.4
+
+	if userContext != nil && len(userContext.History) > 2 {
+		suggest(models.Reason{Code: ReasonReturningShopper, Message: fmt.Sprintf("You have made %d searches recently", len(userContext.History))}, "View browsing history", "Get personalized suggestions")
 	}
-	if len(userContext.CartItems) > 0 {
-		score += 0.3
+
+	intent, _ := searchResults["intent"].(string)
+	if intent == "" {
+		intent = "general"
 	}
+	suggest(models.Reason{Code: ReasonIntent, Message: fmt.Sprintf("Suggested for %s requests", strings.ReplaceAll(intent, "_", " "))}, ra.intentSuggestions(intent, userContext)...)
 
-	return score
+	return actions, reasons
 }
 
 func (ra *RecommendationAgent) Shutdown(ctx context.Context) error {
+	if ra.stopRebuild != nil {
+		close(ra.stopRebuild)
+		ra.stopRebuild = nil
+	}
 	return nil
 }
@@ -0,0 +1,115 @@
+package agents
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"celeste/models"
+)
+
+// staticCatalog is a ProductCatalog over a list that tests can change.
+type staticCatalog struct {
+	products []models.Product
+	mutex    sync.Mutex
+}
+
+func (sc *staticCatalog) Products() []models.Product {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	return append([]models.Product(nil), sc.products...)
+}
+
+func (sc *staticCatalog) Product(id string) (models.Product, bool) {
+	for _, product := range sc.Products() {
+		if product.ID == id {
+			return product, true
+		}
+	}
+	return models.Product{}, false
+}
+
+func (sc *staticCatalog) add(product models.Product) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.products = append(sc.products, product)
+}
+
+func TestContentModelRebuiltOnCatalogChange(t *testing.T) {
+	seed := testProduct("b1", "Leather Hiking Boot", 120, "shoes", "boots")
+	catalog := &staticCatalog{products: []models.Product{seed, testProduct("h1", "Wool Hat", 20, "accessories")}}
+	ra := NewRecommendationAgent(nil, catalog)
+	ra.rebuildContent()
+
+	recommended := func() []string {
+		return recommendationIDs(ra.RecommendProducts([]models.Product{seed}, nil))
+	}
+	if ids := recommended(); len(ids) != 0 {
+		t.Fatalf("recommended %v with nothing similar in the catalogue", ids)
+	}
+
+	// The model is kept between requests, so a new product only shows up
+	// once the catalogue change has been signalled
+	catalog.add(testProduct("b2", "Suede Hiking Boot", 110, "shoes", "boots"))
+	if ids := recommended(); len(ids) != 0 {
+		t.Fatalf("recommended %v before the catalogue change was signalled", ids)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go ra.rebuildPeriodically(time.Hour, stop)
+	ra.CatalogChanged()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if ids := recommended(); len(ids) == 1 && ids[0] == "b2" {
+			return
+		}
+	}
+	t.Errorf("recommended %v after the catalogue changed, want [b2]", recommended())
+}
+
+func TestIsRelevantToUser(t *testing.T) {
+	ra := NewRecommendationAgent(nil, &staticCatalog{})
+	tests := []struct {
+		suggestion string
+		history    []string
+		want       bool
+	}{
+		{"Get style guide", nil, true},
+		{"Get style guide", []string{"black boots"}, false},
+		{"Get style guide", []string{"black boots", "what OUTFIT goes with them"}, true},
+		{"Compare prices", []string{"black boots"}, false},
+		{"Compare prices", []string{"any boots on sale"}, true},
+		{"Size chart", []string{"does it fit large"}, true},
+		{"Size chart", []string{"leather boots"}, false},
+		// Suggestions about nothing in particular are always relevant
+		{"Add to cart", []string{"leather boots"}, true},
+	}
+	for _, tt := range tests {
+		if got := ra.isRelevantToUser(tt.suggestion, &models.UserContext{History: tt.history}); got != tt.want {
+			t.Errorf("isRelevantToUser(%q, %q) = %v, want %v", tt.suggestion, tt.history, got, tt.want)
+		}
+	}
+}
+
+func TestIntentSuggestions(t *testing.T) {
+	ra := NewRecommendationAgent(nil, &staticCatalog{})
+	searchResults := map[string]interface{}{"intent": "price_inquiry"}
+
+	actions, _ := ra.generateNextActions(searchResults, &models.UserContext{History: []string{"leather boots"}})
+	if slices.Contains(actions, "Price alerts") || !slices.Contains(actions, "See deals") {
+		t.Errorf("actions for a shopper not asking about price = %v", actions)
+	}
+	actions, _ = ra.generateNextActions(searchResults, &models.UserContext{History: []string{"cheap boots"}})
+	if !slices.Contains(actions, "Price alerts") {
+		t.Errorf("actions for a shopper asking about price = %v, want Price alerts", actions)
+	}
+
+	got := ra.intentSuggestions("style_advice", &models.UserContext{History: []string{"boots"}})
+	if want := []string{"See outfit suggestions"}; !slices.Equal(got, want) {
+		t.Errorf("style suggestions = %v, want %v", got, want)
+	}
+	if got := ra.intentSuggestions("style_advice", nil); len(got) != 3 {
+		t.Errorf("suggestions without a context = %v, want all three", got)
+	}
+}
@@ -2,47 +2,132 @@ package agents
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"celeste/catalog"
 	"celeste/models"
 	"google.golang.org/genai"
 )
 
+const (
+	// Local predictions at or above this confidence skip the LLM call.
+	intentPreClassifyThreshold = 0.8
+	synonymWeight              = 0.5
+	fuzzyEditPenalty           = 0.2
+	// Share of the hybrid score that comes from BM25; the rest is vector similarity.
+	lexicalWeight = 0.7
+)
+
 type SearchAgent struct {
-	id           string
-	geminiClient *genai.Client
-	catalog      []models.Product
+	id            string
+	geminiClient  *genai.Client
+	store         catalog.Store
+	catalog       []models.Product
+	catalogMutex  sync.RWMutex
+	writeMutex    sync.Mutex
+	status        CatalogStatus
+	modTime       time.Time
+	stopWatch     chan struct{}
+	index         *SearchIndex
+	vectors       *VectorIndex
+	minSimilarity float64
+	availability  AvailabilitySource
+	onChange      func() // called after each new catalogue version; must not block
+	synonyms      SynonymDictionary
+	fuzzy         FuzzyConfig
+	classifier    *IntentClassifier
+	intentMetrics IntentMetrics
+	metricsMutex  sync.Mutex
 }
 
 func NewSearchAgent(geminiClient *genai.Client) *SearchAgent {
 	return &SearchAgent{
 		id:           "search_agent",
 		geminiClient: geminiClient,
+		store:        catalog.NewFileStore(catalog.DefaultPath()),
+		classifier:   NewIntentClassifier(),
+		fuzzy:        DefaultFuzzyConfig(),
 	}
 }
 
+func (sa *SearchAgent) SetAvailabilitySource(source AvailabilitySource) {
+	sa.availability = source
+}
+
+// SetChangeListener registers a function called whenever a new catalogue
+// version is served, whether from an edit, an import or a reload.
+func (sa *SearchAgent) SetChangeListener(listener func()) {
+	sa.onChange = listener
+}
+
 func (sa *SearchAgent) ID() string {
 	return sa.id
 }
 
 func (sa *SearchAgent) Initialize(ctx context.Context) error {
-	data, err := os.ReadFile("data/itemCatalogue.json")
+	snapshot, err := sa.store.Load()
 	if err != nil {
 		return err
 	}
-
-	var catalog struct {
-		Products []models.Product `json:"products"`
+	if err := prepareCatalog(snapshot.Products); err != nil {
+		return err
 	}
 
-	if err := json.Unmarshal(data, &catalog); err != nil {
+	sa.catalog = snapshot.Products
+	sa.index = NewSearchIndex(sa.catalog)
+	sa.recordSnapshot(snapshot)
+
+	if err := sa.buildVectorIndex(ctx); err != nil {
 		return err
 	}
 
-	sa.catalog = catalog.Products
+	if interval := catalogPollInterval(); interval > 0 {
+		sa.stopWatch = make(chan struct{})
+		go sa.watchCatalog(interval, sa.stopWatch)
+	}
+
+	synonyms, err := LoadSynonyms(synonymsPath())
+	if err != nil {
+		log.Printf("Synonym dictionary unavailable, searching without expansion: %v", err)
+	}
+	sa.synonyms = synonyms
+
+	if err := sa.classifier.LoadTrainingData(intentTrainingPath()); err != nil {
+		log.Printf("Intent training data unavailable, using keyword rules only: %v", err)
+	}
+	return nil
+}
+
+// buildVectorIndex embeds the catalogue with the embedder chosen by
+// CELESTE_EMBEDDER ("local" by default, or "gemini"), falling back to the
+// local model when Gemini embeddings are unavailable. Embeddings are cached
+// next to the catalogue file.
+func (sa *SearchAgent) buildVectorIndex(ctx context.Context) error {
+	vectorPath := filepath.Join(filepath.Dir(catalog.DefaultPath()), "productEmbeddings.json")
+
+	if os.Getenv("CELESTE_EMBEDDER") == "gemini" && sa.geminiClient != nil {
+		sa.vectors = NewVectorIndex(NewGeminiEmbedder(sa.geminiClient), vectorPath)
+		sa.minSimilarity = 0.6
+		err := sa.vectors.Build(ctx, sa.catalog)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Gemini embeddings unavailable, using local embeddings: %v", err)
+	}
+
+	sa.vectors = NewVectorIndex(NewHashingEmbedder(256), vectorPath)
+	sa.minSimilarity = 0.25
+	if err := sa.vectors.Build(ctx, sa.catalog); err != nil {
+		log.Printf("Failed to persist product embeddings: %v", err)
+	}
 	return nil
 }
 
@@ -52,27 +137,140 @@ func (sa *SearchAgent) Process(ctx context.Context, input models.AgentMessage) (
 		return nil, fmt.Errorf("invalid query format")
 	}
 
-	intent, err := sa.analyzeIntent(ctx, query)
+	opts, _ := input.Data["options"].(models.SearchOptions)
+	opts, err := ResolveSearchOptions(opts)
 	if err != nil {
-		intent = "general_search"
+		return nil, err
 	}
 
-	products := sa.searchProducts(query)
+	sa.catalogMutex.RLock()
+	searchQuery, filters := query, opts.Filters
+	ref, referenced := reference{}, false
+	if input.Type != "catalog_search" {
+		ref, referenced = sa.resolveReference(query, input.Context)
+		if !referenced {
+			searchQuery, filters = sa.resolveRefinement(query, opts.Filters, input.Context)
+		}
+	}
+	sa.catalogMutex.RUnlock()
+
+	// Embedding the query is a network call, so it is made without holding
+	// the catalogue lock that writes and reloads wait on.
+	var similarities map[string]float64
+	if !referenced {
+		similarities = sa.querySimilarities(ctx, searchQuery)
+	}
+
+	sa.catalogMutex.RLock()
+	var matches []models.ScoredProduct
+	var suggestion string
+	if referenced {
+		// A follow-up about earlier results narrows those, in the order they
+		// were shown, and leaves the previous search in place for refinements
+		searchQuery, filters = input.Context.LastQuery, ref.filters
+		for key, value := range opts.Filters {
+			filters[key] = value
+		}
+		for i, id := range ref.products {
+			if doc, ok := sa.index.docs[id]; ok {
+				matches = append(matches, models.ScoredProduct{Product: doc.product, Score: float64(len(ref.products) - i)})
+			}
+		}
+	} else {
+		matches, suggestion = sa.searchProducts(searchQuery, similarities)
+	}
+	results := sa.applyFilters(matches, filters)
+	facets := sa.computeFacets(results)
+	page, nextCursor := sa.paginate(results, opts)
+	sa.catalogMutex.RUnlock()
+
+	products := make([]models.Product, len(page))
+	scores := make(map[string]float64, len(page))
+	for i, result := range page {
+		products[i] = result.Product
+		scores[result.Product.ID] = result.Score
+	}
+
+	data := map[string]interface{}{
+		"products":      products,
+		"scores":        scores,
+		"total_matches": len(results),
+		"next_cursor":   nextCursor,
+		"facets":        facets,
+		"did_you_mean":  suggestion,
+		"filters":       filters,
+		"options":       opts,
+		"query":         searchQuery,
+	}
+	if referenced {
+		data["referenced_products"] = ref.products
+	}
+
+	// Plain catalogue searches skip intent analysis and its LLM call.
+	if input.Type != "catalog_search" {
+		prediction := sa.classifyIntent(ctx, query)
+		data["intent"] = prediction.Intent
+		data["intent_confidence"] = prediction.Confidence
+		data["intent_source"] = prediction.Source
+	}
 
 	return &models.AgentResponse{
-		ID:        input.ID,
-		FromAgent: sa.id,
-		Type:      "search_results",
-		Data: map[string]interface{}{
-			"products": products,
-			"intent":   intent,
-			"query":    query,
-		},
+		ID:          input.ID,
+		FromAgent:   sa.id,
+		Type:        "search_results",
+		Data:        data,
 		NextActions: []string{"check_inventory", "get_recommendations"},
 		Success:     true,
 	}, nil
 }
 
+// classifyIntent runs the local classifier first and only consults the LLM
+// when the local prediction is not confident enough. Invalid or failed LLM
+// answers fall back to the local prediction.
+func (sa *SearchAgent) classifyIntent(ctx context.Context, query string) IntentPrediction {
+	local := sa.classifier.Classify(query)
+
+	sa.metricsMutex.Lock()
+	sa.intentMetrics.Classified++
+	sa.metricsMutex.Unlock()
+
+	if local.Confidence >= intentPreClassifyThreshold {
+		sa.metricsMutex.Lock()
+		sa.intentMetrics.PreClassified++
+		sa.metricsMutex.Unlock()
+		return local
+	}
+
+	intent, err := sa.analyzeIntent(ctx, query)
+
+	sa.metricsMutex.Lock()
+	defer sa.metricsMutex.Unlock()
+	sa.intentMetrics.LLMCalls++
+
+	if err == nil && !isValidIntent(intent) {
+		err = fmt.Errorf("unknown classification %q", intent)
+	}
+	if err != nil {
+		sa.intentMetrics.LLMFailures++
+		log.Printf("Intent analysis failed, using local classifier: %v", err)
+		return local
+	}
+
+	sa.intentMetrics.recordComparison(intent, local.Intent)
+	return IntentPrediction{
+		Intent:     intent,
+		Confidence: local.Scores[intent],
+		Source:     "llm",
+		Scores:     local.Scores,
+	}
+}
+
+func (sa *SearchAgent) IntentMetrics() IntentMetrics {
+	sa.metricsMutex.Lock()
+	defer sa.metricsMutex.Unlock()
+	return sa.intentMetrics.snapshot()
+}
+
 func (sa *SearchAgent) analyzeIntent(ctx context.Context, query string) (string, error) {
 	prompt := fmt.Sprintf(`Analyze this query and return one classification:
 Query: "%s"
@@ -81,63 +279,179 @@ Classifications: product_search, style_advice, price_inquiry, size_help, occasio
 
 Return only the classification.`, query)
 
-	resp, err := sa.geminiClient.Models.GenerateContent(ctx, "gemini-2.5-flash", genai.Text(prompt), nil)
+	resp, err := generate(ctx, sa.geminiClient, prompt)
 	if err != nil {
 		return "", err
 	}
 
-	return strings.TrimSpace(resp.Text()), nil
+	return strings.Trim(strings.ToLower(strings.TrimSpace(resp.Text())), "`.\"' "), nil
 }
 
-func (sa *SearchAgent) searchProducts(query string) []models.Product {
-	queryLower := strings.ToLower(query)
-	var matches []models.Product
+// resolveRefinement turns follow-ups such as "just show the leather ones" or
+// "under $50" into filters. A query that only refines re-runs the previous
+// search with the combined filters; otherwise the filter phrases are removed
+// from the query and applied to the new search.
+func (sa *SearchAgent) resolveRefinement(query string, explicit map[string]string, userContext *models.UserContext) (string, map[string]string) {
+	remaining, refinement, refinesPrevious := sa.parseRefinement(query)
 
-	synonyms := map[string][]string{
-		"shoes": {"boots", "trainers", "footwear"},
-		"top":   {"shirt", "tank", "clothing"},
-		"bag":   {"tote", "handbag", "accessory"},
-		"dress": {"gown", "outfit", "clothing"},
+	filters := make(map[string]string)
+	if refinesPrevious && userContext != nil && userContext.LastQuery != "" {
+		query = userContext.LastQuery
+		if refinement != nil {
+			for key, value := range userContext.ActiveFilters {
+				filters[key] = value
+			}
+		}
+	} else if len(refinement) > 0 {
+		query = remaining
 	}
 
-	for _, product := range sa.catalog {
-		score := 0
+	for key, value := range refinement {
+		filters[key] = value
+	}
+	for key, value := range explicit {
+		filters[key] = value
+	}
+	return query, filters
+}
 
-		if strings.Contains(strings.ToLower(product.Name), queryLower) {
-			score += 5
+// searchProducts returns every match for the query in relevance order,
+// together with a "did you mean" suggestion when query words had to be
+// corrected. An empty query matches the whole catalogue. The caller holds
+// catalogMutex and passes in the query's vector similarities.
+func (sa *SearchAgent) searchProducts(query string, similarities map[string]float64) ([]models.ScoredProduct, string) {
+	if strings.TrimSpace(query) == "" {
+		results := make([]models.ScoredProduct, len(sa.catalog))
+		for i, product := range sa.catalog {
+			results[i] = models.ScoredProduct{Product: product}
 		}
-		if strings.Contains(strings.ToLower(product.Description), queryLower) {
-			score += 3
+		return results, ""
+	}
+
+	terms, suggestion := sa.expandQuery(query)
+	lexical := sa.index.Search(terms)
+	return sa.rankHybrid(lexical, similarities), suggestion
+}
+
+// querySimilarities embeds the query and scores it against every product
+// vector. It takes catalogMutex only to read the current vector index.
+func (sa *SearchAgent) querySimilarities(ctx context.Context, query string) map[string]float64 {
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+
+	sa.catalogMutex.RLock()
+	vectors := sa.vectors
+	sa.catalogMutex.RUnlock()
+
+	similarities, err := vectors.Search(ctx, query)
+	if err != nil {
+		log.Printf("Vector search failed, using lexical ranking only: %v", err)
+	}
+	return similarities
+}
+
+// FindProduct returns the best match for a short product description such
+// as "the leather boots".
+func (sa *SearchAgent) FindProduct(ctx context.Context, text string) (models.Product, bool) {
+	if strings.TrimSpace(text) == "" {
+		return models.Product{}, false
+	}
+
+	similarities := sa.querySimilarities(ctx, text)
+
+	sa.catalogMutex.RLock()
+	defer sa.catalogMutex.RUnlock()
+
+	results, _ := sa.searchProducts(text, similarities)
+	if len(results) == 0 {
+		return models.Product{}, false
+	}
+	return results[0].Product, true
+}
+
+// rankHybrid blends max-normalised BM25 scores with vector similarity.
+// Products without a lexical match are kept only when they are semantically
+// close enough to the query.
+func (sa *SearchAgent) rankHybrid(lexical []models.ScoredProduct, similarities map[string]float64) []models.ScoredProduct {
+	maxLexical := 0.0
+	if len(lexical) > 0 {
+		maxLexical = lexical[0].Score
+	}
+
+	combined := make(map[string]float64)
+	for _, result := range lexical {
+		combined[result.Product.ID] = lexicalWeight * result.Score / maxLexical
+	}
+	for id, similarity := range similarities {
+		if _, matched := combined[id]; matched || similarity >= sa.minSimilarity {
+			combined[id] += (1 - lexicalWeight) * math.Max(similarity, 0)
 		}
+	}
 
-		for _, category := range product.Categories {
-			if strings.Contains(queryLower, category) {
-				score += 2
-			}
+	results := make([]models.ScoredProduct, 0, len(combined))
+	for id, score := range combined {
+		if doc, ok := sa.index.docs[id]; ok {
+			results = append(results, models.ScoredProduct{Product: doc.product, Score: score})
 		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return sa.index.docs[results[i].Product.ID].position < sa.index.docs[results[j].Product.ID].position
+	})
+	return results
+}
 
-		for term, syns := range synonyms {
-			if strings.Contains(queryLower, term) {
-				for _, syn := range syns {
-					if strings.Contains(strings.ToLower(product.Name), syn) {
-						score += 2
-					}
-				}
-			}
+// expandQuery analyses the query, corrects words missing from the index
+// vocabulary within the fuzzy tolerance, and adds down-weighted synonym
+// terms. Corrected terms count slightly less than exact ones.
+func (sa *SearchAgent) expandQuery(query string) ([]QueryTerm, string) {
+	seen := make(map[string]bool)
+	var terms []QueryTerm
+	add := func(term string, weight float64) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, QueryTerm{Term: term, Weight: weight})
 		}
+	}
 
-		if score > 0 {
-			matches = append(matches, product)
+	tokens := tokenize(query)
+	corrected := false
+	for i, token := range tokens {
+		if stopWords[token] {
+			continue
 		}
 
-		if len(matches) >= 4 {
-			break
+		term := stem(token)
+		if !sa.index.HasTerm(term) {
+			if fix, edits, ok := sa.index.Correct(term, sa.fuzzy.allowedEdits(term)); ok {
+				add(fix, 1-fuzzyEditPenalty*float64(edits))
+				tokens[i] = sa.index.Surface(fix)
+				corrected = true
+				continue
+			}
 		}
+		add(term, 1)
 	}
 
-	return matches
+	for _, token := range tokens {
+		for _, syn := range sa.synonyms.Lookup(token) {
+			add(stem(syn), synonymWeight)
+		}
+	}
+
+	if !corrected {
+		return terms, ""
+	}
+	return terms, strings.Join(tokens, " ")
 }
 
 func (sa *SearchAgent) Shutdown(ctx context.Context) error {
+	if sa.stopWatch != nil {
+		close(sa.stopWatch)
+		sa.stopWatch = nil
+	}
 	return nil
 }
@@ -0,0 +1,310 @@
+package agents
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"celeste/models"
+)
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type indexField int
+
+const (
+	fieldName indexField = iota
+	fieldDescription
+	fieldCategories
+	fieldAttributes // brand, material and variant colours
+	numIndexFields
+)
+
+// Per-field weights used when combining term frequencies (BM25F).
+var fieldWeights = [numIndexFields]float64{
+	fieldName:        3.0,
+	fieldDescription: 1.0,
+	fieldCategories:  2.0,
+	fieldAttributes:  1.5,
+}
+
+type fieldFreqs [numIndexFields]int
+
+type indexedDoc struct {
+	product  models.Product
+	position int
+	lengths  fieldFreqs
+	tokens   [numIndexFields][]string
+}
+
+// QueryTerm is a stemmed query term and the weight it contributes with.
+// Original query terms have weight 1; expansions carry less.
+type QueryTerm struct {
+	Term   string
+	Weight float64
+}
+
+// SearchIndex is an inverted index over the product catalogue scored with
+// BM25F across the name, description, category and attribute (brand,
+// material, colour) fields.
+type SearchIndex struct {
+	docs         map[string]*indexedDoc
+	postings     map[string]map[string]fieldFreqs
+	lengthTotals [numIndexFields]int
+	nextPosition int
+	// Vocabulary lookups for typo correction: trigram -> terms, and the
+	// most common surface forms each stemmed term was indexed from.
+	trigrams map[string]map[string]bool
+	surfaces map[string]map[string]int
+}
+
+func NewSearchIndex(products []models.Product) *SearchIndex {
+	index := &SearchIndex{
+		docs:     make(map[string]*indexedDoc),
+		postings: make(map[string]map[string]fieldFreqs),
+		trigrams: make(map[string]map[string]bool),
+		surfaces: make(map[string]map[string]int),
+	}
+	for _, product := range products {
+		index.Add(product)
+	}
+	return index
+}
+
+// Add indexes a product, replacing any existing entry with the same ID while
+// keeping its catalogue position.
+func (si *SearchIndex) Add(product models.Product) {
+	position := si.nextPosition
+	if existing, ok := si.docs[product.ID]; ok {
+		position = existing.position
+		si.Remove(product.ID)
+	} else {
+		si.nextPosition++
+	}
+
+	doc := &indexedDoc{product: product, position: position}
+	doc.tokens = [numIndexFields][]string{
+		fieldName:        contentTokens(product.Name),
+		fieldDescription: contentTokens(product.Description),
+		fieldCategories:  contentTokens(strings.Join(product.Categories, " ")),
+		fieldAttributes:  contentTokens(productAttributes(product)),
+	}
+
+	for field, tokens := range doc.tokens {
+		doc.lengths[field] = len(tokens)
+		si.lengthTotals[field] += len(tokens)
+		for _, token := range tokens {
+			term := stem(token)
+			if si.postings[term] == nil {
+				si.postings[term] = make(map[string]fieldFreqs)
+			}
+			if len(si.postings[term]) == 0 {
+				si.addToVocabulary(term)
+			}
+			if si.surfaces[term] == nil {
+				si.surfaces[term] = make(map[string]int)
+			}
+			si.surfaces[term][token]++
+
+			freqs := si.postings[term][product.ID]
+			freqs[field]++
+			si.postings[term][product.ID] = freqs
+		}
+	}
+
+	si.docs[product.ID] = doc
+}
+
+func productAttributes(product models.Product) string {
+	return strings.Join(append([]string{product.Brand, product.Material}, productColors(product)...), " ")
+}
+
+// Remove drops a product from the index. Terms left without postings stay
+// in the trigram vocabulary but are ignored by Correct.
+func (si *SearchIndex) Remove(id string) {
+	doc, ok := si.docs[id]
+	if !ok {
+		return
+	}
+
+	for field, tokens := range doc.tokens {
+		si.lengthTotals[field] -= len(tokens)
+		for _, token := range tokens {
+			term := stem(token)
+			delete(si.postings[term], id)
+			if si.surfaces[term][token]--; si.surfaces[term][token] <= 0 {
+				delete(si.surfaces[term], token)
+			}
+		}
+	}
+	delete(si.docs, id)
+}
+
+func (si *SearchIndex) addToVocabulary(term string) {
+	for _, gram := range trigrams(term) {
+		if si.trigrams[gram] == nil {
+			si.trigrams[gram] = make(map[string]bool)
+		}
+		si.trigrams[gram][term] = true
+	}
+}
+
+func (si *SearchIndex) HasTerm(term string) bool {
+	return len(si.postings[term]) > 0
+}
+
+// Correct finds the closest vocabulary term within maxEdits of term. Only
+// terms sharing a trigram with it are compared; ties prefer the term that
+// occurs in more documents.
+func (si *SearchIndex) Correct(term string, maxEdits int) (string, int, bool) {
+	if maxEdits <= 0 {
+		return "", 0, false
+	}
+
+	candidates := make(map[string]bool)
+	for _, gram := range trigrams(term) {
+		for candidate := range si.trigrams[gram] {
+			candidates[candidate] = true
+		}
+	}
+
+	best, bestDistance := "", maxEdits+1
+	for candidate := range candidates {
+		if len(si.postings[candidate]) == 0 {
+			continue
+		}
+		distance := editDistance(term, candidate)
+		if distance < bestDistance ||
+			(distance == bestDistance && len(si.postings[candidate]) > len(si.postings[best])) ||
+			(distance == bestDistance && len(si.postings[candidate]) == len(si.postings[best]) && candidate < best) {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best, bestDistance, bestDistance <= maxEdits
+}
+
+// Surface returns the most common original word indexed under a stemmed term.
+func (si *SearchIndex) Surface(term string) string {
+	surface, count := term, 0
+	for word, n := range si.surfaces[term] {
+		if n > count || (n == count && word < surface) {
+			surface, count = word, n
+		}
+	}
+	return surface
+}
+
+func (si *SearchIndex) Len() int {
+	return len(si.docs)
+}
+
+// Search scores every document containing at least one query term and returns
+// them by descending score, ties broken by catalogue order.
+func (si *SearchIndex) Search(terms []QueryTerm) []models.ScoredProduct {
+	docCount := float64(len(si.docs))
+	if docCount == 0 {
+		return nil
+	}
+
+	var avgLengths [numIndexFields]float64
+	for field := range avgLengths {
+		avgLengths[field] = math.Max(float64(si.lengthTotals[field])/docCount, 1)
+	}
+
+	scores := make(map[string]float64)
+	for _, qt := range terms {
+		postings := si.postings[qt.Term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		df := float64(len(postings))
+		idf := math.Log(1 + (docCount-df+0.5)/(df+0.5))
+
+		for id, freqs := range postings {
+			doc := si.docs[id]
+			tf := 0.0
+			for field, freq := range freqs {
+				if freq == 0 {
+					continue
+				}
+				norm := 1 - bm25B + bm25B*float64(doc.lengths[field])/avgLengths[field]
+				tf += fieldWeights[field] * float64(freq) / norm
+			}
+			scores[id] += qt.Weight * idf * tf / (bm25K1 + tf)
+		}
+	}
+
+	results := make([]models.ScoredProduct, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, models.ScoredProduct{Product: si.docs[id].product, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return si.docs[results[i].Product.ID].position < si.docs[results[j].Product.ID].position
+	})
+	return results
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "any": true, "are": true, "do": true,
+	"for": true, "have": true, "i": true, "in": true, "is": true, "it": true,
+	"me": true, "my": true, "need": true, "of": true, "on": true, "or": true,
+	"show": true, "some": true, "the": true, "to": true, "want": true,
+	"with": true, "you": true, "looking": true, "find": true,
+}
+
+// analyze tokenises text, drops stop words and stems what remains.
+func analyze(text string) []string {
+	tokens := contentTokens(text)
+	for i, token := range tokens {
+		tokens[i] = stem(token)
+	}
+	return tokens
+}
+
+// contentTokens tokenises text and drops stop words.
+func contentTokens(text string) []string {
+	var tokens []string
+	for _, token := range tokenize(text) {
+		if !stopWords[token] {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// stem is a light suffix stripper that conflates plurals and common verb
+// endings ("boots" -> "boot", "dresses" -> "dress", "heeled" -> "heel").
+func stem(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 4 && strings.HasSuffix(word, "sses"):
+		return word[:len(word)-2]
+	case len(word) > 4 && strings.HasSuffix(word, "es") && hasAnySuffix(word[:len(word)-2], "x", "z", "ch", "sh"):
+		return word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !hasAnySuffix(word, "ss", "us", "is"):
+		return word[:len(word)-1]
+	case len(word) > 5 && strings.HasSuffix(word, "ing"):
+		return word[:len(word)-3]
+	case len(word) > 4 && strings.HasSuffix(word, "ed") && !strings.HasSuffix(word, "eed"):
+		return word[:len(word)-2]
+	}
+	return word
+}
+
+func hasAnySuffix(word string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(word, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package agents
+
+import (
+	"slices"
+	"testing"
+
+	"celeste/models"
+)
+
+func searchIDs(index *SearchIndex, query string) []string {
+	var terms []QueryTerm
+	for _, term := range analyze(query) {
+		terms = append(terms, QueryTerm{Term: term, Weight: 1})
+	}
+	var ids []string
+	for _, result := range index.Search(terms) {
+		ids = append(ids, result.Product.ID)
+	}
+	return ids
+}
+
+func TestSearchIndexBM25F(t *testing.T) {
+	described := testProduct("described", "Canvas Sneaker", 60, "sneakers")
+	described.Description = "Pairs well with a leather belt"
+	named := testProduct("named", "Leather Boot", 120, "boots")
+	named.Description = "Sturdy ankle boot"
+	categorised := testProduct("categorised", "Chelsea Boot", 110, "boots", "leather")
+	twin := testProduct("twin", "Chelsea Boot", 110, "boots", "leather")
+	branded := testProduct("branded", "Suede Loafer", 80, "loafers")
+	branded.Brand = "Leather Lane"
+	index := NewSearchIndex([]models.Product{described, named, categorised, twin, branded})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Name outweighs categories, categories the brand, and the brand
+		// the description. Equal documents keep catalogue order.
+		{"leather", []string{"named", "categorised", "twin", "branded", "described"}},
+		// A document matching both terms beats those matching one, and
+		// the rarer term counts for more
+		{"leather boots", []string{"named", "categorised", "twin", "branded", "described"}},
+		{"ankle boots", []string{"named", "categorised", "twin"}},
+		{"sneakers", []string{"described"}},
+		{"hats", nil},
+	}
+	for _, tt := range tests {
+		if got := searchIDs(index, tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Re-adding a product keeps its catalogue position; removing one drops it
+	index.Add(categorised)
+	index.Remove("named")
+	if got, want := searchIDs(index, "chelsea"), []string{"categorised", "twin"}; !slices.Equal(got, want) {
+		t.Errorf("after re-adding, search chelsea = %v, want %v", got, want)
+	}
+	if got := searchIDs(index, "sturdy"); len(got) != 0 {
+		t.Errorf("removed product still found: %v", got)
+	}
+}
+
+func TestSearchIndexQueryWeights(t *testing.T) {
+	index := NewSearchIndex([]models.Product{
+		testProduct("boot", "Leather Boot", 120, "boots"),
+		testProduct("sneaker", "Canvas Sneaker", 60, "sneakers"),
+	})
+	results := index.Search([]QueryTerm{{Term: "boot", Weight: synonymWeight}, {Term: "sneaker", Weight: 1}})
+	if len(results) != 2 || results[0].Product.ID != "sneaker" {
+		t.Fatalf("results = %+v, want the fully weighted term first", results)
+	}
+	if ratio := results[1].Score / results[0].Score; ratio < synonymWeight-1e-9 || ratio > synonymWeight+1e-9 {
+		t.Errorf("score ratio = %v, want %v", ratio, synonymWeight)
+	}
+}
@@ -0,0 +1,130 @@
+package agents
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"celeste/models"
+)
+
+const (
+	defaultSearchLimit = 4
+	maxSearchLimit     = 50
+)
+
+var searchSorts = map[string]bool{
+	"relevance":  true,
+	"price_asc":  true,
+	"price_desc": true,
+	"newest":     true,
+	"rating":     true,
+}
+
+// ResolveSearchOptions validates paging and sort options, applies defaults
+// and decodes a cursor into its offset.
+func ResolveSearchOptions(opts models.SearchOptions) (models.SearchOptions, error) {
+	if opts.Sort == "" {
+		opts.Sort = "relevance"
+	}
+	if !searchSorts[opts.Sort] {
+		return opts, fmt.Errorf("unknown sort %q", opts.Sort)
+	}
+
+	if opts.Limit == 0 {
+		opts.Limit = defaultSearchLimit
+	}
+	if opts.Limit < 0 || opts.Limit > maxSearchLimit {
+		return opts, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit)
+	}
+
+	if opts.Cursor != "" {
+		offset, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return opts, err
+		}
+		opts.Offset = offset
+		opts.Cursor = ""
+	}
+	if opts.Offset < 0 {
+		return opts, fmt.Errorf("offset must not be negative")
+	}
+
+	if err := validateFilters(opts.Filters); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(data), "offset:"))
+	if err != nil || !strings.HasPrefix(string(data), "offset:") || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return offset, nil
+}
+
+// paginate orders the full match set and cuts out the requested page. It
+// returns the page and the cursor for the next page, if there is one.
+func (sa *SearchAgent) paginate(results []models.ScoredProduct, opts models.SearchOptions) ([]models.ScoredProduct, string) {
+	sa.sortResults(results, opts.Sort)
+
+	if opts.Offset >= len(results) {
+		return []models.ScoredProduct{}, ""
+	}
+	end := min(opts.Offset+opts.Limit, len(results))
+
+	nextCursor := ""
+	if end < len(results) {
+		nextCursor = encodeCursor(end)
+	}
+	return results[opts.Offset:end], nextCursor
+}
+
+func (sa *SearchAgent) sortResults(results []models.ScoredProduct, order string) {
+	position := func(i int) int {
+		return sa.index.docs[results[i].Product.ID].position
+	}
+
+	switch order {
+	case "price_asc", "price_desc":
+		sort.SliceStable(results, func(i, j int) bool {
+			pi, pj := priceValue(results[i].Product.PriceUsd), priceValue(results[j].Product.PriceUsd)
+			if pi == pj {
+				return false
+			}
+			return (pi < pj) == (order == "price_asc")
+		})
+	case "newest":
+		sort.SliceStable(results, func(i, j int) bool {
+			ti, tj := results[i].Product.CreatedAt, results[j].Product.CreatedAt
+			if !ti.Equal(tj) {
+				return ti.After(tj)
+			}
+			return position(i) > position(j)
+		})
+	case "rating":
+		sort.SliceStable(results, func(i, j int) bool {
+			pi, pj := results[i].Product, results[j].Product
+			if pi.Rating != pj.Rating {
+				return pi.Rating > pj.Rating
+			}
+			return pi.ReviewCount > pj.ReviewCount
+		})
+	}
+}
+
+func priceValue(price models.PriceUsd) float64 {
+	return price.Float64()
+}
@@ -0,0 +1,81 @@
+package agents
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+	"time"
+
+	"celeste/models"
+)
+
+func TestSortNewest(t *testing.T) {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	products := []models.Product{
+		testProduct("old", "Old Boot", 50, "boots"),
+		testProduct("undated", "Undated Boot", 50, "boots"),
+		testProduct("new", "New Boot", 50, "boots"),
+		testProduct("middle", "Middle Boot", 50, "boots"),
+	}
+	products[0].CreatedAt = day
+	products[2].CreatedAt = day.AddDate(0, 2, 0)
+	products[3].CreatedAt = day.AddDate(0, 1, 0)
+	sa := testSearchAgent(products)
+
+	results := make([]models.ScoredProduct, len(products))
+	for i, product := range products {
+		results[i] = models.ScoredProduct{Product: product}
+	}
+	sa.sortResults(results, "newest")
+
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.Product.ID)
+	}
+	if want := []string{"new", "middle", "old", "undated"}; !slices.Equal(ids, want) {
+		t.Errorf("newest = %v, want %v", ids, want)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	for _, offset := range []int{0, 4, 1234} {
+		got, err := decodeCursor(encodeCursor(offset))
+		if err != nil || got != offset {
+			t.Errorf("decodeCursor(encodeCursor(%d)) = %d, %v", offset, got, err)
+		}
+	}
+
+	invalid := []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("4")),
+		base64.RawURLEncoding.EncodeToString([]byte("offset:")),
+		base64.RawURLEncoding.EncodeToString([]byte("offset:-4")),
+		base64.RawURLEncoding.EncodeToString([]byte("limit:4")),
+	}
+	for _, cursor := range invalid {
+		if offset, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) = %d, want an error", cursor, offset)
+		}
+	}
+}
+
+func TestResolveSearchOptions(t *testing.T) {
+	opts, err := ResolveSearchOptions(models.SearchOptions{Cursor: encodeCursor(8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Sort != "relevance" || opts.Limit != defaultSearchLimit || opts.Offset != 8 || opts.Cursor != "" {
+		t.Errorf("resolved %+v", opts)
+	}
+
+	for _, opts := range []models.SearchOptions{
+		{Sort: "popular"},
+		{Limit: maxSearchLimit + 1},
+		{Offset: -1},
+		{Cursor: "bad"},
+	} {
+		if _, err := ResolveSearchOptions(opts); err == nil {
+			t.Errorf("ResolveSearchOptions(%+v) accepted invalid options", opts)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package agents
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"celeste/models"
+)
+
+const (
+	defaultSessionTTL    = 24 * time.Hour
+	defaultMaxSessions   = 100_000
+	maxSessionSweepEvery = time.Minute
+
+	// A new anonymous session lasts this long, or the TTL if shorter, until
+	// a request comes back with it. Clients that never send the session
+	// back, such as scripts without a cookie jar, so leave little behind.
+	newSessionTTL = 10 * time.Minute
+
+	// Anonymous sessions keep their state under this prefix and the session
+	// ID, so user IDs may not start with it.
+	anonymousUserPrefix = "session:"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrInvalidUserID   = errors.New("invalid user ID")
+)
+
+// sessionTTL reads CELESTE_SESSION_TTL (a Go duration), how long a session
+// lasts after its last request.
+func sessionTTL() time.Duration {
+	value := os.Getenv("CELESTE_SESSION_TTL")
+	if value == "" {
+		return defaultSessionTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("Invalid CELESTE_SESSION_TTL %q, using %s", value, defaultSessionTTL)
+		return defaultSessionTTL
+	}
+	return ttl
+}
+
+// maxSessions reads CELESTE_MAX_SESSIONS, how many sessions are kept before
+// starting one evicts another.
+func maxSessions() int {
+	value := os.Getenv("CELESTE_MAX_SESSIONS")
+	if value == "" {
+		return defaultMaxSessions
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		log.Printf("Invalid CELESTE_MAX_SESSIONS %q, using %d", value, defaultMaxSessions)
+		return defaultMaxSessions
+	}
+	return limit
+}
+
+// ValidUserID reports whether a client may use userID as its user ID.
+func ValidUserID(userID string) bool {
+	return strings.TrimSpace(userID) != "" && !strings.HasPrefix(userID, anonymousUserPrefix)
+}
+
+func anonymousUserID(sessionID string) string {
+	return anonymousUserPrefix + sessionID
+}
+
+// SessionStore keeps up to limit sessions in memory. Each request a session
+// serves pushes its expiry back by the TTL.
+type SessionStore struct {
+	sessions map[string]*models.Session
+	ttl      time.Duration
+	limit    int
+	mutex    sync.Mutex
+}
+
+func NewSessionStore(ttl time.Duration, limit int) *SessionStore {
+	return &SessionStore{sessions: make(map[string]*models.Session), ttl: ttl, limit: limit}
+}
+
+// Create starts a session, linked to userID unless it is empty. When the
+// store is full it makes room by evicting a session, which it returns.
+func (ss *SessionStore) Create(userID string, now time.Time) (models.Session, *models.Session) {
+	session := &models.Session{
+		ID:        rand.Text(),
+		UserID:    userID,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(ss.ttl),
+	}
+	if userID == "" {
+		session.ExpiresAt = now.Add(min(ss.ttl, newSessionTTL))
+	}
+
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	var evicted *models.Session
+	if len(ss.sessions) >= ss.limit {
+		evicted = ss.evict()
+	}
+	ss.sessions[session.ID] = session
+	return *session, evicted
+}
+
+// evict removes a session no request has come back with, else the one
+// seen least recently; callers hold the mutex.
+func (ss *SessionStore) evict() *models.Session {
+	var oldest *models.Session
+	for _, session := range ss.sessions {
+		if session.LastSeen.Equal(session.CreatedAt) {
+			oldest = session
+			break
+		}
+		if oldest == nil || session.LastSeen.Before(oldest.LastSeen) {
+			oldest = session
+		}
+	}
+	if oldest != nil {
+		delete(ss.sessions, oldest.ID)
+	}
+	return oldest
+}
+
+// Touch extends a session that has not expired, reporting false for one
+// that has or never existed.
+func (ss *SessionStore) Touch(id string, now time.Time) (models.Session, bool) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	session := ss.sessions[id]
+	if session == nil || !now.Before(session.ExpiresAt) {
+		return models.Session{}, false
+	}
+	session.LastSeen = now
+	session.ExpiresAt = now.Add(ss.ttl)
+	return *session, true
+}
+
+// Remove ends a session, returning it if it had not expired.
+func (ss *SessionStore) Remove(id string, now time.Time) (models.Session, bool) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	session := ss.sessions[id]
+	if session == nil {
+		return models.Session{}, false
+	}
+	delete(ss.sessions, id)
+	return *session, now.Before(session.ExpiresAt)
+}
+
+// Expire removes and returns the sessions that have expired.
+func (ss *SessionStore) Expire(now time.Time) []models.Session {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	var expired []models.Session
+	for id, session := range ss.sessions {
+		if !now.Before(session.ExpiresAt) {
+			expired = append(expired, *session)
+			delete(ss.sessions, id)
+		}
+	}
+	return expired
+}
+
+func (ss *SessionStore) Len() int {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return len(ss.sessions)
+}
+
+// StartSession starts an anonymous session.
+func (ao *AgentOrchestrator) StartSession() models.Session {
+	return ao.createSession("")
+}
+
+// createSession starts a session, forgetting the state of an anonymous one
+// evicted to make room.
+func (ao *AgentOrchestrator) createSession(userID string) models.Session {
+	session, evicted := ao.sessionStore.Create(userID, time.Now().UTC())
+	if evicted != nil && evicted.UserID == "" {
+		ao.forgetSession(*evicted)
+	}
+	return session
+}
+
+// ResumeSession looks up a session and extends it, reporting false when it
+// has expired or never existed.
+func (ao *AgentOrchestrator) ResumeSession(sessionID string) (models.Session, bool) {
+	if sessionID == "" {
+		return models.Session{}, false
+	}
+	return ao.sessionStore.Touch(sessionID, time.Now().UTC())
+}
+
+// SessionUserID is the ID a session's context, history and alerts are kept
+// under: its user once logged in, and one of its own until then.
+func SessionUserID(session models.Session) string {
+	if session.UserID != "" {
+		return session.UserID
+	}
+	return anonymousUserID(session.ID)
+}
+
+// Login links a session to a user. The session is replaced by one with a
+// new ID, so an ID seen before login is no use after it, and what the
+// shopper did while anonymous is merged into the user's context.
+func (ao *AgentOrchestrator) Login(ctx context.Context, sessionID, userID string) (models.Session, error) {
+	if !ValidUserID(userID) {
+		return models.Session{}, ErrInvalidUserID
+	}
+	previous, err := ao.endSession(sessionID)
+	if err != nil {
+		return models.Session{}, err
+	}
+	session := ao.createSession(userID)
+
+	if previous.UserID == "" {
+		anonymousID := anonymousUserID(previous.ID)
+		ao.mutex.Lock()
+		anonymous := ao.contextStore[anonymousID]
+		delete(ao.contextStore, anonymousID)
+		ao.mutex.Unlock()
+		if anonymous != nil {
+			ao.mergeContext(ctx, ao.userContext(userID), anonymous)
+		}
+		if err := ao.alerts.Reassign(anonymousID, userID); err != nil {
+			log.Printf("Failed to move price alerts to %s: %v", userID, err)
+		}
+	}
+	return session, nil
+}
+
+// Logout ends a session and starts a new anonymous one. The state of an
+// anonymous session is discarded with it.
+func (ao *AgentOrchestrator) Logout(sessionID string) (models.Session, error) {
+	previous, err := ao.endSession(sessionID)
+	if err != nil {
+		return models.Session{}, err
+	}
+	if previous.UserID == "" {
+		ao.forgetSession(previous)
+	}
+	return ao.StartSession(), nil
+}
+
+// endSession removes a session. One that had already expired is treated
+// as never having existed.
+func (ao *AgentOrchestrator) endSession(sessionID string) (models.Session, error) {
+	session, ok := ao.sessionStore.Remove(sessionID, time.Now().UTC())
+	if !ok {
+		if session.ID != "" && session.UserID == "" {
+			ao.forgetSession(session)
+		}
+		return models.Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// runSessionSweeper removes expired sessions, and the state of anonymous
+// ones, on a timer.
+func (ao *AgentOrchestrator) runSessionSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired := ao.sessionStore.Expire(time.Now().UTC())
+		for _, session := range expired {
+			if session.UserID == "" {
+				ao.forgetSession(session)
+			}
+		}
+		if len(expired) > 0 {
+			log.Printf("Expired %d sessions", len(expired))
+		}
+	}
+}
+
+func (ao *AgentOrchestrator) forgetSession(session models.Session) {
+	userID := anonymousUserID(session.ID)
+	ao.mutex.Lock()
+	delete(ao.contextStore, userID)
+	ao.mutex.Unlock()
+	if err := ao.alerts.RemoveUser(userID); err != nil {
+		log.Printf("Failed to remove price alerts of session %s: %v", session.ID, err)
+	}
+}
+
+// mergeContext folds an anonymous session's context into a user's. The
+// user's stated preferences and locale win and the session's fill the
+// gaps; the session's last search is the one follow-ups continue.
+func (ao *AgentOrchestrator) mergeContext(ctx context.Context, userContext, anonymous *models.UserContext) {
+	ao.mutex.Lock()
+	history := append(userContext.History, anonymous.History...)
+	userContext.History = history[max(len(history)-10, 0):]
+	for _, id := range anonymous.CartItems {
+		if !contains(userContext.CartItems, id) {
+			userContext.CartItems = append(userContext.CartItems, id)
+		}
+	}
+	for key, value := range anonymous.Preferences {
+		if _, ok := userContext.Preferences[key]; !ok {
+			userContext.Preferences[key] = value
+		}
+	}
+	if userContext.Location == "" {
+		userContext.Location = anonymous.Location
+	}
+	if anonymous.LastQuery != "" {
+		userContext.LastQuery = anonymous.LastQuery
+		userContext.ActiveFilters = anonymous.ActiveFilters
+	}
+	if len(anonymous.RecentProducts) > 0 {
+		userContext.RecentProducts = anonymous.RecentProducts
+	}
+	mergeProfile(&userContext.Learned, anonymous.Learned, time.Now().UTC(), preferenceHalfLife())
+
+	conversation := &userContext.Conversation
+	conversation.Turns = append(conversation.Turns, anonymous.Conversation.Turns...)
+	sort.SliceStable(conversation.Turns, func(i, j int) bool {
+		return conversation.Turns[i].Timestamp.Before(conversation.Turns[j].Timestamp)
+	})
+	if summary := anonymous.Conversation.Summary; summary != "" {
+		conversation.Summary = strings.TrimSpace(conversation.Summary + "\n" + summary)
+	}
+	conversation.Summarized += anonymous.Conversation.Summarized
+	ao.mutex.Unlock()
+
+	ao.foldConversation(ctx, userContext)
+}
+
+// mergeProfile adds another profile's weights to a profile, both aged to
+// now. The other's prices are left out when its band is in a different
+// currency.
+func mergeProfile(profile *models.PreferenceProfile, other models.PreferenceProfile, now time.Time, halfLife time.Duration) {
+	decayProfile(profile, now, halfLife)
+	decayProfile(&other, now, halfLife)
+	for _, pair := range []struct {
+		weights *map[string]float64
+		other   map[string]float64
+	}{
+		{&profile.Categories, other.Categories},
+		{&profile.Colors, other.Colors},
+		{&profile.Sizes, other.Sizes},
+		{&profile.Brands, other.Brands},
+	} {
+		for key, weight := range pair.other {
+			addWeight(pair.weights, key, weight)
+		}
+	}
+
+	if other.PriceBand == nil || other.PriceWeight <= 0 {
+		return
+	}
+	if profile.PriceBand != nil && profile.PriceBand.Currency != other.PriceBand.Currency {
+		return
+	}
+	profile.PriceWeight += other.PriceWeight
+	profile.PriceSum += other.PriceSum
+	profile.PriceSquares += other.PriceSquares
+	profile.PriceBand = priceBand(profile, other.PriceBand.Currency)
+}
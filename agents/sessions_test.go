@@ -0,0 +1,62 @@
+package agents
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionStoreNewSessionsExpireSoon(t *testing.T) {
+	store := NewSessionStore(24*time.Hour, 10)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	anonymous, _ := store.Create("", now)
+	if want := now.Add(newSessionTTL); !anonymous.ExpiresAt.Equal(want) {
+		t.Errorf("new anonymous session expires %v, want %v", anonymous.ExpiresAt, want)
+	}
+	user, _ := store.Create("alice", now)
+	if want := now.Add(24 * time.Hour); !user.ExpiresAt.Equal(want) {
+		t.Errorf("new user session expires %v, want %v", user.ExpiresAt, want)
+	}
+
+	resumed, ok := store.Touch(anonymous.ID, now.Add(time.Minute))
+	if want := now.Add(time.Minute + 24*time.Hour); !ok || !resumed.ExpiresAt.Equal(want) {
+		t.Errorf("resumed session expires %v, want %v", resumed.ExpiresAt, want)
+	}
+
+	never, _ := store.Create("", now)
+	if _, ok := store.Touch(never.ID, now.Add(newSessionTTL)); ok {
+		t.Error("resumed a new session after its short TTL")
+	}
+}
+
+func TestSessionStoreEvictsWhenFull(t *testing.T) {
+	store := NewSessionStore(time.Hour, 2)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	kept, _ := store.Create("", now)
+	store.Touch(kept.ID, now.Add(time.Second))
+	unconfirmed, _ := store.Create("", now.Add(2*time.Second))
+
+	_, evicted := store.Create("", now.Add(3*time.Second))
+	if evicted == nil || evicted.ID != unconfirmed.ID {
+		t.Fatalf("evicted %v, want the session never resumed", evicted)
+	}
+	if store.Len() != 2 {
+		t.Errorf("len = %d, want 2", store.Len())
+	}
+	if _, ok := store.Touch(kept.ID, now.Add(4*time.Second)); !ok {
+		t.Error("evicted a session in use")
+	}
+}
+
+func TestEvictedSessionStateIsForgotten(t *testing.T) {
+	ao := NewAgentOrchestrator(nil)
+	ao.sessionStore = NewSessionStore(time.Hour, 1)
+
+	first := ao.StartSession()
+	ao.userContext(SessionUserID(first))
+	ao.StartSession()
+	if ao.GetUserContext(SessionUserID(first)) != nil {
+		t.Error("kept the context of an evicted session")
+	}
+}
@@ -0,0 +1,348 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"celeste/models"
+	"celeste/sizing"
+	"google.golang.org/genai"
+)
+
+const maxSizedProducts = 3
+
+var (
+	// "I'm a UK 8", "I usually wear a medium", "my shoe size is 9"
+	usualSizePattern = regexp.MustCompile(`\b(?:i|i'm|im|my (?:\w+ )?size is)\s+(?:(?:usually|normally|generally|typically|always|am|wear|take|a|an|size)\s+)*(?:(us|uk|eu) ?(\d{1,2}(?:\.5)?)|(extra small|extra large|xxs|xs|small|medium|large|xxl|xl|s|m|l)|(\d{1,2}(?:\.5)?))\b`)
+	// "my chest is 96cm", "foot length 26.5 cm", "32 inch waist"
+	measurementPattern        = regexp.MustCompile(`\b(foot|feet|chest|bust|waist|hips?)(?: length| size| measurement)?(?: is| are|:)?\s*(\d{1,3}(?:\.\d)?)\s*(cm|in|inch|inches|")?`)
+	measurementReversePattern = regexp.MustCompile(`\b(\d{1,3}(?:\.\d)?)\s*(cm|in|inch|inches|")?\s*(foot|chest|bust|waist|hips)\b`)
+	fitPreferencePattern      = regexp.MustCompile(`\bi (?:like|prefer)\s+(?:(?:a|my|clothes|things|them|it|to be|fit)\s+)*(loose|relaxed|oversized|roomy|slim|fitted|snug|regular)\b`)
+	// "UK 6, what is that in EU?", "what's a US 9 in european sizes"
+	conversionPattern = regexp.MustCompile(`\b(us|uk|eu) ?(\d{1,2}(?:\.5)?|xxs|xs|s|m|l|xl|xxl)\b.*\bin (us|uk|eu|american|british|european)\b`)
+	// Follow-ups about the products already shown, including the size actions
+	// offered with them
+	sizeFollowUpPattern = regexp.MustCompile(`\b(these|those|them|they|this|it)\b|^(?:(?:get|see|show|me|the|a)\s+)*(?:size chart|size guide|size guidance|virtual fitting)$`)
+)
+
+var letterSizes = map[string]string{
+	"extra small": "XS", "xxs": "XXS", "xs": "XS", "small": "S", "s": "S",
+	"medium": "M", "m": "M", "large": "L", "l": "L",
+	"extra large": "XL", "xl": "XL", "xxl": "XXL",
+}
+
+var sizeSystemNames = map[string]string{
+	"us": sizing.SystemUS, "american": sizing.SystemUS,
+	"uk": sizing.SystemUK, "british": sizing.SystemUK,
+	"eu": sizing.SystemEU, "european": sizing.SystemEU,
+}
+
+var fitPreferences = map[string]string{
+	"loose": sizing.PreferRelaxed, "relaxed": sizing.PreferRelaxed, "oversized": sizing.PreferRelaxed, "roomy": sizing.PreferRelaxed,
+	"slim": sizing.PreferFitted, "fitted": sizing.PreferFitted, "snug": sizing.PreferFitted,
+	"regular": sizing.PreferRegular,
+}
+
+// Words that say which garment group a size is for.
+var sizeGroupPatterns = []struct {
+	group   string
+	pattern *regexp.Regexp
+}{
+	{"shoes", regexp.MustCompile(`\b(shoes?|boots?|sneakers?|trainers?|heels|footwear|feet|foot)\b`)},
+	{"dresses", regexp.MustCompile(`\b(dress|dresses)\b`)},
+	{"bottoms", regexp.MustCompile(`\b(trousers|jeans|chinos|pants|skirts?|shorts|waist)\b`)},
+	{"tops", regexp.MustCompile(`\b(tops?|shirts?|t-shirts?|tees?|jumpers?|sweaters?|jackets?|coats?|knitwear|chest)\b`)},
+}
+
+type SizeAgent struct {
+	id           string
+	geminiClient *genai.Client
+	catalog      ProductCatalog
+	charts       *sizing.Charts
+}
+
+func NewSizeAgent(geminiClient *genai.Client, catalog ProductCatalog) *SizeAgent {
+	return &SizeAgent{
+		id:           "size_agent",
+		geminiClient: geminiClient,
+		catalog:      catalog,
+		charts:       sizing.NewCharts(nil),
+	}
+}
+
+func (sz *SizeAgent) ID() string {
+	return sz.id
+}
+
+// Initialize loads the size charts. Without a charts file the agent can
+// still record fit profiles but cannot recommend sizes.
+func (sz *SizeAgent) Initialize(ctx context.Context) error {
+	path := sizing.DefaultPath()
+	charts, err := sizing.LoadCharts(path)
+	if os.IsNotExist(err) {
+		log.Printf("No size charts at %s, size guidance disabled", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("loading size charts: %v", err)
+	}
+
+	sz.charts = charts
+	log.Printf("Loaded %d size charts", charts.Len())
+	return nil
+}
+
+// Process answers size questions: it records any sizes, measurements or fit
+// preference the shopper mentions, converts between US, UK and EU sizing,
+// and recommends a size variant for each product in question. The profile
+// changes are returned in Data["fit_profile"] for the caller to keep.
+func (sz *SizeAgent) Process(ctx context.Context, input models.AgentMessage) (*models.AgentResponse, error) {
+	query, _ := input.Data["query"].(string)
+	searchResults, _ := input.Data["products"].([]models.Product)
+	text := normalizeQuery(query)
+
+	products := sz.productsFor(text, searchResults, input.Context)
+	group := sz.groupFor(text, products)
+	updates := parseFitProfile(text, group)
+
+	preferences := make(map[string]string)
+	color := ""
+	if input.Context != nil {
+		for key, value := range input.Context.Preferences {
+			preferences[key] = value
+		}
+		color = input.Context.ActiveFilters["color"]
+	}
+	for key, value := range updates {
+		preferences[key] = value
+	}
+	profile := sizing.ProfileFromPreferences(preferences)
+
+	advised := []models.Product{}
+	advice := make(map[string]models.SizeRecommendation)
+	charts := make(map[string]models.SizeChart)
+	for _, product := range products {
+		chart, ok := sz.charts.For(product)
+		if !ok || len(productSizes(product)) == 0 {
+			continue
+		}
+		advised = append(advised, product)
+		charts[product.ID] = chart
+		if recommendation, ok := recommendSize(product, chart, profile, color); ok {
+			advice[product.ID] = recommendation
+		}
+	}
+
+	var sentences []string
+	if len(updates) > 0 {
+		sentences = append(sentences, "Thanks, I've saved that to your fit profile.")
+	}
+	if sentence, ok := sz.convert(text, group); ok {
+		sentences = append(sentences, sentence)
+	}
+	for _, product := range advised {
+		if recommendation, ok := advice[product.ID]; ok {
+			sentences = append(sentences, adviceSentence(product, recommendation))
+		}
+	}
+	if len(advice) == 0 && len(advised) > 0 {
+		sentences = append(sentences, `Tell me your usual size ("I'm a UK 8 in shoes", "I usually wear a medium") or your measurements ("my chest is 96cm") and I'll pick a size for each item. The size charts are attached.`)
+	}
+	if len(sentences) == 0 {
+		sentences = append(sentences, "Find an item you like and I'll help you pick a size.")
+	}
+
+	actions := []string{"Size chart", "Virtual fitting", "Exchange policy"}
+	if len(advice) > 0 {
+		actions = []string{"Add to cart", "Size chart", "Exchange policy"}
+	}
+
+	return &models.AgentResponse{
+		ID:        input.ID,
+		FromAgent: sz.id,
+		Type:      "size_guidance",
+		Data: map[string]interface{}{
+			"products":    advised,
+			"size_advice": advice,
+			"size_charts": charts,
+			"fit_profile": updates,
+			"message":     strings.Join(sentences, " "),
+		},
+		NextActions: actions,
+		Success:     true,
+	}, nil
+}
+
+// productsFor picks the products to size: those shown last time when the
+// query refers back to them ("do these run small?"), else the top search
+// results.
+func (sz *SizeAgent) productsFor(text string, searchResults []models.Product, userContext *models.UserContext) []models.Product {
+	var products []models.Product
+	if userContext != nil && (sizeFollowUpPattern.MatchString(text) || len(searchResults) == 0) {
+		for _, id := range userContext.RecentProducts {
+			if product, ok := sz.catalog.Product(id); ok {
+				products = append(products, product)
+			}
+		}
+	}
+	if len(products) == 0 {
+		products = searchResults
+	}
+	return products[:min(len(products), maxSizedProducts)]
+}
+
+// groupFor decides which garment group a stated size is for: the one the
+// query names, else that of the first product in question, else shoes.
+func (sz *SizeAgent) groupFor(text string, products []models.Product) string {
+	for _, g := range sizeGroupPatterns {
+		if g.pattern.MatchString(text) {
+			return g.group
+		}
+	}
+	for _, product := range products {
+		if chart, ok := sz.charts.For(product); ok {
+			return chart.Group
+		}
+	}
+	return "shoes"
+}
+
+// parseFitProfile picks out the sizes, measurements and fit preference a
+// shopper states, as preference keys and values. Letter sizes are kept for
+// tops unless the query names another group.
+func parseFitProfile(text, group string) map[string]string {
+	updates := make(map[string]string)
+
+	if match := usualSizePattern.FindStringSubmatch(text); match != nil {
+		switch {
+		case match[1] != "":
+			updates[sizing.SizeKey(group)] = sizing.FormatSize(match[1], match[2])
+		case match[3] != "":
+			if group == "shoes" {
+				group = "tops"
+			}
+			updates[sizing.SizeKey(group)] = letterSizes[match[3]]
+		case match[4] != "" && strings.Contains(match[0], "size"):
+			// A bare number only counts as a size when called one
+			updates[sizing.SizeKey(group)] = match[4]
+		}
+	}
+
+	record := func(part, value, unit string) {
+		measurement := map[string]string{
+			"foot": "foot_cm", "feet": "foot_cm", "chest": "chest_cm", "bust": "bust_cm",
+			"waist": "waist_cm", "hip": "hips_cm", "hips": "hips_cm",
+		}[part]
+		number, err := strconv.ParseFloat(value, 64)
+		if measurement == "" || err != nil || number <= 0 {
+			return
+		}
+		// Without a unit, small numbers are taken to be inches
+		inches := unit == "in" || unit == "inch" || unit == "inches" || unit == `"`
+		if unit == "" {
+			inches = (measurement == "foot_cm" && number < 15) || (measurement != "foot_cm" && number < 60)
+		}
+		if inches {
+			number *= 2.54
+		}
+		updates[measurement] = strconv.FormatFloat(number, 'f', 1, 64)
+	}
+	for _, match := range measurementPattern.FindAllStringSubmatch(text, -1) {
+		record(match[1], match[2], match[3])
+	}
+	for _, match := range measurementReversePattern.FindAllStringSubmatch(text, -1) {
+		record(match[3], match[1], match[2])
+	}
+
+	if match := fitPreferencePattern.FindStringSubmatch(text); match != nil {
+		updates[sizing.FitKey] = fitPreferences[match[1]]
+	}
+	return updates
+}
+
+// convert answers "UK 6, what is that in EU?" from the group's default
+// chart.
+func (sz *SizeAgent) convert(text, group string) (string, bool) {
+	match := conversionPattern.FindStringSubmatch(text)
+	if match == nil {
+		return "", false
+	}
+	from, size, to := match[1], strings.ToUpper(match[2]), sizeSystemNames[match[3]]
+	if from == to {
+		return "", false
+	}
+	chart, ok := sz.charts.Default(group)
+	if !ok {
+		return "", false
+	}
+	converted, ok := sizing.Convert(chart, from, size, to)
+	if !ok {
+		return fmt.Sprintf("I don't have a %s conversion for %s in %s.", strings.ToUpper(to), sizing.FormatSize(from, size), group), true
+	}
+	return fmt.Sprintf("In %s, %s is %s.", group, sizing.FormatSize(from, size), sizing.FormatSize(to, converted)), true
+}
+
+// recommendSize turns the chart's pick into a variant of the product,
+// preferring the colour being browsed and a variant in stock.
+func recommendSize(product models.Product, chart models.SizeChart, profile sizing.Profile, color string) (models.SizeRecommendation, bool) {
+	choice, ok := sizing.Recommend(chart, profile)
+	if !ok {
+		return models.SizeRecommendation{}, false
+	}
+
+	recommendation := models.SizeRecommendation{
+		ProductID:   product.ID,
+		Size:        choice.Row.Label,
+		Conversions: choice.Row.Sizes,
+		Basis:       choice.Basis,
+		Note:        choice.Note,
+	}
+
+	variants := matchingVariants(product, choice.Row.Label, color)
+	if len(variants) == 0 {
+		variants = matchingVariants(product, choice.Row.Label, "")
+	}
+	if len(variants) == 0 {
+		recommendation.Note = strings.TrimSpace(recommendation.Note + " This item doesn't come in that size.")
+		return recommendation, true
+	}
+	recommendation.SKU = variants[0].SKU
+	for _, variant := range variants {
+		if variant.Stock > 0 {
+			recommendation.SKU, recommendation.InStock = variant.SKU, true
+			break
+		}
+	}
+	return recommendation, true
+}
+
+func adviceSentence(product models.Product, recommendation models.SizeRecommendation) string {
+	var conversions []string
+	for _, system := range []string{sizing.SystemUS, sizing.SystemUK, sizing.SystemEU} {
+		if size, ok := recommendation.Conversions[system]; ok && size != recommendation.Size {
+			conversions = append(conversions, sizing.FormatSize(system, size))
+		}
+	}
+
+	sentence := fmt.Sprintf("%s: size %s", product.Name, recommendation.Size)
+	if len(conversions) > 0 {
+		sentence += " (" + strings.Join(conversions, ", ") + ")"
+	}
+	sentence += ", from " + recommendation.Basis + "."
+	if recommendation.Note != "" {
+		sentence += " " + recommendation.Note
+	}
+	if recommendation.SKU != "" && !recommendation.InStock {
+		sentence += " It's out of stock in that size right now."
+	}
+	return sentence
+}
+
+func (sz *SizeAgent) Shutdown(ctx context.Context) error {
+	return nil
+}
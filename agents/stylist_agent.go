@@ -0,0 +1,489 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"celeste/models"
+	"google.golang.org/genai"
+)
+
+const maxOutfits = 3
+
+// ProductCatalog gives read access to the whole catalogue.
+type ProductCatalog interface {
+	Products() []models.Product
+	Product(id string) (models.Product, bool)
+}
+
+// Outfit slots, checked in this order so a product tagged both "dresses"
+// and "occasion" is a dress, and a leather bag is a bag, not an accessory.
+var slotCategories = []struct {
+	slot       string
+	categories []string
+}{
+	{"dress", []string{"dresses", "dress", "jumpsuits"}},
+	{"outerwear", []string{"outerwear", "coats", "jackets"}},
+	{"shoes", []string{"footwear", "shoes", "boots", "sneakers"}},
+	{"bag", []string{"bags", "bag"}},
+	{"bottom", []string{"trousers", "jeans", "skirts", "shorts"}},
+	{"top", []string{"tops", "t-shirts", "shirts", "knitwear"}},
+	{"accessory", []string{"accessories", "belts", "scarves", "jewellery"}},
+}
+
+type outfitTemplate struct {
+	name     string
+	required []string
+	optional []string
+}
+
+// Separates come first so that shoes, bags and accessories anchor them by
+// default.
+var outfitTemplates = []outfitTemplate{
+	{"separates", []string{"top", "bottom", "shoes"}, []string{"outerwear", "bag", "accessory"}},
+	{"dress", []string{"dress", "shoes"}, []string{"outerwear", "bag", "accessory"}},
+}
+
+// Tags that cannot share an outfit.
+var clashingTags = [][2]string{
+	{"summer", "winter"},
+	{"casual", "occasion"},
+	{"casual", "evening"},
+}
+
+// Colours that go with anything; an outfit has at most one other colour.
+var neutralColors = map[string]bool{
+	"black": true, "white": true, "grey": true, "gray": true, "navy": true,
+	"camel": true, "brown": true, "tan": true, "khaki": true, "sand": true,
+	"beige": true, "charcoal": true, "cream": true, "champagne": true,
+}
+
+// Occasion words in a query and the product tags that suit them.
+var occasionTags = []struct {
+	pattern *regexp.Regexp
+	tags    []string
+}{
+	{regexp.MustCompile(`\b(wedding|party|gala|date night|evening|cocktail|formal)\b`), []string{"occasion", "evening"}},
+	{regexp.MustCompile(`\b(office|work|meeting|interview|business)\b`), []string{"workwear"}},
+	{regexp.MustCompile(`\b(weekend|casual|everyday|brunch)\b`), []string{"casual"}},
+	{regexp.MustCompile(`\b(summer|beach|holiday|vacation|hot)\b`), []string{"summer"}},
+	{regexp.MustCompile(`\b(winter|cold|snow|chilly)\b`), []string{"winter"}},
+}
+
+var completeLookPattern = regexp.MustCompile(`\b(complete (?:the|this|my) look|what (?:goes|would go) with|what to wear with|style (?:it|this|them)|outfit (?:for|with) (?:it|this))\b`)
+
+type StylistAgent struct {
+	id           string
+	geminiClient *genai.Client
+	catalog      ProductCatalog
+}
+
+func NewStylistAgent(geminiClient *genai.Client, catalog ProductCatalog) *StylistAgent {
+	return &StylistAgent{
+		id:           "stylist_agent",
+		geminiClient: geminiClient,
+		catalog:      catalog,
+	}
+}
+
+func (st *StylistAgent) ID() string {
+	return st.id
+}
+
+func (st *StylistAgent) Initialize(ctx context.Context) error {
+	return nil
+}
+
+// Process composes outfits around an anchor product: the one named by
+// Data["anchor_id"], else the first product shown last time for "complete
+// the look", else the top search result suited to the occasion. With no
+// anchor, outfits are built from scratch.
+func (st *StylistAgent) Process(ctx context.Context, input models.AgentMessage) (*models.AgentResponse, error) {
+	query, _ := input.Data["query"].(string)
+	searchResults, _ := input.Data["products"].([]models.Product)
+
+	var anchor *models.Product
+	if id, _ := input.Data["anchor_id"].(string); id != "" {
+		if product, ok := st.catalog.Product(id); ok {
+			anchor = &product
+		}
+	}
+	if anchor == nil && completeLookPattern.MatchString(normalizeQuery(query)) && input.Context != nil && len(input.Context.RecentProducts) > 0 {
+		if product, ok := st.catalog.Product(input.Context.RecentProducts[0]); ok {
+			anchor = &product
+		}
+	}
+	tags := queryTags(query)
+	if anchor == nil {
+		anchor = anchorFromResults(searchResults, tags)
+	}
+
+	var preferences map[string]string
+	if input.Context != nil {
+		preferences = input.Context.Preferences
+	}
+	outfits := st.ComposeOutfits(anchor, tags, preferences)
+
+	actions := []string{"See outfit suggestions"}
+	if len(outfits) > 0 {
+		actions = []string{"Add outfit to cart", "Complete the look", "See more outfits"}
+	}
+
+	return &models.AgentResponse{
+		ID:        input.ID,
+		FromAgent: st.id,
+		Type:      "outfit_suggestions",
+		Data: map[string]interface{}{
+			"outfits": outfits,
+			"message": outfitMessage(anchor, outfits),
+		},
+		NextActions: actions,
+		Success:     true,
+	}, nil
+}
+
+// anchorFromResults picks the top search result that suits the occasion.
+// For a query like "what to wear to a wedding" the search results are only
+// loosely related, so an off-occasion top hit is not forced into every look.
+func anchorFromResults(results []models.Product, tags []string) *models.Product {
+	for i, product := range results {
+		if outfitSlot(product) == "" {
+			continue
+		}
+		if len(tags) == 0 {
+			return &results[i]
+		}
+		for _, tag := range tags {
+			if hasCategory(product, tag) {
+				return &results[i]
+			}
+		}
+	}
+	return nil
+}
+
+// queryTags picks out the occasion and season a query asks for.
+func queryTags(query string) []string {
+	text := normalizeQuery(query)
+	var tags []string
+	for _, occasion := range occasionTags {
+		if occasion.pattern.MatchString(text) {
+			tags = append(tags, occasion.tags...)
+		}
+	}
+	return tags
+}
+
+// ComposeOutfits builds up to three outfits. Each contains the anchor (when
+// given) and the best compatible item for every other required slot, plus
+// optional pieces where a compatible one exists. Every template the anchor
+// fits is tried, with variations that swap in the next-best item for the
+// first slot that has one, and the best-scoring outfits are kept.
+func (st *StylistAgent) ComposeOutfits(anchor *models.Product, tags []string, preferences map[string]string) []models.Outfit {
+	bySlot := make(map[string][]models.Product)
+	for _, product := range st.catalog.Products() {
+		if slot := outfitSlot(product); slot != "" {
+			bySlot[slot] = append(bySlot[slot], product)
+		}
+	}
+	budget, _ := strconv.ParseFloat(preferences["budget"], 64)
+
+	type scoredOutfit struct {
+		outfit models.Outfit
+		score  float64
+	}
+	var candidates []scoredOutfit
+	seen := make(map[string]bool)
+	for _, template := range templatesFor(anchor) {
+		for variation := 0; variation < maxOutfits; variation++ {
+			outfit, ok := st.composeOutfit(template, anchor, bySlot, tags, preferences, variation)
+			if !ok || (budget > 0 && priceValue(outfit.Total) > budget) {
+				continue
+			}
+			key := outfitKey(outfit)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			score := 0.0
+			for _, item := range outfit.Items {
+				score += stylistScore(item.Product, tags, preferences)
+			}
+			candidates = append(candidates, scoredOutfit{outfit, score / float64(len(outfit.Items))})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	var outfits []models.Outfit
+	for _, candidate := range candidates[:min(len(candidates), maxOutfits)] {
+		outfits = append(outfits, candidate.outfit)
+	}
+	return outfits
+}
+
+// templatesFor lists the outfit templates with a slot for the anchor.
+func templatesFor(anchor *models.Product) []outfitTemplate {
+	if anchor == nil {
+		return outfitTemplates
+	}
+	slot := outfitSlot(*anchor)
+	var templates []outfitTemplate
+	for _, template := range outfitTemplates {
+		if contains(template.required, slot) || contains(template.optional, slot) {
+			templates = append(templates, template)
+		}
+	}
+	return templates
+}
+
+func (st *StylistAgent) composeOutfit(template outfitTemplate, anchor *models.Product, bySlot map[string][]models.Product, tags []string, preferences map[string]string, variation int) (models.Outfit, bool) {
+	outfit := models.Outfit{}
+	var chosen []models.Product
+	accent := ""
+
+	add := func(slot string, product models.Product) {
+		color := pickColor(product, accent, preferences)
+		if color != "" && !neutralColors[color] {
+			accent = color
+		}
+		outfit.Items = append(outfit.Items, models.OutfitItem{Slot: slot, Product: product, Color: color})
+		chosen = append(chosen, product)
+	}
+
+	anchorSlot := ""
+	if anchor != nil {
+		anchorSlot = outfitSlot(*anchor)
+		add(anchorSlot, *anchor)
+	}
+
+	for _, slot := range append(append([]string{}, template.required...), template.optional...) {
+		if slot == anchorSlot {
+			continue
+		}
+		candidates := st.rankCandidates(bySlot[slot], chosen, accent, tags, preferences)
+		if len(candidates) == 0 {
+			if contains(template.required, slot) {
+				return outfit, false
+			}
+			continue
+		}
+
+		pick := 0
+		if variation > 0 && variation < len(candidates) {
+			pick, variation = variation, 0
+		}
+		add(slot, candidates[pick])
+	}
+	if variation > 0 {
+		// No slot had enough alternatives for this variation
+		return outfit, false
+	}
+
+	outfit.Total = outfitTotal(outfit.Items)
+	outfit.Name = outfitName(template, tags, outfit.Items)
+	return outfit, true
+}
+
+// rankCandidates keeps the products that go with what has been chosen and
+// orders them by fit with the occasion and the user's preferences.
+func (st *StylistAgent) rankCandidates(products, chosen []models.Product, accent string, tags []string, preferences map[string]string) []models.Product {
+	type candidate struct {
+		product models.Product
+		score   float64
+	}
+
+	var candidates []candidate
+	for _, product := range products {
+		if !compatible(product, chosen, tags) || !hasStock(product) {
+			continue
+		}
+		if accent != "" && len(product.Variants) > 0 && pickColor(product, accent, preferences) == "" {
+			continue
+		}
+		candidates = append(candidates, candidate{product, stylistScore(product, tags, preferences)})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	ranked := make([]models.Product, len(candidates))
+	for i, c := range candidates {
+		ranked[i] = c.product
+	}
+	return ranked
+}
+
+func stylistScore(product models.Product, tags []string, preferences map[string]string) float64 {
+	score := product.Rating / 5
+	for _, tag := range tags {
+		if hasCategory(product, tag) {
+			score += 1
+		}
+	}
+	if style := preferences["style"]; style != "" && hasCategory(product, style) {
+		score += 0.75
+	}
+	for _, brand := range preferenceList(preferences, "brands") {
+		if strings.EqualFold(product.Brand, brand) {
+			score += 0.5
+		}
+	}
+	for _, color := range preferenceList(preferences, "colors") {
+		if contains(productColors(product), color) {
+			score += 0.5
+		}
+	}
+	return score
+}
+
+// compatible rejects a product whose tags clash with the outfit so far or
+// with the occasion asked for.
+func compatible(product models.Product, chosen []models.Product, tags []string) bool {
+	for _, pair := range clashingTags {
+		for _, tag := range tags {
+			if (tag == pair[0] && hasCategory(product, pair[1])) || (tag == pair[1] && hasCategory(product, pair[0])) {
+				return false
+			}
+		}
+		for _, other := range chosen {
+			if (hasCategory(product, pair[0]) && hasCategory(other, pair[1])) ||
+				(hasCategory(product, pair[1]) && hasCategory(other, pair[0])) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pickColor chooses an in-stock colour for a product: the user's favourite
+// if available, else a neutral, else a new accent when the outfit has none.
+// It returns "" for products without colour variants, or when every colour
+// would add a second accent.
+func pickColor(product models.Product, accent string, preferences map[string]string) string {
+	var inStock []string
+	for _, color := range productColors(product) {
+		for _, variant := range product.Variants {
+			if variant.Color == color && variant.Stock > 0 {
+				inStock = append(inStock, color)
+				break
+			}
+		}
+	}
+
+	allowed := func(color string) bool {
+		return neutralColors[color] || accent == "" || color == accent
+	}
+	for _, favourite := range preferenceList(preferences, "colors") {
+		if contains(inStock, favourite) && allowed(favourite) {
+			return favourite
+		}
+	}
+	for _, color := range inStock {
+		if neutralColors[color] {
+			return color
+		}
+	}
+	for _, color := range inStock {
+		if allowed(color) {
+			return color
+		}
+	}
+	return ""
+}
+
+func hasStock(product models.Product) bool {
+	if len(product.Variants) == 0 {
+		return true
+	}
+	for _, variant := range product.Variants {
+		if variant.Stock > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func outfitSlot(product models.Product) string {
+	for _, slot := range slotCategories {
+		for _, category := range slot.categories {
+			if hasCategory(product, category) {
+				return slot.slot
+			}
+		}
+	}
+	return ""
+}
+
+// preferenceList splits a comma-separated preference such as "navy, black".
+func preferenceList(preferences map[string]string, key string) []string {
+	var values []string
+	for _, value := range strings.Split(preferences[key], ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func outfitTotal(items []models.OutfitItem) models.Money {
+	var total models.Money
+	for i, item := range items {
+		price := item.Product.PriceUsd
+		for _, variant := range item.Product.Variants {
+			if variant.Color == item.Color {
+				price = variantPrice(item.Product, variant)
+				break
+			}
+		}
+		if i == 0 {
+			total = price
+			continue
+		}
+		if sum, err := total.Add(price); err == nil {
+			total = sum
+		}
+	}
+	return total
+}
+
+func outfitName(template outfitTemplate, tags []string, items []models.OutfitItem) string {
+	occasion := "Everyday"
+	if len(tags) > 0 {
+		occasion = strings.ToUpper(tags[0][:1]) + tags[0][1:]
+	}
+	if len(items) > 0 {
+		return fmt.Sprintf("%s look with the %s", occasion, items[0].Product.Name)
+	}
+	return fmt.Sprintf("%s %s look", occasion, template.name)
+}
+
+func outfitKey(outfit models.Outfit) string {
+	ids := make([]string, len(outfit.Items))
+	for i, item := range outfit.Items {
+		ids[i] = item.Product.ID
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func outfitMessage(anchor *models.Product, outfits []models.Outfit) string {
+	switch {
+	case len(outfits) == 0:
+		return "I couldn't put together a complete outfit from what's in stock right now."
+	case anchor != nil:
+		return fmt.Sprintf("Here are %d ways to wear the %s, with everything you need to complete the look.", len(outfits), anchor.Name)
+	default:
+		return fmt.Sprintf("Here are %d outfit ideas put together from our catalogue.", len(outfits))
+	}
+}
+
+func (st *StylistAgent) Shutdown(ctx context.Context) error {
+	return nil
+}
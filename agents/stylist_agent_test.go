@@ -0,0 +1,263 @@
+package agents
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"celeste/models"
+)
+
+// wardrobeItem is a product stocked in each of the given colours.
+func wardrobeItem(id string, price int64, colors []string, categories ...string) models.Product {
+	product := testProduct(id, id, price, categories...)
+	product.Variants = nil
+	for _, color := range colors {
+		product.Variants = append(product.Variants, models.Variant{SKU: id + "-" + color, Color: color, Stock: 2})
+	}
+	return product
+}
+
+func testWardrobe() []models.Product {
+	return []models.Product{
+		wardrobeItem("tee", 20, []string{"white"}, "tops", "casual"),
+		wardrobeItem("blouse", 60, []string{"red"}, "tops", "evening"),
+		wardrobeItem("jeans", 50, []string{"navy"}, "jeans", "casual"),
+		wardrobeItem("trousers", 80, []string{"black", "green"}, "trousers", "evening"),
+		wardrobeItem("sneakers", 70, []string{"white"}, "sneakers", "casual"),
+		wardrobeItem("heels", 90, []string{"black", "red"}, "shoes", "evening"),
+		wardrobeItem("gown", 200, []string{"blue"}, "dresses", "occasion", "evening"),
+		wardrobeItem("parka", 150, []string{"khaki"}, "jackets", "winter"),
+		wardrobeItem("sandals", 40, []string{"tan"}, "shoes", "summer"),
+	}
+}
+
+func TestOutfitSlot(t *testing.T) {
+	tests := []struct {
+		categories []string
+		want       string
+	}{
+		{[]string{"dresses", "occasion"}, "dress"},
+		{[]string{"bags", "leather", "accessories"}, "bag"},
+		{[]string{"coats"}, "outerwear"},
+		{[]string{"boots"}, "shoes"},
+		{[]string{"skirts"}, "bottom"},
+		{[]string{"knitwear"}, "top"},
+		{[]string{"scarves"}, "accessory"},
+		{[]string{"home"}, ""},
+	}
+	for _, tt := range tests {
+		if got := outfitSlot(testProduct("p", "Product", 10, tt.categories...)); got != tt.want {
+			t.Errorf("outfitSlot(%v) = %q, want %q", tt.categories, got, tt.want)
+		}
+	}
+}
+
+func TestPickColor(t *testing.T) {
+	product := wardrobeItem("heels", 90, []string{"red", "green", "black"}, "shoes")
+	product.Variants[1].Stock = 0
+
+	tests := []struct {
+		name        string
+		product     models.Product
+		accent      string
+		preferences map[string]string
+		want        string
+	}{
+		{name: "neutral first", product: product, want: "black"},
+		{name: "favourite", product: product, preferences: map[string]string{"colors": "Green, red"}, want: "red"},
+		{name: "favourite clashes with the accent", product: product, accent: "blue", preferences: map[string]string{"colors": "red"}, want: "black"},
+		{name: "accent when no neutral", product: wardrobeItem("top", 10, []string{"red", "green"}, "tops"), want: "red"},
+		{name: "matches the accent", product: wardrobeItem("top", 10, []string{"red", "green"}, "tops"), accent: "green", want: "green"},
+		{name: "would add a second accent", product: wardrobeItem("top", 10, []string{"red"}, "tops"), accent: "green", want: ""},
+		{name: "no colour variants", product: models.Product{ID: "bag", Categories: []string{"bags"}}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := pickColor(tt.product, tt.accent, tt.preferences); got != tt.want {
+			t.Errorf("%s: pickColor = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	winter := testProduct("parka", "Parka", 150, "jackets", "winter")
+	summer := testProduct("sandals", "Sandals", 40, "shoes", "summer")
+	casual := testProduct("tee", "Tee", 20, "tops", "casual")
+
+	tests := []struct {
+		name    string
+		product models.Product
+		chosen  []models.Product
+		tags    []string
+		want    bool
+	}{
+		{name: "nothing chosen", product: winter, want: true},
+		{name: "season clash", product: summer, chosen: []models.Product{winter}, want: false},
+		{name: "clash in either order", product: winter, chosen: []models.Product{casual, summer}, want: false},
+		{name: "occasion asked for", product: casual, tags: []string{"occasion", "evening"}, want: false},
+		{name: "unrelated tags", product: casual, chosen: []models.Product{winter}, tags: []string{"evening"}, want: false},
+		{name: "no clash", product: casual, chosen: []models.Product{winter}, want: true},
+	}
+	for _, tt := range tests {
+		if got := compatible(tt.product, tt.chosen, tt.tags); got != tt.want {
+			t.Errorf("%s: compatible = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTags(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"what should I wear to a wedding?", []string{"occasion", "evening"}},
+		{"outfit for date night", []string{"occasion", "evening"}},
+		{"something for the weekend", []string{"casual"}},
+		{"a job interview in winter", []string{"workwear", "winter"}},
+		{"show me some outfits", nil},
+	}
+	for _, tt := range tests {
+		if got := queryTags(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("queryTags(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestComposeOutfits(t *testing.T) {
+	catalog := &staticCatalog{products: testWardrobe()}
+	st := NewStylistAgent(nil, catalog)
+	byID := func(id string) *models.Product {
+		product, _ := catalog.Product(id)
+		return &product
+	}
+
+	tests := []struct {
+		name        string
+		anchor      *models.Product
+		tags        []string
+		preferences map[string]string
+		wantCount   int
+		wantSlots   []string // of the first outfit
+	}{
+		{name: "anchored on a top", anchor: byID("tee"), wantCount: 2, wantSlots: []string{"top", "bottom", "shoes", "outerwear"}},
+		{name: "anchored on a dress", anchor: byID("gown"), tags: []string{"occasion", "evening"}, wantCount: 2, wantSlots: []string{"dress", "shoes", "outerwear"}},
+		{name: "from scratch for an evening", tags: []string{"occasion", "evening"}, wantCount: 3},
+		{name: "within budget", anchor: byID("gown"), preferences: map[string]string{"budget": "250"}, wantCount: 1, wantSlots: []string{"dress", "shoes"}},
+		{name: "over budget", anchor: byID("gown"), preferences: map[string]string{"budget": "200"}, wantCount: 0},
+		{name: "anchor without a slot", anchor: &models.Product{ID: "lamp", Categories: []string{"home"}}, wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outfits := st.ComposeOutfits(tt.anchor, tt.tags, tt.preferences)
+			if len(outfits) != tt.wantCount {
+				t.Fatalf("composed %d outfits, want %d: %+v", len(outfits), tt.wantCount, outfits)
+			}
+
+			seen := make(map[string]bool)
+			for _, outfit := range outfits {
+				if tt.anchor != nil && outfit.Items[0].Product.ID != tt.anchor.ID {
+					t.Errorf("outfit %q does not start with the anchor", outfit.Name)
+				}
+				if budget, _ := strconv.ParseFloat(tt.preferences["budget"], 64); budget > 0 && priceValue(outfit.Total) > budget {
+					t.Errorf("outfit %q costs %v, over the budget of %v", outfit.Name, outfit.Total, budget)
+				}
+				if key := outfitKey(outfit); seen[key] {
+					t.Errorf("outfit %s suggested twice", key)
+				} else {
+					seen[key] = true
+				}
+
+				accents := make(map[string]bool)
+				var chosen []models.Product
+				for _, item := range outfit.Items {
+					if item.Color != "" && !neutralColors[item.Color] {
+						accents[item.Color] = true
+					}
+					if !compatible(item.Product, chosen, tt.tags) {
+						t.Errorf("%s clashes with the rest of %q", item.Product.ID, outfit.Name)
+					}
+					chosen = append(chosen, item.Product)
+				}
+				if len(accents) > 1 {
+					t.Errorf("outfit %q has accents %v, want at most one", outfit.Name, accents)
+				}
+			}
+
+			if tt.wantSlots != nil {
+				var slots []string
+				for _, item := range outfits[0].Items {
+					slots = append(slots, item.Slot)
+				}
+				if !reflect.DeepEqual(slots, tt.wantSlots) {
+					t.Errorf("first outfit slots = %v, want %v", slots, tt.wantSlots)
+				}
+			}
+		})
+	}
+}
+
+func TestOutfitTotal(t *testing.T) {
+	heels := wardrobeItem("heels", 90, []string{"black", "red"}, "shoes")
+	override := models.Money{CurrencyCode: "USD", Units: 75}
+	heels.Variants[1].PriceUsd = &override
+
+	items := []models.OutfitItem{
+		{Product: wardrobeItem("tee", 20, []string{"white"}, "tops"), Color: "white"},
+		{Product: heels, Color: "red"},
+		{Product: testProduct("bag", "Bag", 30, "bags")},
+	}
+	if total := outfitTotal(items); total != (models.Money{CurrencyCode: "USD", Units: 125}) {
+		t.Errorf("outfitTotal = %+v, want $125 with the red heels' own price", total)
+	}
+}
+
+func TestStylistProcessAnchor(t *testing.T) {
+	st := NewStylistAgent(nil, &staticCatalog{products: testWardrobe()})
+
+	tests := []struct {
+		name       string
+		data       map[string]interface{}
+		context    *models.UserContext
+		wantAnchor string
+	}{
+		{
+			name:       "anchor_id",
+			data:       map[string]interface{}{"query": "style this", "anchor_id": "jeans"},
+			context:    &models.UserContext{RecentProducts: []string{"tee"}},
+			wantAnchor: "jeans",
+		},
+		{
+			name:       "complete the look uses the last product shown",
+			data:       map[string]interface{}{"query": "what goes with it?"},
+			context:    &models.UserContext{RecentProducts: []string{"trousers", "tee"}},
+			wantAnchor: "trousers",
+		},
+		{
+			name: "occasion picks a suitable search result",
+			data: map[string]interface{}{
+				"query":    "what to wear to a wedding",
+				"products": []models.Product{testWardrobe()[0], testWardrobe()[6]},
+			},
+			wantAnchor: "gown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := st.Process(context.Background(), models.AgentMessage{Data: tt.data, Context: tt.context})
+			if err != nil {
+				t.Fatal(err)
+			}
+			outfits, _ := response.Data["outfits"].([]models.Outfit)
+			if len(outfits) == 0 {
+				t.Fatalf("no outfits: %v", response.Data["message"])
+			}
+			if anchor := outfits[0].Items[0].Product.ID; anchor != tt.wantAnchor {
+				t.Errorf("anchor = %q, want %q", anchor, tt.wantAnchor)
+			}
+			if response.NextActions[0] != "Add outfit to cart" {
+				t.Errorf("next actions = %v", response.NextActions)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package agents
+
+import (
+	"strings"
+	"unicode"
+)
+
+// tokenize lower-cases text and splits it into alphanumeric words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,68 @@
+package agents
+
+import (
+	"strings"
+
+	"celeste/models"
+)
+
+// productSizes lists the distinct sizes a product comes in, in catalogue order.
+func productSizes(product models.Product) []string {
+	return variantValues(product, func(v models.Variant) string { return v.Size })
+}
+
+// productColors lists the distinct colours a product comes in, in catalogue order.
+func productColors(product models.Product) []string {
+	return variantValues(product, func(v models.Variant) string { return v.Color })
+}
+
+func variantValues(product models.Product, value func(models.Variant) string) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, variant := range product.Variants {
+		if v := value(variant); v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// variantPrice is the price of a variant, falling back to the product price.
+func variantPrice(product models.Product, variant models.Variant) models.PriceUsd {
+	if variant.PriceUsd != nil {
+		return *variant.PriceUsd
+	}
+	return product.PriceUsd
+}
+
+// matchingVariants returns the variants with the requested size and colour
+// (either may be empty to match any). Both must hold for the same variant:
+// a product in black and in size 9 does not match "black, size 9" unless one
+// SKU is both.
+func matchingVariants(product models.Product, size, color string) []models.Variant {
+	var matches []models.Variant
+	for _, variant := range product.Variants {
+		if size != "" && !strings.EqualFold(variant.Size, size) {
+			continue
+		}
+		if color != "" && !strings.EqualFold(variant.Color, color) {
+			continue
+		}
+		matches = append(matches, variant)
+	}
+	return matches
+}
+
+// lowestPrice is the cheapest of the given variants, or the product price
+// when there are none.
+func lowestPrice(product models.Product, variants []models.Variant) float64 {
+	if len(variants) == 0 {
+		return priceValue(product.PriceUsd)
+	}
+	lowest := priceValue(variantPrice(product, variants[0]))
+	for _, variant := range variants[1:] {
+		lowest = min(lowest, priceValue(variantPrice(product, variant)))
+	}
+	return lowest
+}
@@ -0,0 +1,87 @@
+package agents
+
+import (
+	"slices"
+	"testing"
+
+	"celeste/models"
+)
+
+// testVariantProduct is a $60 product in black sizes 8 and 9 and brown size
+// 9, the brown one discounted to $45.
+func testVariantProduct() models.Product {
+	product := testProduct("boot", "Chelsea Boot", 60, "boots")
+	product.Variants = []models.Variant{
+		{SKU: "boot-bla-8", Color: "black", Size: "8", Stock: 2},
+		{SKU: "boot-bla-9", Color: "black", Size: "9", Stock: 0},
+		{SKU: "boot-bro-9", Color: "brown", Size: "9", Stock: 5, PriceUsd: &models.Money{CurrencyCode: "USD", Units: 45}},
+	}
+	return product
+}
+
+func TestMatchingVariants(t *testing.T) {
+	product := testVariantProduct()
+	tests := []struct {
+		size, color string
+		want        []string
+	}{
+		{"", "", []string{"boot-bla-8", "boot-bla-9", "boot-bro-9"}},
+		{"9", "", []string{"boot-bla-9", "boot-bro-9"}},
+		{"", "BLACK", []string{"boot-bla-8", "boot-bla-9"}},
+		{"9", "brown", []string{"boot-bro-9"}},
+		// Black and size 8 exist, but not as one SKU
+		{"8", "brown", nil},
+	}
+	for _, tt := range tests {
+		var skus []string
+		for _, variant := range matchingVariants(product, tt.size, tt.color) {
+			skus = append(skus, variant.SKU)
+		}
+		if !slices.Equal(skus, tt.want) {
+			t.Errorf("matchingVariants(%q, %q) = %v, want %v", tt.size, tt.color, skus, tt.want)
+		}
+	}
+}
+
+func TestVariantPrices(t *testing.T) {
+	product := testVariantProduct()
+	if price := variantPrice(product, product.Variants[0]); price.Units != 60 {
+		t.Errorf("price of a variant without its own = %v, want the product's 60", price)
+	}
+	if price := variantPrice(product, product.Variants[2]); price.Units != 45 {
+		t.Errorf("price of the overridden variant = %v, want 45", price)
+	}
+
+	tests := []struct {
+		name     string
+		variants []models.Variant
+		want     float64
+	}{
+		{"all variants", product.Variants, 45},
+		{"without the override", product.Variants[:2], 60},
+		{"no variants", nil, 60},
+	}
+	for _, tt := range tests {
+		if got := lowestPrice(product, tt.variants); got != tt.want {
+			t.Errorf("lowestPrice with %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The price facet counts a product in the bucket that filtering on it
+// returns the product for, even when a variant overrides the price.
+func TestPriceFacetMatchesFilter(t *testing.T) {
+	sa := testSearchAgent([]models.Product{testVariantProduct()})
+	results := []models.ScoredProduct{{Product: testVariantProduct()}}
+
+	facets := sa.computeFacets(results)
+	if len(facets["price"]) != 1 || facets["price"][0] != (models.FacetValue{Value: "25-50", Count: 1}) {
+		t.Fatalf("price facet = %+v, want one product at 25-50", facets["price"])
+	}
+	if filtered := sa.applyFilters(results, map[string]string{"price": "25-50"}); len(filtered) != 1 {
+		t.Errorf("filtering on the facet's bucket returned %d products, want 1", len(filtered))
+	}
+	if filtered := sa.applyFilters(results, map[string]string{"price": "50-100"}); len(filtered) != 0 {
+		t.Errorf("filtering on the product price's bucket returned %d products, want 0", len(filtered))
+	}
+}
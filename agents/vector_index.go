@@ -0,0 +1,194 @@
+package agents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"celeste/models"
+)
+
+const embeddingBatchSize = 100
+
+type storedVector struct {
+	ID     string    `json:"id"`
+	Hash   string    `json:"hash"`
+	Vector []float32 `json:"vector"`
+}
+
+type vectorFile struct {
+	Model   string         `json:"model"`
+	Vectors []storedVector `json:"vectors"`
+}
+
+// VectorIndex is a flat (brute-force cosine) index of product embeddings,
+// persisted to a JSON file so unchanged products are not re-embedded.
+type VectorIndex struct {
+	embedder Embedder
+	path     string
+	vectors  map[string]storedVector
+	mutex    sync.RWMutex
+}
+
+func NewVectorIndex(embedder Embedder, path string) *VectorIndex {
+	return &VectorIndex{
+		embedder: embedder,
+		path:     path,
+		vectors:  make(map[string]storedVector),
+	}
+}
+
+// Build embeds every product whose text changed since the cached file was
+// written, then saves the refreshed file.
+func (vi *VectorIndex) Build(ctx context.Context, products []models.Product) error {
+	cached := vi.load()
+
+	vectors := make(map[string]storedVector, len(products))
+	var pending []models.Product
+	for _, product := range products {
+		hash := productTextHash(product)
+		if stored, ok := cached[product.ID]; ok && stored.Hash == hash {
+			vectors[product.ID] = stored
+			continue
+		}
+		pending = append(pending, product)
+	}
+
+	for start := 0; start < len(pending); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(pending))
+		batch := pending[start:end]
+
+		texts := make([]string, len(batch))
+		for i, product := range batch {
+			texts[i] = productText(product)
+		}
+
+		embeddings, err := vi.embedder.Embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("embedding products with %s: %v", vi.embedder.Name(), err)
+		}
+		for i, product := range batch {
+			vectors[product.ID] = storedVector{ID: product.ID, Hash: productTextHash(product), Vector: embeddings[i]}
+		}
+	}
+
+	vi.mutex.Lock()
+	vi.vectors = vectors
+	vi.mutex.Unlock()
+
+	if len(pending) > 0 {
+		return vi.save()
+	}
+	return nil
+}
+
+// Upsert embeds a single product and saves the index.
+func (vi *VectorIndex) Upsert(ctx context.Context, product models.Product) error {
+	embeddings, err := vi.embedder.Embed(ctx, []string{productText(product)})
+	if err != nil {
+		return fmt.Errorf("embedding product %s: %v", product.ID, err)
+	}
+
+	vi.mutex.Lock()
+	vi.vectors[product.ID] = storedVector{ID: product.ID, Hash: productTextHash(product), Vector: embeddings[0]}
+	vi.mutex.Unlock()
+	return vi.save()
+}
+
+func (vi *VectorIndex) Remove(id string) error {
+	vi.mutex.Lock()
+	delete(vi.vectors, id)
+	vi.mutex.Unlock()
+	return vi.save()
+}
+
+// Search returns the cosine similarity between the query and every product.
+func (vi *VectorIndex) Search(ctx context.Context, query string) (map[string]float64, error) {
+	embeddings, err := vi.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	vi.mutex.RLock()
+	defer vi.mutex.RUnlock()
+
+	similarities := make(map[string]float64, len(vi.vectors))
+	for id, stored := range vi.vectors {
+		similarities[id] = cosineSimilarity(embeddings[0], stored.Vector)
+	}
+	return similarities, nil
+}
+
+func (vi *VectorIndex) load() map[string]storedVector {
+	cached := make(map[string]storedVector)
+	if vi.path == "" {
+		return cached
+	}
+
+	data, err := os.ReadFile(vi.path)
+	if err != nil {
+		return cached
+	}
+
+	var file vectorFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Model != vi.embedder.Name() {
+		return cached
+	}
+	for _, stored := range file.Vectors {
+		cached[stored.ID] = stored
+	}
+	return cached
+}
+
+func (vi *VectorIndex) save() error {
+	if vi.path == "" {
+		return nil
+	}
+
+	vi.mutex.RLock()
+	file := vectorFile{Model: vi.embedder.Name()}
+	for _, stored := range vi.vectors {
+		file.Vectors = append(file.Vectors, stored)
+	}
+	vi.mutex.RUnlock()
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	// Write a temporary file and rename it over the old one so a crash
+	// mid-write cannot leave a truncated file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(vi.path), ".productEmbeddings-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), vi.path)
+}
+
+func productText(product models.Product) string {
+	return strings.Join([]string{product.Name, product.Description, strings.Join(product.Categories, " "), productAttributes(product)}, ". ")
+}
+
+func productTextHash(product models.Product) string {
+	sum := sha256.Sum256([]byte(productText(product)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,108 @@
+package agents
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"celeste/models"
+)
+
+// countingEmbedder records how many texts it embedded and, when started is
+// set, blocks in Embed until release is closed.
+type countingEmbedder struct {
+	Embedder
+	texts   int
+	started chan struct{}
+	release chan struct{}
+}
+
+func (ce *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	ce.texts += len(texts)
+	if ce.started != nil {
+		close(ce.started)
+		<-ce.release
+	}
+	return ce.Embedder.Embed(ctx, texts)
+}
+
+func TestVectorIndexReusesSavedVectors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "productEmbeddings.json")
+	products := []models.Product{
+		testProduct("b1", "Leather Boot", 120, "shoes", "boots"),
+		testProduct("s1", "Canvas Sneaker", 60, "shoes", "sneakers"),
+	}
+
+	embedder := &countingEmbedder{Embedder: NewHashingEmbedder(64)}
+	if err := NewVectorIndex(embedder, path).Build(context.Background(), products); err != nil {
+		t.Fatalf("first build: %v", err)
+	}
+	if embedder.texts != 2 {
+		t.Fatalf("first build embedded %d texts, want 2", embedder.texts)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "productEmbeddings.json" {
+		t.Errorf("directory holds %v, want only productEmbeddings.json", entries)
+	}
+
+	products[1].Description = "Now with a thicker sole"
+	embedder.texts = 0
+	vectors := NewVectorIndex(embedder, path)
+	if err := vectors.Build(context.Background(), products); err != nil {
+		t.Fatalf("second build: %v", err)
+	}
+	if embedder.texts != 1 {
+		t.Errorf("second build embedded %d texts, want only the changed product", embedder.texts)
+	}
+
+	similarities, err := vectors.Search(context.Background(), "leather boot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if similarities["b1"] <= similarities["s1"] {
+		t.Errorf("similarities = %v, want the boot closest to \"leather boot\"", similarities)
+	}
+}
+
+func TestFindProductEmbedsOutsideCatalogLock(t *testing.T) {
+	products := []models.Product{testProduct("b1", "Leather Boot", 120, "shoes", "boots")}
+	embedder := &countingEmbedder{Embedder: NewHashingEmbedder(64)}
+	sa := testSearchAgent(products)
+	sa.vectors = NewVectorIndex(embedder, "")
+	if err := sa.vectors.Build(context.Background(), products); err != nil {
+		t.Fatal(err)
+	}
+
+	embedder.started = make(chan struct{})
+	embedder.release = make(chan struct{})
+	found := make(chan models.Product)
+	go func() {
+		product, _ := sa.FindProduct(context.Background(), "leather boot")
+		found <- product
+	}()
+	<-embedder.started
+
+	locked := make(chan struct{})
+	go func() {
+		sa.catalogMutex.Lock()
+		sa.catalogMutex.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("catalogue lock was held while the query was being embedded")
+	}
+
+	close(embedder.release)
+	if product := <-found; product.ID != "b1" {
+		t.Errorf("FindProduct = %q, want b1", product.ID)
+	}
+}
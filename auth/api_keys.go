@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyPrefix = "cel_"
+)
+
+// KeysPath is CELESTE_API_KEYS_PATH, or data/apiKeys.json.
+func KeysPath() string {
+	if path := os.Getenv("CELESTE_API_KEYS_PATH"); path != "" {
+		return path
+	}
+	return "data/apiKeys.json"
+}
+
+// APIKey is a key as stored: only its SHA-256 hash is kept.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"hash"` // Hex SHA-256 of the key
+	UserID string   `json:"user_id"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type keysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// APIKeys authenticates requests by the key in their X-API-Key header.
+type APIKeys struct {
+	keys map[string]APIKey // By hash
+}
+
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	keys := make(map[string]APIKey, len(file.Keys))
+	for _, key := range file.Keys {
+		key.Hash = strings.ToLower(key.Hash)
+		if decoded, err := hex.DecodeString(key.Hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("key %q: hash must be a hex SHA-256", key.ID)
+		}
+		if key.UserID == "" {
+			return nil, fmt.Errorf("key %q: user_id is required", key.ID)
+		}
+		keys[key.Hash] = key
+	}
+	return &APIKeys{keys: keys}, nil
+}
+
+func (ak *APIKeys) Authenticate(r *http.Request) (Principal, error) {
+	presented := r.Header.Get(apiKeyHeader)
+	if presented == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	// Looked up by hash, so timing reveals nothing about stored keys
+	key, ok := ak.keys[HashKey(presented)]
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return Principal{UserID: key.UserID, Scopes: key.Scopes, Method: "api_key", KeyID: key.ID}, nil
+}
+
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateKey returns a new random API key and its stored form.
+func GenerateKey(id, userID string, scopes []string) (string, APIKey) {
+	key := apiKeyPrefix + strings.ToLower(rand.Text())
+	return key, APIKey{ID: id, Hash: HashKey(key), UserID: userID, Scopes: scopes}
+}
@@ -0,0 +1,130 @@
+// Package auth authenticates API requests by API key, HMAC-signed token or
+// JWT, and checks the scopes routes require.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// Scopes. ScopeAdmin grants every other scope.
+const (
+	ScopeAdmin   = "admin"
+	ScopeAgents  = "admin:agents"  // Agent listing and metrics
+	ScopeCatalog = "admin:catalog" // Catalogue changes, imports and reloads
+	ScopeUsers   = "admin:users"   // Any user's alerts, preferences and history
+)
+
+var (
+	// ErrNoCredentials means a request carries no credentials of the kind
+	// an Authenticator checks, so the next one should try.
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	UserID string   `json:"user_id"`
+	Scopes []string `json:"scopes,omitempty"`
+	Method string   `json:"method"`           // api_key, token or jwt
+	KeyID  string   `json:"key_id,omitempty"` // The API key's ID
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// An Authenticator checks one kind of credential. It returns
+// ErrNoCredentials when the request carries none of its kind.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal a request was authenticated as.
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// Middleware authenticates requests with the first authenticator that
+// finds credentials of its kind. Requests without credentials go through
+// unauthenticated, for routes to accept or refuse; invalid credentials are
+// refused outright. With no authenticators it is disabled: nobody can
+// authenticate, so routes that require it stay closed.
+type Middleware struct {
+	authenticators []Authenticator
+}
+
+func NewMiddleware(authenticators ...Authenticator) *Middleware {
+	return &Middleware{authenticators: authenticators}
+}
+
+func (m *Middleware) Enabled() bool {
+	return len(m.authenticators) > 0
+}
+
+// Handler is a mux.MiddlewareFunc.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, authenticator := range m.authenticators {
+			principal, err := authenticator.Authenticate(r)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				Unauthorized(w, err.Error())
+				return
+			}
+			r = r.WithContext(WithPrincipal(r.Context(), principal))
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Require only lets through requests from principals with scope, or any
+// principal when scope is empty.
+func (m *Middleware) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := FromContext(r.Context())
+		switch {
+		case !m.Enabled():
+			Disabled(w)
+		case !ok:
+			Unauthorized(w, "authentication required")
+		case scope != "" && !principal.HasScope(scope):
+			http.Error(w, "missing scope "+scope, http.StatusForbidden)
+		default:
+			next(w, r)
+		}
+	}
+}
+
+// Unauthorized refuses a request that needs credentials it lacks.
+func Unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="celeste"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// Disabled refuses a request that needs authentication while none is
+// configured.
+func Disabled(w http.ResponseWriter) {
+	http.Error(w, "authentication is disabled on this server", http.StatusForbidden)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && (header[:7] == "Bearer " || header[:7] == "bearer ") {
+		return header[7:]
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type staticAuthenticator struct {
+	principal Principal
+	err       error
+}
+
+func (sa staticAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	if r.Header.Get("Authorization") == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	return sa.principal, sa.err
+}
+
+func TestRequire(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	catalogAdmin := NewMiddleware(staticAuthenticator{principal: Principal{UserID: "ops", Scopes: []string{ScopeCatalog}}})
+	admin := NewMiddleware(staticAuthenticator{principal: Principal{UserID: "root", Scopes: []string{ScopeAdmin}}})
+	invalid := NewMiddleware(staticAuthenticator{err: ErrInvalidCredentials})
+
+	tests := []struct {
+		name        string
+		middleware  *Middleware
+		scope       string
+		credentials bool
+		want        int
+	}{
+		{"no credentials", catalogAdmin, ScopeCatalog, false, http.StatusUnauthorized},
+		{"scope held", catalogAdmin, ScopeCatalog, true, http.StatusOK},
+		{"scope missing", catalogAdmin, ScopeUsers, true, http.StatusForbidden},
+		{"any principal", catalogAdmin, "", true, http.StatusOK},
+		{"admin grants all", admin, ScopeUsers, true, http.StatusOK},
+		{"invalid credentials", invalid, "", true, http.StatusUnauthorized},
+		{"disabled", NewMiddleware(), ScopeCatalog, false, http.StatusForbidden},
+		{"disabled without scope", NewMiddleware(), "", false, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			if tt.credentials {
+				request.Header.Set("Authorization", "Bearer x")
+			}
+			recorder := httptest.NewRecorder()
+			tt.middleware.Handler(tt.middleware.Require(tt.scope, ok)).ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			if recorder.Code == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestMiddlewareOptionalCredentials(t *testing.T) {
+	middleware := NewMiddleware(staticAuthenticator{principal: Principal{UserID: "alice"}})
+	var authenticated bool
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, authenticated = FromContext(r.Context())
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if authenticated {
+		t.Error("authenticated a request without credentials")
+	}
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Authorization", "Bearer x")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if !authenticated {
+		t.Error("did not authenticate a request with credentials")
+	}
+}
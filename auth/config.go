@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// DisabledFromEnv reports whether CELESTE_AUTH_DISABLED=true, the operator's
+// explicit choice to run without authentication.
+func DisabledFromEnv() bool {
+	return os.Getenv("CELESTE_AUTH_DISABLED") == "true"
+}
+
+// FromEnv sets up the authenticators configured in the environment:
+//   - API keys from KeysPath, if the file exists
+//   - signed tokens when CELESTE_TOKEN_SECRET is set
+//   - JWTs against the keys at JWKSPath, if the file exists, checking
+//     CELESTE_JWT_ISSUER and CELESTE_JWT_AUDIENCE when set
+//
+// A file that exists but cannot be used is an error, so a typo does not
+// leave the server open.
+func FromEnv() ([]Authenticator, error) {
+	var authenticators []Authenticator
+
+	keys, err := LoadAPIKeys(KeysPath())
+	switch {
+	case err == nil:
+		authenticators = append(authenticators, keys)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("loading API keys: %v", err)
+	}
+
+	if secret := os.Getenv("CELESTE_TOKEN_SECRET"); secret != "" {
+		tokens, err := NewTokens(secret)
+		if err != nil {
+			return nil, fmt.Errorf("CELESTE_TOKEN_SECRET: %v", err)
+		}
+		authenticators = append(authenticators, tokens)
+	}
+
+	verifier, err := LoadJWKS(JWKSPath())
+	switch {
+	case err == nil:
+		verifier.Issuer = os.Getenv("CELESTE_JWT_ISSUER")
+		verifier.Audience = os.Getenv("CELESTE_JWT_AUDIENCE")
+		authenticators = append(authenticators, verifier)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("loading JWKS: %v", err)
+	}
+	return authenticators, nil
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How far clocks may disagree when checking exp and nbf.
+const clockSkew = time.Minute
+
+// JWKSPath is CELESTE_JWKS_PATH, or data/jwks.json.
+func JWKSPath() string {
+	if path := os.Getenv("CELESTE_JWKS_PATH"); path != "" {
+		return path
+	}
+	return "data/jwks.json"
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type verificationKey struct {
+	kid string
+	alg string // Empty when the key does not restrict it
+	key crypto.PublicKey
+}
+
+// Signature algorithms accepted, by the hash they use.
+var jwtAlgorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"` // A string or a list of them
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Scope     string          `json:"scope"` // Space-separated, as in OAuth 2.0
+	Scp       json.RawMessage `json:"scp"`   // A list or a space-separated string
+}
+
+// JWTVerifier authenticates RS256/384/512 and ES256/384/512 JWT bearer
+// tokens against the public keys of a local JWKS file. When Issuer or
+// Audience are set, tokens must match them.
+type JWTVerifier struct {
+	keys     []verificationKey
+	Issuer   string
+	Audience string
+}
+
+func LoadJWKS(path string) (*JWTVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	verifier := &JWTVerifier{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", jwk.Kid, err)
+		}
+		verifier.keys = append(verifier.keys, verificationKey{kid: jwk.Kid, alg: jwk.Alg, key: key})
+	}
+	if len(verifier.keys) == 0 {
+		return nil, fmt.Errorf("%s has no signing keys", path)
+	}
+	return verifier, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %v", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid e")
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return key, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("invalid x or y")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func (jv *JWTVerifier) Authenticate(r *http.Request) (Principal, error) {
+	token := bearerToken(r)
+	parts := strings.Split(token, ".")
+	if token == "" || len(parts) != 3 {
+		return Principal{}, ErrNoCredentials
+	}
+	claims, err := jv.verify(parts, time.Now())
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return Principal{UserID: claims.Subject, Scopes: claims.scopes(), Method: "jwt"}, nil
+}
+
+func (jv *JWTVerifier) verify(parts []string, now time.Time) (jwtClaims, error) {
+	var header jwtHeader
+	var claims jwtClaims
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("malformed header")
+	}
+	hash, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return claims, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("malformed signature")
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(parts[0] + "." + parts[1]))
+	digest := hasher.Sum(nil)
+	verified := false
+	for _, key := range jv.keys {
+		if (header.Kid != "" && key.kid != header.Kid) || (key.alg != "" && key.alg != header.Alg) {
+			continue
+		}
+		if verifySignature(header.Alg, hash, key.key, digest, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return claims, fmt.Errorf("bad signature")
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("malformed claims")
+	}
+	switch {
+	case claims.Subject == "":
+		return claims, fmt.Errorf("no subject")
+	case claims.ExpiresAt == nil:
+		return claims, fmt.Errorf("no expiry")
+	case !now.Before(time.Unix(*claims.ExpiresAt, 0).Add(clockSkew)):
+		return claims, fmt.Errorf("token expired")
+	case claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*claims.NotBefore, 0)):
+		return claims, fmt.Errorf("token not valid yet")
+	case jv.Issuer != "" && claims.Issuer != jv.Issuer:
+		return claims, fmt.Errorf("wrong issuer")
+	case jv.Audience != "" && !slices.Contains(stringList(claims.Audience), jv.Audience):
+		return claims, fmt.Errorf("wrong audience")
+	}
+	return claims, nil
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, digest, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// JWS signatures are r and s side by side, each the curve's size
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (c jwtClaims) scopes() []string {
+	scopes := strings.Fields(c.Scope)
+	for _, scope := range stringList(c.Scp) {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+	return scopes
+}
+
+// stringList reads a claim that may be a string or a list of strings.
+func stringList(raw json.RawMessage) []string {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil && single != "" {
+		return []string{single}
+	}
+	return nil
+}
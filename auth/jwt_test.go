@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+// signJWT signs header and claims with alg: RS256 and ES256 with the test
+// keys, HS256 with a shared secret, and anything else not at all.
+func (tk testKeys) signJWT(t *testing.T, header, claims map[string]interface{}) string {
+	t.Helper()
+	segment := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(header) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch header["alg"] {
+	case "RS256":
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, tk.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, tk.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	keys := newTestKeys(t)
+	verifier := &JWTVerifier{
+		keys: []verificationKey{
+			{kid: "rsa", alg: "RS256", key: &keys.rsa.PublicKey},
+			{kid: "ec", key: &keys.ec.PublicKey},
+		},
+		Issuer:   "https://issuer.example",
+		Audience: "celeste",
+	}
+	now := time.Now()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub":   "alice",
+			"iss":   "https://issuer.example",
+			"aud":   "celeste",
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "admin:catalog",
+		}
+		for key, value := range changes {
+			if value == nil {
+				delete(claims, key)
+			} else {
+				claims[key] = value
+			}
+		}
+		return claims
+	}
+	header := func(alg, kid string) map[string]interface{} {
+		return map[string]interface{}{"alg": alg, "kid": kid, "typ": "JWT"}
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", keys.signJWT(t, header("RS256", "rsa"), claims(nil)), true},
+		{"ES256", keys.signJWT(t, header("ES256", "ec"), claims(nil)), true},
+		{"ES256 without kid", keys.signJWT(t, header("ES256", ""), claims(nil)), true},
+		{"audience list", keys.signJWT(t, header("RS256", "rsa"), claims(map[string]interface{}{"aud": []string{"other", "celeste"}})), true},
+		{"expired within skew", keys.signJWT(t, header("RS256", "rsa"), claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()})), true},
+		{"alg none", keys.signJWT(t, header("none", "rsa"), claims(nil)), false},
+		{"HS256", keys.signJWT(t, header("HS256", "rsa"), claims(nil)), false},
+		{"unknown alg", keys.signJWT(t, header("PS256", "rsa"), claims(nil)), false},
+		{"kid of another key", keys.signJWT(t, header("ES256", "rsa"), claims(nil)), false},
+		{"unknown kid", keys.signJWT(t, header("RS256", "other"), claims(nil)), false},
+		{"expired", keys.signJWT(t, header("RS256", "rsa"), claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()})), false},
+		{"no expiry", keys.signJWT(t, header("RS256", "rsa"), claims(map[string]interface{}{"exp": nil})), false},
+		{"not valid yet", keys.signJWT(t, header("RS256", "rsa"), claims(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()})), false},
+		{"wrong issuer", keys.signJWT(t, header("RS256", "rsa"), claims(map[string]interface{}{"iss": "https://evil.example"})), false},
+		{"wrong audience", keys.signJWT(t, header("RS256", "rsa"), claims(map[string]interface{}{"aud": "other"})), false},
+		{"no subject", keys.signJWT(t, header("RS256", "rsa"), claims(map[string]interface{}{"sub": nil})), false},
+	}
+
+	// An ES256 signature with a byte too many must not verify, even though
+	// r and s could still be read from it
+	valid := keys.signJWT(t, header("ES256", "ec"), claims(nil))
+	dot := strings.LastIndex(valid, ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(valid[dot+1:])
+	long := valid[:dot+1] + base64.RawURLEncoding.EncodeToString(append([]byte{0}, signature...))
+	tests = append(tests, struct {
+		name  string
+		token string
+		valid bool
+	}{"ES256 signature of the wrong length", long, false})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+			principal, err := verifier.Authenticate(request)
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("rejected: %v", err)
+			case tt.valid && (principal.UserID != "alice" || !principal.HasScope(ScopeCatalog)):
+				t.Errorf("principal = %+v", principal)
+			case !tt.valid && !errors.Is(err, ErrInvalidCredentials):
+				t.Errorf("err = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierSkipsOtherTokens(t *testing.T) {
+	verifier := &JWTVerifier{}
+	for _, header := range []string{"", "Bearer abc.def", "Basic dXNlcjpwYXNz"} {
+		request := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+		if _, err := verifier.Authenticate(request); !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("%q: err = %v, want ErrNoCredentials", header, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	tokens, err := NewTokens(strings.Repeat("s", minSecretLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewTokens(strings.Repeat("o", minSecretLength))
+	issue := func(tokens *Tokens, ttl time.Duration) string {
+		token, err := tokens.Issue("alice", []string{ScopeUsers}, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := issue(tokens, time.Hour)
+	payload, signature, _ := strings.Cut(valid, ".")
+	claims, _ := base64.RawURLEncoding.DecodeString(payload)
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(claims), "alice", "mallory", 1)))
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", valid, nil},
+		{"tampered claims", tampered + "." + signature, ErrInvalidCredentials},
+		{"tampered signature", payload + "." + strings.Repeat("A", len(signature)), ErrInvalidCredentials},
+		{"other secret", issue(other, time.Hour), ErrInvalidCredentials},
+		{"expired", issue(tokens, -time.Second), ErrInvalidCredentials},
+		{"JWT", valid + ".extra", ErrNoCredentials},
+		{"no dot", payload, ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+			principal, err := tokens.Authenticate(request)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && (principal.UserID != "alice" || !principal.HasScope(ScopeUsers) || principal.Method != "token") {
+				t.Errorf("principal = %+v", principal)
+			}
+		})
+	}
+}
+
+func TestNewTokensShortSecret(t *testing.T) {
+	if _, err := NewTokens(strings.Repeat("s", minSecretLength-1)); err == nil {
+		t.Error("accepted a short secret")
+	}
+}
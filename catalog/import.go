@@ -0,0 +1,430 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"celeste/models"
+)
+
+// Supported import formats.
+const (
+	FormatCSV         = "csv"
+	FormatJSONLines   = "jsonl"
+	FormatMerchantXML = "merchant_xml"
+	FormatMerchantTSV = "merchant_tsv"
+)
+
+// DetectFormat guesses an import format from a file name or content type.
+func DetectFormat(nameOrContentType string) (string, error) {
+	value := strings.ToLower(nameOrContentType)
+	switch {
+	case strings.Contains(value, "tab-separated"), filepath.Ext(value) == ".tsv", filepath.Ext(value) == ".txt":
+		return FormatMerchantTSV, nil
+	case strings.Contains(value, "csv"):
+		return FormatCSV, nil
+	case strings.Contains(value, "ndjson"), strings.Contains(value, "jsonl"):
+		return FormatJSONLines, nil
+	case strings.Contains(value, "xml"):
+		return FormatMerchantXML, nil
+	}
+	return "", fmt.Errorf("cannot detect import format from %q", nameOrContentType)
+}
+
+// RowError reports a record that could not be imported.
+type RowError struct {
+	Row   int    `json:"row,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// Parse reads products in the given format. Records that cannot be mapped
+// onto a product are returned as row errors rather than failing the import.
+func Parse(format string, r io.Reader) ([]models.Product, []RowError, error) {
+	switch format {
+	case FormatCSV:
+		return parseDelimited(r, ',')
+	case FormatMerchantTSV:
+		return parseDelimited(r, '\t')
+	case FormatJSONLines:
+		return parseJSONLines(r)
+	case FormatMerchantXML:
+		return parseMerchantXML(r)
+	}
+	return nil, nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+// Column aliases covering our own export headers and Google Merchant Center
+// attribute names.
+var columnAliases = map[string]string{
+	"id":                      "id",
+	"sku":                     "id",
+	"name":                    "name",
+	"title":                   "name",
+	"description":             "description",
+	"picture":                 "picture",
+	"image":                   "picture",
+	"image_link":              "picture",
+	"image_url":               "picture",
+	"price":                   "price",
+	"sale_price":              "sale_price",
+	"currency":                "currency",
+	"currency_code":           "currency",
+	"categories":              "categories",
+	"category":                "categories",
+	"product_type":            "categories",
+	"google_product_category": "google_category",
+	"created_at":              "created_at",
+	"brand":                   "brand",
+	"material":                "material",
+	"rating":                  "rating",
+	"product_rating":          "rating",
+	"review_count":            "review_count",
+}
+
+type rawRecord map[string]string
+
+func parseDelimited(r io.Reader, delimiter rune) ([]models.Product, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = delimiter == '\t'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %v", err)
+	}
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[i] = columnAliases[strings.TrimPrefix(name, "g:")]
+	}
+
+	var products []models.Product
+	var rowErrors []RowError
+	for row := 2; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		record := make(rawRecord)
+		for i, value := range fields {
+			if i < len(columns) && columns[i] != "" && record[columns[i]] == "" {
+				record[columns[i]] = strings.TrimSpace(value)
+			}
+		}
+
+		product, err := record.toProduct()
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, ID: record["id"], Error: err.Error()})
+			continue
+		}
+		products = append(products, product)
+	}
+	return products, rowErrors, nil
+}
+
+func parseJSONLines(r io.Reader) ([]models.Product, []RowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	var products []models.Product
+	var rowErrors []RowError
+	for row := 1; scanner.Scan(); row++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var product models.Product
+		if err := json.Unmarshal([]byte(line), &product); err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, Error: err.Error()})
+			continue
+		}
+		products = append(products, product)
+	}
+	return products, rowErrors, scanner.Err()
+}
+
+const merchantNamespace = "http://base.google.com/ns/1.0"
+
+// merchantItem is an <item> (RSS 2.0) or <entry> (Atom) in a Merchant
+// Center feed. Attributes may appear with or without the g: namespace.
+type merchantItem struct {
+	Fields []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+func parseMerchantXML(r io.Reader) ([]models.Product, []RowError, error) {
+	decoder := xml.NewDecoder(r)
+
+	var products []models.Product
+	var rowErrors []RowError
+	row := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing feed: %v", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || (start.Name.Local != "item" && start.Name.Local != "entry") {
+			continue
+		}
+		row++
+
+		var item merchantItem
+		if err := decoder.DecodeElement(&item, &start); err != nil {
+			return nil, nil, fmt.Errorf("parsing item %d: %v", row, err)
+		}
+
+		record := make(rawRecord)
+		for _, field := range item.Fields {
+			if field.XMLName.Space != "" && field.XMLName.Space != merchantNamespace {
+				continue
+			}
+			column := columnAliases[field.XMLName.Local]
+			if column != "" && record[column] == "" {
+				record[column] = strings.TrimSpace(field.Value)
+			}
+		}
+
+		product, err := record.toProduct()
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, ID: record["id"], Error: err.Error()})
+			continue
+		}
+		products = append(products, product)
+	}
+	return products, rowErrors, nil
+}
+
+func (record rawRecord) toProduct() (models.Product, error) {
+	product := models.Product{
+		ID:          record["id"],
+		Name:        record["name"],
+		Description: record["description"],
+		Picture:     record["picture"],
+		Categories:  SplitCategories(record["categories"]),
+		Brand:       record["brand"],
+		Material:    record["material"],
+	}
+	if product.ID == "" {
+		return product, fmt.Errorf("missing id")
+	}
+
+	if rating := record["rating"]; rating != "" {
+		value, err := strconv.ParseFloat(rating, 64)
+		if err != nil {
+			return product, fmt.Errorf("invalid rating %q", rating)
+		}
+		product.Rating = value
+	}
+	if reviews := record["review_count"]; reviews != "" {
+		value, err := strconv.Atoi(reviews)
+		if err != nil {
+			return product, fmt.Errorf("invalid review_count %q", reviews)
+		}
+		product.ReviewCount = value
+	}
+
+	for _, category := range SplitCategories(record["google_category"]) {
+		if _, err := strconv.Atoi(category); err != nil {
+			product.Categories = append(product.Categories, category)
+		}
+	}
+
+	// Promotions are applied at query time, so the regular price is kept.
+	priceText := record["price"]
+	if priceText == "" {
+		priceText = record["sale_price"]
+	}
+	if priceText == "" {
+		return product, fmt.Errorf("missing price")
+	}
+	price, err := ParsePrice(priceText, record["currency"])
+	if err != nil {
+		return product, err
+	}
+	product.PriceUsd = price
+
+	if createdAt := record["created_at"]; createdAt != "" {
+		t, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return product, fmt.Errorf("invalid created_at %q", createdAt)
+		}
+		product.CreatedAt = t
+	}
+	return product, nil
+}
+
+var categorySeparators = regexp.MustCompile(`\s*[>|;,/]\s*`)
+
+// SplitCategories splits "Apparel > Shoes > Boots" or "boots, leather"
+// into lower-cased categories.
+func SplitCategories(value string) []string {
+	var categories []string
+	for _, part := range categorySeparators.Split(value, -1) {
+		if part = strings.ToLower(strings.TrimSpace(part)); part != "" {
+			categories = append(categories, part)
+		}
+	}
+	return categories
+}
+
+var (
+	pricePattern    = regexp.MustCompile(`^(\d{1,3}(?:,\d{3})+|\d+)(?:\.(\d{1,9}))?$`)
+	currencySymbols = map[string]string{"$": "USD", "£": "GBP", "€": "EUR", "¥": "JPY"}
+)
+
+// ParsePrice parses prices such as "89.95", "$89.95", "89.95 USD" or
+// "1,299.00" into units and nanos without going through floating point.
+// The currency comes from the text, else defaultCurrency, else USD.
+func ParsePrice(text, defaultCurrency string) (models.PriceUsd, error) {
+	currency := strings.ToUpper(strings.TrimSpace(defaultCurrency))
+	amount := strings.TrimSpace(text)
+
+	for symbol, code := range currencySymbols {
+		if strings.HasPrefix(amount, symbol) {
+			currency = code
+			amount = strings.TrimSpace(strings.TrimPrefix(amount, symbol))
+		}
+	}
+	if fields := strings.Fields(amount); len(fields) == 2 {
+		if currencyCodePattern.MatchString(strings.ToUpper(fields[1])) {
+			currency, amount = strings.ToUpper(fields[1]), fields[0]
+		} else if currencyCodePattern.MatchString(strings.ToUpper(fields[0])) {
+			currency, amount = strings.ToUpper(fields[0]), fields[1]
+		}
+	}
+	if currency == "" {
+		currency = "USD"
+	}
+
+	match := pricePattern.FindStringSubmatch(amount)
+	if match == nil {
+		return models.PriceUsd{}, fmt.Errorf("invalid price %q", text)
+	}
+
+	units, err := strconv.ParseInt(strings.ReplaceAll(match[1], ",", ""), 10, 64)
+	if err != nil {
+		return models.PriceUsd{}, fmt.Errorf("invalid price %q", text)
+	}
+	nanos := 0
+	if match[2] != "" {
+		nanos, _ = strconv.Atoi(match[2] + strings.Repeat("0", 9-len(match[2])))
+	}
+
+	return models.PriceUsd{CurrencyCode: currency, Units: units, Nanos: int32(nanos)}, nil
+}
+
+// ProductChange lists the fields an import would change on a product.
+type ProductChange struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+// ImportReport summarises an import, or what it would do in a dry run.
+type ImportReport struct {
+	Format    string          `json:"format"`
+	DryRun    bool            `json:"dry_run"`
+	Added     []string        `json:"added"`
+	Updated   []ProductChange `json:"updated"`
+	Unchanged int             `json:"unchanged"`
+	Invalid   []RowError      `json:"invalid"`
+}
+
+// Merge upserts incoming products into the existing catalogue by ID. Invalid
+// products are reported and skipped; existing products keep their position
+// and creation time.
+func Merge(existing, incoming []models.Product, now time.Time) ([]models.Product, *ImportReport) {
+	report := &ImportReport{Added: []string{}, Updated: []ProductChange{}, Invalid: []RowError{}}
+
+	merged := append([]models.Product{}, existing...)
+	positions := make(map[string]int, len(merged))
+	for i, product := range merged {
+		positions[product.ID] = i
+	}
+
+	for _, product := range incoming {
+		product = Normalize(product)
+		if err := Validate(product); err != nil {
+			report.Invalid = append(report.Invalid, RowError{ID: product.ID, Error: err.Error()})
+			continue
+		}
+
+		position, exists := positions[product.ID]
+		if !exists {
+			if product.CreatedAt.IsZero() {
+				product.CreatedAt = now
+			}
+			positions[product.ID] = len(merged)
+			merged = append(merged, product)
+			report.Added = append(report.Added, product.ID)
+			continue
+		}
+
+		if product.CreatedAt.IsZero() {
+			product.CreatedAt = merged[position].CreatedAt
+		}
+		if fields := changedFields(merged[position], product); len(fields) > 0 {
+			merged[position] = product
+			report.Updated = append(report.Updated, ProductChange{ID: product.ID, Fields: fields})
+		} else {
+			report.Unchanged++
+		}
+	}
+	return merged, report
+}
+
+func changedFields(before, after models.Product) []string {
+	var fields []string
+	beforeJSON := fieldsJSON(before)
+	afterJSON := fieldsJSON(after)
+	for field, value := range afterJSON {
+		if beforeJSON[field] != value {
+			fields = append(fields, field)
+		}
+	}
+	for field := range beforeJSON {
+		if _, ok := afterJSON[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// fieldsJSON renders each top-level product field as JSON so changes can
+// be compared field by field.
+func fieldsJSON(product models.Product) map[string]string {
+	data, _ := json.Marshal(product)
+	var raw map[string]json.RawMessage
+	json.Unmarshal(data, &raw)
+
+	fields := make(map[string]string, len(raw))
+	for field, value := range raw {
+		fields[field] = string(value)
+	}
+	return fields
+}
@@ -0,0 +1,235 @@
+package catalog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"celeste/models"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		text, currency string
+		want           models.PriceUsd
+		wantErr        bool
+	}{
+		{text: "89.95", want: models.PriceUsd{CurrencyCode: "USD", Units: 89, Nanos: 950000000}},
+		{text: "89", currency: "eur", want: models.PriceUsd{CurrencyCode: "EUR", Units: 89}},
+		{text: "$89.95", currency: "EUR", want: models.PriceUsd{CurrencyCode: "USD", Units: 89, Nanos: 950000000}},
+		{text: "£ 12.5", want: models.PriceUsd{CurrencyCode: "GBP", Units: 12, Nanos: 500000000}},
+		{text: "€1,299.00", want: models.PriceUsd{CurrencyCode: "EUR", Units: 1299}},
+		{text: "¥1500", want: models.PriceUsd{CurrencyCode: "JPY", Units: 1500}},
+		{text: "89.95 usd", want: models.PriceUsd{CurrencyCode: "USD", Units: 89, Nanos: 950000000}},
+		{text: "CAD 1,000,000.01", want: models.PriceUsd{CurrencyCode: "CAD", Units: 1000000, Nanos: 10000000}},
+		{text: "0.000000001", want: models.PriceUsd{CurrencyCode: "USD", Nanos: 1}},
+		{text: "1,29.00", wantErr: true},
+		{text: "1.299,00", wantErr: true},
+		{text: "-5.00", wantErr: true},
+		{text: "12.", wantErr: true},
+		{text: "twelve", wantErr: true},
+		{text: "", wantErr: true},
+		{text: "0.0000000001", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePrice(tt.text, tt.currency)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParsePrice(%q) = %+v, want an error", tt.text, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePrice(%q): %v", tt.text, err)
+		} else if got != tt.want {
+			t.Errorf("ParsePrice(%q, %q) = %+v, want %+v", tt.text, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		input     string
+		wantIDs   []string
+		wantRows  []RowError
+		wantError bool
+	}{
+		{
+			name:   "csv with merchant headers",
+			format: FormatCSV,
+			input: "\ufeffg:id,Title,g:price,product_type,google_product_category\n" +
+				"B1,Leather Boot,$120.00,Apparel > Shoes > Boots,187\n",
+			wantIDs: []string{"B1"},
+		},
+		{
+			name:   "csv rows missing an id or a price",
+			format: FormatCSV,
+			input: "id,name,price\n" +
+				",No ID,10\n" +
+				"S1,No Price,\n" +
+				"S2,Bad Price,ten dollars\n" +
+				"S3,Sneaker,60\n",
+			wantIDs: []string{"S3"},
+			wantRows: []RowError{
+				{Row: 2, Error: "missing id"},
+				{Row: 3, ID: "S1", Error: "missing price"},
+				{Row: 4, ID: "S2", Error: `invalid price "ten dollars"`},
+			},
+		},
+		{
+			name:   "csv without a price column",
+			format: FormatCSV,
+			input:  "id,name\nS1,Sneaker\n",
+			wantRows: []RowError{
+				{Row: 2, ID: "S1", Error: "missing price"},
+			},
+		},
+		{
+			name:    "csv falls back to the sale price",
+			format:  FormatCSV,
+			input:   "id,name,sale_price,rating\nS1,Sneaker,45,4.5\nS2,Sneaker,45,great\n",
+			wantIDs: []string{"S1"},
+			wantRows: []RowError{
+				{Row: 3, ID: "S2", Error: `invalid rating "great"`},
+			},
+		},
+		{
+			name:      "csv without a header",
+			format:    FormatCSV,
+			input:     "",
+			wantError: true,
+		},
+		{
+			name:    "tsv",
+			format:  FormatMerchantTSV,
+			input:   "id\ttitle\tprice\nT1\tWool Scarf\t25.00 GBP\n",
+			wantIDs: []string{"T1"},
+		},
+		{
+			name:   "json lines skip blank lines and report bad ones",
+			format: FormatJSONLines,
+			input: `{"id": "J1", "name": "Rain Jacket"}` + "\n\n" +
+				`{"id": "J2", "name": ` + "\n" +
+				`{"id": "J3", "name": "Parka"}` + "\n",
+			wantIDs: []string{"J1", "J3"},
+			wantRows: []RowError{
+				{Row: 3, Error: "unexpected end of JSON input"},
+			},
+		},
+		{
+			name:      "unknown format",
+			format:    "xlsx",
+			input:     "id\n",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products, rows, err := Parse(tt.format, strings.NewReader(tt.input))
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("Parse succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []string
+			for _, product := range products {
+				ids = append(ids, product.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("parsed %v, want %v", ids, tt.wantIDs)
+			}
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("row errors = %+v, want %+v", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestParseCSVFields(t *testing.T) {
+	input := "id,title,price,currency,product_type,google_product_category,brand,material\n" +
+		"B1,Leather Boot,\"1,299.50\",gbp,Shoes > Boots,187,Acme,Leather\n"
+	products, rows, err := Parse(FormatCSV, strings.NewReader(input))
+	if err != nil || len(rows) > 0 {
+		t.Fatalf("Parse: %v %v", rows, err)
+	}
+
+	want := models.Product{
+		ID:         "B1",
+		Name:       "Leather Boot",
+		PriceUsd:   models.PriceUsd{CurrencyCode: "GBP", Units: 1299, Nanos: 500000000},
+		Categories: []string{"shoes", "boots"},
+		Brand:      "Acme",
+		Material:   "Leather",
+	}
+	if !reflect.DeepEqual(products, []models.Product{want}) {
+		t.Errorf("Parse = %+v, want %+v", products, want)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	created := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	product := func(id, name string, price int64) models.Product {
+		return models.Product{ID: id, Name: name, PriceUsd: models.PriceUsd{CurrencyCode: "USD", Units: price}, Categories: []string{}}
+	}
+
+	existing := []models.Product{product("A", "Boot", 100), product("B", "Sneaker", 60), product("C", "Scarf", 20)}
+	for i := range existing {
+		existing[i].CreatedAt = created
+	}
+	incoming := []models.Product{
+		product("B", "Sneaker", 55),
+		product("C", " Scarf ", 20),
+		product("D", "Jacket", 150),
+		product("A", "", 100),
+		product("D", "Rain Jacket", 150),
+	}
+
+	merged, report := Merge(existing, incoming, now)
+
+	var ids []string
+	for _, product := range merged {
+		ids = append(ids, product.ID)
+	}
+	if want := []string{"A", "B", "C", "D"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("merged order = %v, want %v", ids, want)
+	}
+
+	if merged[0].Name != "Boot" {
+		t.Errorf("invalid update replaced A: %+v", merged[0])
+	}
+	if merged[1].PriceUsd.Units != 55 || !merged[1].CreatedAt.Equal(created) {
+		t.Errorf("B = %+v, want the new price and the original creation time", merged[1])
+	}
+	if merged[3].Name != "Rain Jacket" || !merged[3].CreatedAt.Equal(now) {
+		t.Errorf("D = %+v, want the later record, created now", merged[3])
+	}
+
+	if want := []string{"D"}; !reflect.DeepEqual(report.Added, want) {
+		t.Errorf("added = %v, want %v", report.Added, want)
+	}
+	wantUpdated := []ProductChange{{ID: "B", Fields: []string{"priceUsd"}}, {ID: "D", Fields: []string{"name"}}}
+	if !reflect.DeepEqual(report.Updated, wantUpdated) {
+		t.Errorf("updated = %+v, want %+v", report.Updated, wantUpdated)
+	}
+	if report.Unchanged != 1 {
+		t.Errorf("unchanged = %d, want 1 (C differs only in whitespace)", report.Unchanged)
+	}
+	if len(report.Invalid) != 1 || report.Invalid[0].ID != "A" {
+		t.Errorf("invalid = %+v, want A", report.Invalid)
+	}
+
+	if existing[1].PriceUsd.Units != 60 {
+		t.Errorf("Merge modified the existing catalogue: %+v", existing[1])
+	}
+}
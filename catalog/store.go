@@ -0,0 +1,140 @@
+package catalog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"celeste/models"
+)
+
+var (
+	ErrNotFound = errors.New("product not found")
+	ErrExists   = errors.New("product already exists")
+)
+
+// Snapshot is the catalogue as read from or written to a store, with an
+// ETag identifying its exact contents.
+type Snapshot struct {
+	Products []models.Product
+	ETag     string
+	ModTime  time.Time
+}
+
+// Store persists the product catalogue.
+type Store interface {
+	Load() (*Snapshot, error)
+	Save(products []models.Product) (*Snapshot, error)
+	// ModTime is cheap to call and is used to poll for outside changes.
+	ModTime() (time.Time, error)
+}
+
+type catalogFile struct {
+	Products []models.Product `json:"products"`
+}
+
+// FileStore keeps the catalogue in a JSON file shaped like
+// data/itemCatalogue.json.
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// DefaultPath is the catalogue file named by CELESTE_CATALOG_PATH, or
+// data/itemCatalogue.json.
+func DefaultPath() string {
+	if path := os.Getenv("CELESTE_CATALOG_PATH"); path != "" {
+		return path
+	}
+	return "data/itemCatalogue.json"
+}
+
+func (fs *FileStore) Path() string {
+	return fs.path
+}
+
+func (fs *FileStore) Load() (*Snapshot, error) {
+	info, err := os.Stat(fs.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(fs.path)
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Products: products, ETag: ETag(data), ModTime: info.ModTime()}, nil
+}
+
+func (fs *FileStore) ModTime() (time.Time, error) {
+	info, err := os.Stat(fs.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// ETag is a short content hash of catalogue file contents.
+func ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Decode parses catalogue file contents.
+func Decode(data []byte) ([]models.Product, error) {
+	var file catalogFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	return file.Products, nil
+}
+
+// Save writes the catalogue to a temporary file and renames it into place so
+// readers never see a partially written file.
+func (fs *FileStore) Save(products []models.Product) (*Snapshot, error) {
+	if products == nil {
+		products = []models.Product{}
+	}
+	data, err := json.MarshalIndent(catalogFile{Products: products}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), ".catalogue-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), fs.path); err != nil {
+		return nil, err
+	}
+
+	modTime, err := fs.ModTime()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Products: products, ETag: ETag(data), ModTime: modTime}, nil
+}
@@ -0,0 +1,17 @@
+package catalog
+
+import "testing"
+
+// The sample catalogue is what "newest" sorts a fresh install by, so every
+// product in it needs a creation time.
+func TestSampleCatalogueCreatedAt(t *testing.T) {
+	snapshot, err := NewFileStore("../data/itemCatalogue.json").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, product := range snapshot.Products {
+		if product.CreatedAt.IsZero() {
+			t.Errorf("%s has no created_at", product.ID)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package catalog
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"celeste/models"
+)
+
+var (
+	productIDPattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+	currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+const (
+	maxNameLength = 200
+	maxNanos      = 999999999
+)
+
+// FieldError describes one invalid product field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found with a product.
+type ValidationError struct {
+	Fields []FieldError `json:"errors"`
+}
+
+func (ve *ValidationError) Error() string {
+	messages := make([]string, len(ve.Fields))
+	for i, field := range ve.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return "invalid product: " + strings.Join(messages, "; ")
+}
+
+func (ve *ValidationError) checkPrice(field string, price models.PriceUsd) {
+	if !currencyCodePattern.MatchString(price.CurrencyCode) {
+		ve.add(field+".currency_code", "must be a three-letter ISO 4217 code")
+	}
+	if price.Nanos < -maxNanos || price.Nanos > maxNanos {
+		ve.add(field+".nanos", "must be between -999999999 and 999999999")
+	}
+	if (price.Units > 0 && price.Nanos < 0) || (price.Units < 0 && price.Nanos > 0) {
+		ve.add(field+".nanos", "must have the same sign as units")
+	} else if price.Units < 0 || price.Nanos < 0 {
+		ve.add(field, "must not be negative")
+	}
+}
+
+func (ve *ValidationError) add(field, format string, args ...interface{}) {
+	ve.Fields = append(ve.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Normalize trims text fields, lower-cases and de-duplicates categories, and
+// canonicalises variant sizes (upper case) and colours (lower case).
+func Normalize(product models.Product) models.Product {
+	product.ID = strings.TrimSpace(product.ID)
+	product.Name = strings.TrimSpace(product.Name)
+	product.Description = strings.TrimSpace(product.Description)
+	product.Picture = strings.TrimSpace(product.Picture)
+	product.PriceUsd.CurrencyCode = strings.ToUpper(strings.TrimSpace(product.PriceUsd.CurrencyCode))
+	product.Brand = strings.TrimSpace(product.Brand)
+	product.Material = strings.ToLower(strings.TrimSpace(product.Material))
+
+	if len(product.Variants) > 0 {
+		variants := make([]models.Variant, len(product.Variants))
+		for i, variant := range product.Variants {
+			variant.SKU = strings.TrimSpace(variant.SKU)
+			variant.Size = strings.ToUpper(strings.TrimSpace(variant.Size))
+			variant.Color = strings.ToLower(strings.TrimSpace(variant.Color))
+			if variant.PriceUsd != nil {
+				price := *variant.PriceUsd
+				price.CurrencyCode = strings.ToUpper(strings.TrimSpace(price.CurrencyCode))
+				variant.PriceUsd = &price
+			}
+			variants[i] = variant
+		}
+		product.Variants = variants
+	}
+
+	seen := make(map[string]bool)
+	categories := make([]string, 0, len(product.Categories))
+	for _, category := range product.Categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if category != "" && !seen[category] {
+			seen[category] = true
+			categories = append(categories, category)
+		}
+	}
+	product.Categories = categories
+	return product
+}
+
+// Validate checks a product's ID, name, picture, price, rating and variants.
+// Prices follow the google.type.Money rules: nanos lie within ±999,999,999
+// and share the sign of units.
+func Validate(product models.Product) error {
+	ve := &ValidationError{}
+
+	if !productIDPattern.MatchString(product.ID) {
+		ve.add("id", "must be 1-64 letters, digits, '-' or '_' and start with a letter or digit")
+	}
+	if product.Name == "" {
+		ve.add("name", "is required")
+	} else if len(product.Name) > maxNameLength {
+		ve.add("name", "must be at most %d characters", maxNameLength)
+	}
+	if product.Picture != "" && !strings.HasPrefix(product.Picture, "/") {
+		if u, err := url.Parse(product.Picture); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			ve.add("picture", "must be an absolute path or an http(s) URL")
+		}
+	}
+
+	ve.checkPrice("priceUsd", product.PriceUsd)
+
+	for i, category := range product.Categories {
+		if category == "" {
+			ve.add(fmt.Sprintf("categories[%d]", i), "must not be empty")
+		}
+	}
+
+	if product.Rating < 0 || product.Rating > 5 {
+		ve.add("rating", "must be between 0 and 5")
+	}
+	if product.ReviewCount < 0 {
+		ve.add("review_count", "must not be negative")
+	}
+
+	skus := make(map[string]bool, len(product.Variants))
+	for i, variant := range product.Variants {
+		field := fmt.Sprintf("variants[%d]", i)
+		if !productIDPattern.MatchString(variant.SKU) {
+			ve.add(field+".sku", "must be 1-64 letters, digits, '-' or '_' and start with a letter or digit")
+		} else if skus[variant.SKU] {
+			ve.add(field+".sku", "duplicates another variant")
+		}
+		skus[variant.SKU] = true
+
+		if variant.Size == "" && variant.Color == "" {
+			ve.add(field, "needs a size or a colour")
+		}
+		if variant.Stock < 0 {
+			ve.add(field+".stock", "must not be negative")
+		}
+		if variant.PriceUsd != nil {
+			ve.checkPrice(field+".priceUsd", *variant.PriceUsd)
+			if variant.PriceUsd.CurrencyCode != product.PriceUsd.CurrencyCode {
+				ve.add(field+".priceUsd.currency_code", "must match the product currency")
+			}
+		}
+	}
+
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
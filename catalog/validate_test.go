@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"celeste/models"
+)
+
+func validProduct() models.Product {
+	return models.Product{
+		ID:         "B1",
+		Name:       "Leather Boot",
+		Picture:    "/static/img/products/boot.jpg",
+		PriceUsd:   models.PriceUsd{CurrencyCode: "USD", Units: 120, Nanos: 500000000},
+		Categories: []string{"boots"},
+		Rating:     4.5,
+		Variants: []models.Variant{
+			{SKU: "B1-8", Size: "8", Color: "brown", Stock: 2},
+			{SKU: "B1-9", Size: "9", Stock: 0, PriceUsd: &models.PriceUsd{CurrencyCode: "USD", Units: 110}},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	price := func(units int64, nanos int32) *models.PriceUsd {
+		return &models.PriceUsd{CurrencyCode: "USD", Units: units, Nanos: nanos}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*models.Product)
+		fields []string
+	}{
+		{name: "valid", modify: func(p *models.Product) {}},
+		{name: "picture URL", modify: func(p *models.Product) { p.Picture = "https://cdn.example.com/boot.jpg" }},
+		{name: "missing ID", modify: func(p *models.Product) { p.ID = "" }, fields: []string{"id"}},
+		{name: "ID with spaces", modify: func(p *models.Product) { p.ID = "B 1" }, fields: []string{"id"}},
+		{name: "ID too long", modify: func(p *models.Product) { p.ID = strings.Repeat("a", 65) }, fields: []string{"id"}},
+		{name: "missing name", modify: func(p *models.Product) { p.Name = "" }, fields: []string{"name"}},
+		{name: "name too long", modify: func(p *models.Product) { p.Name = strings.Repeat("a", 201) }, fields: []string{"name"}},
+		{name: "relative picture", modify: func(p *models.Product) { p.Picture = "boot.jpg" }, fields: []string{"picture"}},
+		{name: "picture scheme", modify: func(p *models.Product) { p.Picture = "ftp://example.com/boot.jpg" }, fields: []string{"picture"}},
+		{name: "currency code", modify: func(p *models.Product) { p.PriceUsd.CurrencyCode = "US" }, fields: []string{"priceUsd.currency_code", "variants[1].priceUsd.currency_code"}},
+		{name: "negative price", modify: func(p *models.Product) { p.PriceUsd = *price(-1, 0) }, fields: []string{"priceUsd"}},
+		{name: "nanos out of range", modify: func(p *models.Product) { p.PriceUsd.Nanos = 1000000000 }, fields: []string{"priceUsd.nanos"}},
+		{name: "nanos sign", modify: func(p *models.Product) { p.PriceUsd = *price(1, -5) }, fields: []string{"priceUsd.nanos"}},
+		{name: "empty category", modify: func(p *models.Product) { p.Categories = []string{"boots", ""} }, fields: []string{"categories[1]"}},
+		{name: "rating", modify: func(p *models.Product) { p.Rating = 5.5 }, fields: []string{"rating"}},
+		{name: "review count", modify: func(p *models.Product) { p.ReviewCount = -1 }, fields: []string{"review_count"}},
+		{name: "duplicate SKU", modify: func(p *models.Product) { p.Variants[1].SKU = "B1-8" }, fields: []string{"variants[1].sku"}},
+		{name: "variant without size or colour", modify: func(p *models.Product) { p.Variants[1].Size = "" }, fields: []string{"variants[1]"}},
+		{name: "negative stock", modify: func(p *models.Product) { p.Variants[0].Stock = -1 }, fields: []string{"variants[0].stock"}},
+		{name: "variant price", modify: func(p *models.Product) { p.Variants[1].PriceUsd = price(-10, 0) }, fields: []string{"variants[1].priceUsd"}},
+		{
+			name:   "variant currency",
+			modify: func(p *models.Product) { p.Variants[1].PriceUsd.CurrencyCode = "EUR" },
+			fields: []string{"variants[1].priceUsd.currency_code"},
+		},
+		{
+			name:   "every problem is reported",
+			modify: func(p *models.Product) { p.ID, p.Name, p.Rating = "", "", -1 },
+			fields: []string{"id", "name", "rating"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := validProduct()
+			tt.modify(&product)
+
+			err := Validate(product)
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("Validate = %v, want a *ValidationError", err)
+			}
+			var fields []string
+			for _, field := range ve.Fields {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v (%v)", fields, tt.fields, err)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	product := validProduct()
+	product.ID = " B1 "
+	product.PriceUsd.CurrencyCode = " usd"
+	product.Material = " Leather "
+	product.Categories = []string{"Boots", " boots", "", "Shoes"}
+	product.Variants[0].Size, product.Variants[0].Color = " m ", "Brown"
+	product.Variants[1].PriceUsd = &models.PriceUsd{CurrencyCode: "usd", Units: 110}
+	original := product.Variants[1].PriceUsd
+
+	normalized := Normalize(product)
+	if normalized.ID != "B1" || normalized.PriceUsd.CurrencyCode != "USD" || normalized.Material != "leather" {
+		t.Errorf("Normalize = %+v", normalized)
+	}
+	if want := []string{"boots", "shoes"}; !reflect.DeepEqual(normalized.Categories, want) {
+		t.Errorf("categories = %v, want %v", normalized.Categories, want)
+	}
+	if variant := normalized.Variants[0]; variant.Size != "M" || variant.Color != "brown" {
+		t.Errorf("variant = %+v, want size M and colour brown", variant)
+	}
+	if normalized.Variants[1].PriceUsd.CurrencyCode != "USD" || original.CurrencyCode != "usd" {
+		t.Errorf("variant price not normalised on a copy: %+v, original %+v", normalized.Variants[1].PriceUsd, original)
+	}
+	if err := Validate(normalized); err != nil {
+		t.Errorf("Validate(Normalize(product)): %v", err)
+	}
+}
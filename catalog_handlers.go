@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"celeste/auth"
+	"celeste/catalog"
+	"celeste/models"
+)
+
+const maxImportSize = 32 << 20
+
+func (s *CelesteService) registerCatalogRoutes(router *mux.Router) {
+	router.HandleFunc("/products", s.handleListProducts).Methods("GET")
+	router.HandleFunc("/products", s.auth.Require(auth.ScopeCatalog, s.handleCreateProduct)).Methods("POST")
+	router.HandleFunc("/products/import", s.auth.Require(auth.ScopeCatalog, s.handleImportProducts)).Methods("POST")
+	router.HandleFunc("/products/{id}", s.handleGetProduct).Methods("GET")
+	router.HandleFunc("/products/{id}", s.auth.Require(auth.ScopeCatalog, s.handleUpdateProduct)).Methods("PUT")
+	router.HandleFunc("/products/{id}", s.auth.Require(auth.ScopeCatalog, s.handleDeleteProduct)).Methods("DELETE")
+	router.HandleFunc("/catalog/reload", s.auth.Require(auth.ScopeCatalog, s.handleReloadCatalog)).Methods("POST")
+}
+
+func (s *CelesteService) handleListProducts(w http.ResponseWriter, r *http.Request) {
+	products := s.orchestrator.Catalog().Products()
+	w.Header().Set("ETag", `"`+s.orchestrator.CatalogStatus().ETag+`"`)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"products": products,
+		"count":    len(products),
+	})
+}
+
+func (s *CelesteService) handleGetProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := s.orchestrator.Catalog().Product(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+func (s *CelesteService) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		http.Error(w, "Invalid product", http.StatusBadRequest)
+		return
+	}
+
+	created, err := s.orchestrator.Catalog().CreateProduct(r.Context(), product)
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *CelesteService) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		http.Error(w, "Invalid product", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := s.orchestrator.Catalog().UpdateProduct(r.Context(), mux.Vars(r)["id"], product)
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *CelesteService) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	if err := s.orchestrator.Catalog().DeleteProduct(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleImportProducts takes a feed in the request body. The format comes
+// from the format query parameter or the Content-Type; dry_run=true
+// reports the changes without applying them.
+func (s *CelesteService) handleImportProducts(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		detected, err := catalog.DetectFormat(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, "Specify format: csv, jsonl, merchant_xml or merchant_tsv", http.StatusBadRequest)
+			return
+		}
+		format = detected
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	products, rowErrors, err := catalog.Parse(format, http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.orchestrator.Catalog().ImportProducts(r.Context(), products, dryRun)
+	if err != nil {
+		writeCatalogError(w, err)
+		return
+	}
+	report.Format = format
+	report.Invalid = append(append([]catalog.RowError{}, rowErrors...), report.Invalid...)
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *CelesteService) handleReloadCatalog(w http.ResponseWriter, r *http.Request) {
+	status, err := s.orchestrator.Catalog().Reload(r.Context())
+	if err != nil {
+		log.Printf("%v", err)
+		writeJSON(w, http.StatusUnprocessableEntity, status)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func writeCatalogError(w http.ResponseWriter, err error) {
+	var validationErr *catalog.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeJSON(w, http.StatusUnprocessableEntity, validationErr)
+	case errors.Is(err, catalog.ErrNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	case errors.Is(err, catalog.ErrExists):
+		http.Error(w, "Product already exists", http.StatusConflict)
+	default:
+		log.Printf("Catalogue update failed: %v", err)
+		http.Error(w, "Catalogue update failed", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"celeste/agents"
+	"celeste/auth"
+	"celeste/catalog"
+)
+
+const usage = `Usage:
+  celeste                                  start the assistant server
+  celeste catalog import [flags] FILE      import products into the catalogue
+  celeste eval personalization [flags]     compare personalized and baseline rankings on logged sessions
+  celeste auth key [flags]                 generate an API key and the entry to add to the keys file
+  celeste auth token [flags]               issue a signed token (needs CELESTE_TOKEN_SECRET)
+
+Run "celeste <command> <subcommand> -h" for flags.
+`
+
+// runCommand runs a command-line subcommand and returns the exit code.
+func runCommand(args []string) int {
+	if len(args) >= 2 && args[0] == "catalog" && args[1] == "import" {
+		return runCatalogImport(args[2:])
+	}
+	if len(args) >= 2 && args[0] == "eval" && args[1] == "personalization" {
+		return runEvalPersonalization(args[2:])
+	}
+	if len(args) >= 2 && args[0] == "auth" && args[1] == "key" {
+		return runAuthKey(args[2:])
+	}
+	if len(args) >= 2 && args[0] == "auth" && args[1] == "token" {
+		return runAuthToken(args[2:])
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+func runCatalogImport(args []string) int {
+	flags := flag.NewFlagSet("catalog import", flag.ContinueOnError)
+	format := flags.String("format", "", "csv, jsonl, merchant_xml or merchant_tsv (detected from the file extension if omitted)")
+	dryRun := flags.Bool("dry-run", false, "report the changes without writing the catalogue")
+	catalogPath := flags.String("catalog", catalog.DefaultPath(), "catalogue file to update")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "catalog import: exactly one FILE is required")
+		return 2
+	}
+	path := flags.Arg(0)
+
+	if *format == "" {
+		detected, err := catalog.DetectFormat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "catalog import: %v; use -format\n", err)
+			return 2
+		}
+		*format = detected
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "catalog import: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	products, rowErrors, err := catalog.Parse(*format, file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "catalog import: %v\n", err)
+		return 1
+	}
+
+	store := catalog.NewFileStore(*catalogPath)
+	snapshot, err := store.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "catalog import: loading %s: %v\n", *catalogPath, err)
+		return 1
+	}
+
+	merged, report := catalog.Merge(snapshot.Products, products, time.Now().UTC())
+	report.Format = *format
+	report.DryRun = *dryRun
+	report.Invalid = append(append([]catalog.RowError{}, rowErrors...), report.Invalid...)
+
+	if !*dryRun && (len(report.Added) > 0 || len(report.Updated) > 0) {
+		if _, err := store.Save(merged); err != nil {
+			fmt.Fprintf(os.Stderr, "catalog import: saving %s: %v\n", *catalogPath, err)
+			return 1
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	return 0
+}
+
+func runEvalPersonalization(args []string) int {
+	flags := flag.NewFlagSet("eval personalization", flag.ContinueOnError)
+	rankingsPath := flags.String("rankings", agents.RankingsPath(), "ranking log to replay")
+	interactionsPath := flags.String("interactions", agents.InteractionsPath(), "interaction log to judge rankings by")
+	k := flags.Int("k", 10, "rank cut-off for NDCG and hit rate")
+	window := flags.Duration("window", 30*time.Minute, "how long after a reply an interaction still counts towards it")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *k <= 0 || *window <= 0 {
+		fmt.Fprintln(os.Stderr, "eval personalization: -k and -window must be positive")
+		return 2
+	}
+
+	rankings, err := agents.LoadRankings(*rankingsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eval personalization: loading rankings: %v\n", err)
+		return 1
+	}
+	interactions, err := agents.LoadInteractions(*interactionsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eval personalization: loading interactions: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(agents.EvaluatePersonalization(rankings, interactions, *k, *window))
+	return 0
+}
+
+func runAuthKey(args []string) int {
+	flags := flag.NewFlagSet("auth key", flag.ContinueOnError)
+	id := flags.String("id", "", "name of the key, to tell keys apart in the keys file")
+	userID := flags.String("user", "", "user the key authenticates as (required)")
+	scopes := flags.String("scopes", "", "comma-separated scopes, e.g. admin:catalog")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *userID == "" {
+		fmt.Fprintln(os.Stderr, "auth key: -user is required")
+		return 2
+	}
+
+	key, entry := auth.GenerateKey(*id, *userID, splitScopes(*scopes))
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(map[string]interface{}{
+		"key":   key,
+		"entry": entry,
+	})
+	return 0
+}
+
+func runAuthToken(args []string) int {
+	flags := flag.NewFlagSet("auth token", flag.ContinueOnError)
+	userID := flags.String("user", "", "user the token authenticates as (required)")
+	scopes := flags.String("scopes", "", "comma-separated scopes, e.g. admin:catalog")
+	ttl := flags.Duration("ttl", 24*time.Hour, "how long the token is valid for")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *userID == "" || *ttl <= 0 {
+		fmt.Fprintln(os.Stderr, "auth token: -user is required and -ttl must be positive")
+		return 2
+	}
+
+	tokens, err := auth.NewTokens(os.Getenv("CELESTE_TOKEN_SECRET"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "auth token: CELESTE_TOKEN_SECRET: %v\n", err)
+		return 1
+	}
+	token, err := tokens.Issue(*userID, splitScopes(*scopes), *ttl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "auth token: %v\n", err)
+		return 1
+	}
+	fmt.Println(token)
+	return 0
+}
+
+func splitScopes(list string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(list, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,39 @@
+package currency
+
+import "strings"
+
+// Countries (by ISO 3166 code or English name) and a few major cities,
+// mapped to the currency shoppers there expect.
+var locationCurrencies = map[string]string{
+	"us": "USD", "usa": "USD", "united states": "USD", "new york": "USD", "san francisco": "USD",
+	"gb": "GBP", "uk": "GBP", "united kingdom": "GBP", "england": "GBP", "scotland": "GBP", "wales": "GBP", "london": "GBP",
+	"ie": "EUR", "ireland": "EUR", "dublin": "EUR",
+	"fr": "EUR", "france": "EUR", "paris": "EUR",
+	"de": "EUR", "germany": "EUR", "berlin": "EUR",
+	"es": "EUR", "spain": "EUR", "madrid": "EUR",
+	"it": "EUR", "italy": "EUR", "milan": "EUR", "rome": "EUR",
+	"nl": "EUR", "netherlands": "EUR", "amsterdam": "EUR",
+	"jp": "JPY", "japan": "JPY", "tokyo": "JPY",
+	"ca": "CAD", "canada": "CAD", "toronto": "CAD",
+	"au": "AUD", "australia": "AUD", "sydney": "AUD",
+	"nz": "NZD", "new zealand": "NZD",
+	"ch": "CHF", "switzerland": "CHF", "zurich": "CHF",
+	"se": "SEK", "sweden": "SEK", "stockholm": "SEK",
+	"in": "INR", "india": "INR", "mumbai": "INR",
+	"cn": "CNY", "china": "CNY", "shanghai": "CNY",
+	"sg": "SGD", "singapore": "SGD",
+	"mx": "MXN", "mexico": "MXN",
+}
+
+// ForLocation guesses the currency for a free-form location such as
+// "London, UK" or "FR". Comma-separated parts are tried from the end, so
+// the country decides when both a city and a country are given.
+func ForLocation(location string) (string, bool) {
+	parts := strings.Split(strings.ToLower(location), ",")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if code, ok := locationCurrencies[strings.TrimSpace(parts[i])]; ok {
+			return code, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,120 @@
+// Package currency converts prices between currencies using a table of
+// exchange rates.
+package currency
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"celeste/models"
+)
+
+// Rates supplies exchange rates. Rate returns how many units of to one unit
+// of from buys.
+type Rates interface {
+	Rate(from, to string) (float64, bool)
+}
+
+// Table is a static rate table quoted against a base currency: Rates[code]
+// is the number of units of code per unit of Base.
+type Table struct {
+	Base  string             `json:"base"`
+	AsOf  string             `json:"as_of,omitempty"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// DefaultPath is CELESTE_FX_RATES_PATH, or data/fxRates.json.
+func DefaultPath() string {
+	if path := os.Getenv("CELESTE_FX_RATES_PATH"); path != "" {
+		return path
+	}
+	return "data/fxRates.json"
+}
+
+func LoadTable(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	table.Base = strings.ToUpper(table.Base)
+	rates := make(map[string]float64, len(table.Rates))
+	for code, rate := range table.Rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("rate for %s must be positive", code)
+		}
+		rates[strings.ToUpper(code)] = rate
+	}
+	rates[table.Base] = 1
+	table.Rates = rates
+	return &table, nil
+}
+
+func (t *Table) Rate(from, to string) (float64, bool) {
+	fromRate, ok := t.Rates[from]
+	if !ok {
+		return 0, false
+	}
+	toRate, ok := t.Rates[to]
+	if !ok {
+		return 0, false
+	}
+	return toRate / fromRate, true
+}
+
+// Converter converts amounts and rounds them to the target currency's
+// minor unit.
+type Converter struct {
+	rates Rates
+}
+
+func NewConverter(rates Rates) *Converter {
+	return &Converter{rates: rates}
+}
+
+// Supports reports whether amounts can be converted into code.
+func (c *Converter) Supports(code string) bool {
+	_, ok := c.rates.Rate(code, code)
+	return ok
+}
+
+func (c *Converter) Convert(amount models.Money, to string) (models.Money, error) {
+	to = strings.ToUpper(to)
+	if amount.CurrencyCode == to {
+		return amount, nil
+	}
+
+	rate, ok := c.rates.Rate(amount.CurrencyCode, to)
+	if !ok {
+		return models.Money{}, fmt.Errorf("no exchange rate from %s to %s", amount.CurrencyCode, to)
+	}
+
+	converted := amount.Scale(rate)
+	converted.CurrencyCode = to
+	return converted.Round(MinorUnits(to)), nil
+}
+
+// Currencies whose minor unit is not a hundredth.
+var minorUnits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"ISK": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+// MinorUnits is the number of decimal places prices are shown with.
+func MinorUnits(code string) int {
+	if units, ok := minorUnits[code]; ok {
+		return units
+	}
+	return 2
+}
@@ -0,0 +1,67 @@
+package currency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"celeste/models"
+)
+
+func TestConvert(t *testing.T) {
+	converter := NewConverter(&Table{Base: "USD", Rates: map[string]float64{
+		"USD": 1,
+		"EUR": 0.92,
+		"JPY": 149.5,
+		"KWD": 0.3075,
+	}})
+
+	tests := []struct {
+		amount models.Money
+		to     string
+		want   models.Money
+	}{
+		{models.Money{CurrencyCode: "USD", Units: 89, Nanos: 950_000_000}, "EUR", models.Money{CurrencyCode: "EUR", Units: 82, Nanos: 750_000_000}},
+		{models.Money{CurrencyCode: "USD", Units: 89, Nanos: 950_000_000}, "jpy", models.Money{CurrencyCode: "JPY", Units: 13448}},
+		{models.Money{CurrencyCode: "USD", Units: 100}, "KWD", models.Money{CurrencyCode: "KWD", Units: 30, Nanos: 750_000_000}},
+		{models.Money{CurrencyCode: "EUR", Units: 92}, "USD", models.Money{CurrencyCode: "USD", Units: 100}},
+		// Converting into the same currency leaves the amount alone
+		{models.Money{CurrencyCode: "USD", Units: 1, Nanos: 5}, "USD", models.Money{CurrencyCode: "USD", Units: 1, Nanos: 5}},
+	}
+	for _, tt := range tests {
+		got, err := converter.Convert(tt.amount, tt.to)
+		if err != nil || got != tt.want {
+			t.Errorf("Convert(%v, %s) = %+v, %v; want %+v", tt.amount, tt.to, got, err, tt.want)
+		}
+	}
+
+	if _, err := converter.Convert(models.Money{CurrencyCode: "USD", Units: 1}, "GBP"); err == nil {
+		t.Error("converted into a currency with no rate")
+	}
+	if converter.Supports("GBP") || !converter.Supports("EUR") {
+		t.Error("Supports disagrees with the rate table")
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"base": "usd", "rates": {"eur": 0.5}}`)
+	table, err := LoadTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate, ok := table.Rate("EUR", "USD"); !ok || rate != 2 {
+		t.Errorf("EUR to USD = %v, %v; want 2", rate, ok)
+	}
+
+	write(`{"base": "USD", "rates": {"EUR": 0}}`)
+	if _, err := LoadTable(path); err == nil {
+		t.Error("accepted a zero rate")
+	}
+}
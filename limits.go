@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"celeste/auth"
+	"celeste/ratelimit"
+)
+
+// Pages and health checks are never rate limited.
+var unlimitedPaths = map[string]bool{"/": true, "/home": true, "/api-comparison": true, "/health": true}
+
+// clientKey is who a request's limits apply to: its API key, its user by
+// credentials or a logged-in session, or else its IP address.
+func (s *CelesteService) clientKey(r *http.Request) string {
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		if principal.KeyID != "" {
+			return "key:" + principal.KeyID
+		}
+		return "user:" + principal.UserID
+	}
+	if session, ok := s.existingSession(r); ok && session.UserID != "" {
+		return "user:" + session.UserID
+	}
+	return "ip:" + s.clientIP(r)
+}
+
+// clientIP is the request's remote address or, behind a trusted proxy,
+// the address the proxy appended to X-Forwarded-For.
+func (s *CelesteService) clientIP(r *http.Request) string {
+	if s.trustForwardedFor {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimit is a mux.MiddlewareFunc taking a token from the client's bucket
+// for each request.
+func (s *CelesteService) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil || unlimitedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := s.limiter.Allow(s.clientKey(r), time.Now()); !ok {
+			tooManyRequests(w, wait, "Rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chargeQuota refuses requests from clients that have spent their daily
+// LLM tokens, and charges them for the tokens the request spends.
+func (s *CelesteService) chargeQuota(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := s.clientKey(r)
+		if ok, wait := s.quota.Check(key, time.Now()); !ok {
+			tooManyRequests(w, wait, "Daily LLM token quota exhausted")
+			return
+		}
+		next(w, r.WithContext(ratelimit.WithCharge(r.Context(), s.quota, key)))
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
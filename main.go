@@ -9,21 +9,42 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"google.golang.org/genai"
 
 	"celeste/agents"
+	"celeste/auth"
+	"celeste/models"
+	"celeste/ratelimit"
 )
 
 type ChatRequest struct {
 	Query  string `json:"query"`
 	UserID string `json:"user_id,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Sort   string `json:"sort,omitempty"`
+
+	Filters map[string]string `json:"filters,omitempty"`
+
+	// Preferred currency for display prices (ISO 4217); otherwise derived
+	// from the location, if known
+	Currency string `json:"currency,omitempty"`
+	Location string `json:"location,omitempty"`
 }
 
 type CelesteService struct {
 	orchestrator *agents.AgentOrchestrator
+	auth         *auth.Middleware
+	limiter      *ratelimit.Limiter // nil when rate limiting is off
+	quota        *ratelimit.DailyQuota
+	// Whether X-Forwarded-For can be trusted for client IPs
+	trustForwardedFor bool
 }
 
 func openBrowser(url string) {
@@ -45,11 +66,28 @@ func openBrowser(url string) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		log.Fatal("GEMINI_API_KEY environment variable is required")
 	}
 
+	authenticators, err := auth.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure authentication:", err)
+	}
+	switch {
+	case len(authenticators) == 0 && !auth.DisabledFromEnv():
+		log.Fatal("No authentication configured: add API keys, CELESTE_TOKEN_SECRET or a JWKS, or set CELESTE_AUTH_DISABLED=true")
+	case len(authenticators) == 0:
+		log.Printf("Authentication disabled: admin and user routes are closed, and sessions cannot log in")
+	case auth.DisabledFromEnv():
+		log.Printf("Ignoring CELESTE_AUTH_DISABLED: authentication is configured")
+	}
+
 	ctx := context.Background()
 	client, err := genai.NewClient(ctx, nil)
 	if err != nil {
@@ -63,15 +101,26 @@ func main() {
 
 	service := &CelesteService{
 		orchestrator: orchestrator,
+		auth:         auth.NewMiddleware(authenticators...),
+		limiter:      ratelimit.LimiterFromEnv(),
+		quota:        ratelimit.QuotaFromEnv(),
+
+		trustForwardedFor: os.Getenv("CELESTE_TRUST_FORWARDED_FOR") == "true",
 	}
 
 	router := mux.NewRouter()
+	router.Use(service.auth.Handler)
+	router.Use(service.rateLimit)
 
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Celeste Multi-Agent AI Shopping Assistant")
 	}).Methods("GET")
 
-	router.HandleFunc("/chat", service.handleChat).Methods("POST")
+	router.HandleFunc("/chat", service.chargeQuota(service.handleChat)).Methods("POST")
+	router.HandleFunc("/products/search", service.chargeQuota(service.handleProductSearch)).Methods("GET")
+	service.registerCatalogRoutes(router)
+	service.registerUserRoutes(router)
+	service.registerSessionRoutes(router)
 
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		agentList := service.orchestrator.ListAgents()
@@ -79,6 +128,7 @@ func main() {
 			"status":      "healthy",
 			"agents":      agentList,
 			"agent_count": len(agentList),
+			"catalog":     service.orchestrator.CatalogStatus(),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
@@ -108,14 +158,25 @@ func main() {
 		}
 	}).Methods("GET")
 
-	router.HandleFunc("/agents", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/agents", service.auth.Require(auth.ScopeAgents, func(w http.ResponseWriter, r *http.Request) {
 		agentList := service.orchestrator.ListAgents()
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"agents": agentList,
 			"count":  len(agentList),
 		})
-	}).Methods("GET")
+	})).Methods("GET")
+
+	router.HandleFunc("/metrics", service.auth.Require(auth.ScopeAgents, func(w http.ResponseWriter, r *http.Request) {
+		metrics := service.orchestrator.Metrics()
+		if service.limiter != nil {
+			metrics["rate_limit"] = service.limiter.Metrics()
+		}
+		metrics["llm_quota"] = service.quota.Metrics(time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metrics)
+	})).Methods("GET")
+
 	port := ":8080"
 	fmt.Printf("Celeste Multi-Agent System starting on port %s\n", port)
 
@@ -134,13 +195,31 @@ func (s *CelesteService) handleChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := req.UserID
-	if userID == "" {
-		userID = "anonymous_user"
+	userID, status, err := s.chatUserID(r, s.session(w, r), req.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	opts, err := agents.ResolveSearchOptions(models.SearchOptions{
+		Limit:   req.Limit,
+		Offset:  req.Offset,
+		Cursor:  req.Cursor,
+		Sort:    req.Sort,
+		Filters: req.Filters,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.orchestrator.SetUserLocale(userID, req.Location, req.Currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	ctx := r.Context()
-	response, err := s.orchestrator.ProcessUserRequest(ctx, userID, req.Query)
+	response, err := s.orchestrator.ProcessUserRequest(ctx, userID, req.Query, opts)
 	if err != nil {
 		log.Printf("Orchestrator error: %v", err)
 		http.Error(w, "Agent processing failed", http.StatusInternalServerError)
@@ -150,3 +229,57 @@ func (s *CelesteService) handleChat(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+func (s *CelesteService) handleProductSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	opts := models.SearchOptions{
+		Cursor:  params.Get("cursor"),
+		Sort:    params.Get("sort"),
+		Filters: make(map[string]string),
+	}
+	for _, key := range []string{"category", "price", "min_price", "max_price", "availability", "brand", "color", "size", "material", "min_rating"} {
+		if value := params.Get(key); value != "" {
+			opts.Filters[key] = value
+		}
+	}
+
+	var err error
+	if limit := params.Get("limit"); limit != "" {
+		if opts.Limit, err = strconv.Atoi(limit); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if offset := params.Get("offset"); offset != "" {
+		if opts.Offset, err = strconv.Atoi(offset); err != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts, err = agents.ResolveSearchOptions(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currencyCode := strings.ToUpper(params.Get("currency"))
+	if currencyCode != "" && !s.orchestrator.SupportsCurrency(currencyCode) {
+		http.Error(w, fmt.Sprintf("unsupported currency %q", currencyCode), http.StatusBadRequest)
+		return
+	}
+
+	page, err := s.orchestrator.SearchCatalog(r.Context(), params.Get("q"), opts)
+	if err != nil {
+		log.Printf("Catalogue search error: %v", err)
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+	if currencyCode != "" {
+		page.Currency = currencyCode
+		page.DisplayPrices = s.orchestrator.DisplayPrices(page.Products, currencyCode)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,127 @@
+// models/money.go
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const nanosPerUnit = 1_000_000_000
+
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// An amount of money in a currency, following google.type.Money: units are
+// whole currency units and nanos the fraction, with the same sign.
+type Money struct {
+	CurrencyCode string `json:"currency_code"`
+	Units        int64  `json:"units"`
+	Nanos        int32  `json:"nanos"`
+}
+
+// PriceUsd is the historical name of Money. Despite the name, the currency
+// is whatever CurrencyCode says.
+type PriceUsd = Money
+
+// MoneyFromNanos builds an amount from a total number of nano-units.
+func MoneyFromNanos(currencyCode string, total int64) Money {
+	return Money{
+		CurrencyCode: currencyCode,
+		Units:        total / nanosPerUnit,
+		Nanos:        int32(total % nanosPerUnit),
+	}
+}
+
+// TotalNanos is the amount as a single count of nano-units.
+func (m Money) TotalNanos() int64 {
+	return m.Units*nanosPerUnit + int64(m.Nanos)
+}
+
+func (m Money) Float64() float64 {
+	return float64(m.Units) + float64(m.Nanos)/nanosPerUnit
+}
+
+func (m Money) IsZero() bool {
+	return m.Units == 0 && m.Nanos == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Units < 0 || m.Nanos < 0
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.CurrencyCode != other.CurrencyCode {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.CurrencyCode, other.CurrencyCode)
+	}
+	return MoneyFromNanos(m.CurrencyCode, m.TotalNanos()+other.TotalNanos()), nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(other.Negate())
+}
+
+func (m Money) Negate() Money {
+	return Money{CurrencyCode: m.CurrencyCode, Units: -m.Units, Nanos: -m.Nanos}
+}
+
+// Mul multiplies by a whole quantity.
+func (m Money) Mul(quantity int64) Money {
+	return MoneyFromNanos(m.CurrencyCode, m.TotalNanos()*quantity)
+}
+
+// Scale multiplies by a factor such as an exchange rate or a discount,
+// rounding to the nearest nano.
+func (m Money) Scale(factor float64) Money {
+	return MoneyFromNanos(m.CurrencyCode, int64(math.Round(float64(m.TotalNanos())*factor)))
+}
+
+// Round rounds half away from zero to the given number of decimal places,
+// e.g. 2 for cents.
+func (m Money) Round(decimals int) Money {
+	if decimals >= 9 {
+		return m
+	}
+	step := int64(math.Pow10(9 - max(decimals, 0)))
+	total := m.TotalNanos()
+	remainder := total % step
+	total -= remainder
+	if remainder*2 >= step {
+		total += step
+	} else if remainder*2 <= -step {
+		total -= step
+	}
+	return MoneyFromNanos(m.CurrencyCode, total)
+}
+
+// Compare returns -1, 0 or 1 as m is less than, equal to or greater than
+// other.
+func (m Money) Compare(other Money) (int, error) {
+	if m.CurrencyCode != other.CurrencyCode {
+		return 0, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.CurrencyCode, other.CurrencyCode)
+	}
+	a, b := m.TotalNanos(), other.TotalNanos()
+	switch {
+	case a < b:
+		return -1, nil
+	case a > b:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// String formats the amount exactly, with at least two decimals, e.g.
+// "89.95 USD".
+func (m Money) String() string {
+	total := m.TotalNanos()
+	sign := ""
+	if total < 0 {
+		sign, total = "-", -total
+	}
+	fraction := strings.TrimRight(fmt.Sprintf("%09d", total%nanosPerUnit), "0")
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	return sign + strconv.FormatInt(total/nanosPerUnit, 10) + "." + fraction + " " + m.CurrencyCode
+}
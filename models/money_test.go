@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	price := Money{CurrencyCode: "USD", Units: 89, Nanos: 950_000_000}
+
+	sum, err := price.Add(Money{CurrencyCode: "USD", Units: 0, Nanos: 100_000_000})
+	if err != nil || sum != (Money{CurrencyCode: "USD", Units: 90, Nanos: 50_000_000}) {
+		t.Errorf("Add = %+v, %v", sum, err)
+	}
+	difference, err := Money{CurrencyCode: "USD", Units: 1}.Sub(price)
+	if err != nil || difference != (Money{CurrencyCode: "USD", Units: -88, Nanos: -950_000_000}) {
+		t.Errorf("Sub = %+v, %v; units and nanos must share a sign", difference, err)
+	}
+	if got := price.Mul(3); got != (Money{CurrencyCode: "USD", Units: 269, Nanos: 850_000_000}) {
+		t.Errorf("Mul = %+v", got)
+	}
+	if _, err := price.Add(Money{CurrencyCode: "EUR", Units: 1}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("adding EUR to USD: err = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := price.Compare(Money{CurrencyCode: "EUR"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("comparing EUR to USD: err = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestMoneyRound(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		decimals int
+		want     Money
+	}{
+		{Money{"USD", 1, 235_000_000}, 2, Money{"USD", 1, 240_000_000}},
+		{Money{"USD", 1, 234_999_999}, 2, Money{"USD", 1, 230_000_000}},
+		{Money{"USD", -1, -235_000_000}, 2, Money{"USD", -1, -240_000_000}},
+		{Money{"JPY", 149, 500_000_000}, 0, Money{"JPY", 150, 0}},
+		{Money{"USD", 1, 5}, 9, Money{"USD", 1, 5}},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Round(tt.decimals); got != tt.want {
+			t.Errorf("%v.Round(%d) = %+v, want %+v", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		amount Money
+		want   string
+	}{
+		{Money{"USD", 89, 950_000_000}, "89.95 USD"},
+		{Money{"USD", 5, 0}, "5.00 USD"},
+		{Money{"USD", 0, 123_456_789}, "0.123456789 USD"},
+		{Money{"EUR", -2, -500_000_000}, "-2.50 EUR"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -8,18 +8,146 @@ import (
 
 // Core data types
 type Product struct {
-	ID          string   `json:"id"`
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Picture     string   `json:"picture"`
-	PriceUsd    PriceUsd `json:"priceUsd"`
-	Categories  []string `json:"categories"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Picture     string    `json:"picture"`
+	PriceUsd    PriceUsd  `json:"priceUsd"`
+	Categories  []string  `json:"categories"`
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+	Brand       string    `json:"brand,omitempty"`
+	Material    string    `json:"material,omitempty"`
+	Rating      float64   `json:"rating,omitempty"` // Average review rating, 0-5
+	ReviewCount int       `json:"review_count,omitempty"`
+	Variants    []Variant `json:"variants,omitempty"`
 }
 
-type PriceUsd struct {
-	CurrencyCode string `json:"currency_code"`
-	Units        int64  `json:"units"`
-	Nanos        int32  `json:"nanos"`
+// A purchasable size/colour combination of a product
+type Variant struct {
+	SKU      string    `json:"sku"`
+	Size     string    `json:"size,omitempty"`
+	Color    string    `json:"color,omitempty"`
+	Stock    int       `json:"stock"`
+	PriceUsd *PriceUsd `json:"priceUsd,omitempty"` // Overrides the product price when set
+}
+
+// Search hit with its relevance score
+type ScoredProduct struct {
+	Product Product `json:"product"`
+	Score   float64 `json:"score"`
+}
+
+// Paging and ordering for product searches
+type SearchOptions struct {
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Sort   string `json:"sort,omitempty"` // relevance, price_asc, price_desc, newest or rating
+	// Facet filters: category, price (bucket), min_price, max_price,
+	// availability, brand, color, size, material, min_rating
+	Filters map[string]string `json:"filters,omitempty"`
+}
+
+// Price of a quantity of a product after promotions. Promotions do not
+// stack: Promotion is the one saving the most.
+type PriceQuote struct {
+	ProductID string            `json:"product_id"`
+	SKU       string            `json:"sku,omitempty"` // The variant priced, when one was chosen
+	Quantity  int               `json:"quantity"`
+	Original  Money             `json:"original"`
+	Final     Money             `json:"final"`
+	Discount  Money             `json:"discount"`
+	Promotion *PromotionSummary `json:"promotion,omitempty"`
+	// Active deals the product qualifies for that do not apply at this
+	// quantity, such as multi-buys
+	Offers []PromotionSummary `json:"offers,omitempty"`
+}
+
+type PromotionSummary struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Attribute-by-attribute comparison of products
+type ComparisonTable struct {
+	Products []Product       `json:"products"`
+	Rows     []ComparisonRow `json:"rows"`
+	Summary  string          `json:"summary"`
+}
+
+// One attribute of a comparison, with each product's value by product ID
+type ComparisonRow struct {
+	Attribute string            `json:"attribute"`
+	Values    map[string]string `json:"values"`
+	Best      string            `json:"best,omitempty"` // Product ID that wins on this attribute, if any
+}
+
+// A complete outfit composed from catalogue items
+type Outfit struct {
+	Name  string       `json:"name"`
+	Items []OutfitItem `json:"items"`
+	Total Money        `json:"total"`
+}
+
+type OutfitItem struct {
+	Slot    string  `json:"slot"` // top, bottom, dress, outerwear, shoes, bag or accessory
+	Product Product `json:"product"`
+	Color   string  `json:"color,omitempty"` // Suggested colour variant
+}
+
+// A brand's size chart for some categories. A chart with no brand is the
+// default for its categories.
+type SizeChart struct {
+	Brand      string         `json:"brand,omitempty"`
+	Categories []string       `json:"categories"`
+	Group      string         `json:"group"`             // Fit profile group: shoes, tops, bottoms or dresses
+	Measure    string         `json:"measure,omitempty"` // Body measurement that picks the size, e.g. foot_cm
+	Fit        string         `json:"fit,omitempty"`     // true_to_size, runs_small or runs_large
+	Rows       []SizeChartRow `json:"rows"`
+}
+
+// One size in a chart. Several rows may share a label when the brand's
+// size spans more than one size in another system.
+type SizeChartRow struct {
+	Label        string                `json:"label"`                  // As the product's variants name it
+	Sizes        map[string]string     `json:"sizes"`                  // By system: us, uk, eu or int
+	Measurements map[string][2]float64 `json:"measurements,omitempty"` // Minimum and maximum, in cm
+}
+
+// The size suggested for a product from the shopper's fit profile
+type SizeRecommendation struct {
+	ProductID   string            `json:"product_id"`
+	Size        string            `json:"size"`
+	SKU         string            `json:"sku,omitempty"`
+	InStock     bool              `json:"in_stock"`
+	Conversions map[string]string `json:"conversions,omitempty"` // The size in other systems
+	Basis       string            `json:"basis"`                 // What the size was chosen from
+	Note        string            `json:"note,omitempty"`
+}
+
+// One value of a search facet and how many matches have it
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// A page of catalogue search results
+type SearchPage struct {
+	Query        string                  `json:"query"`
+	Products     []Product               `json:"products"`
+	Scores       map[string]float64      `json:"scores,omitempty"`
+	TotalMatches int                     `json:"total_matches"`
+	Facets       map[string][]FacetValue `json:"facets,omitempty"`
+	Filters      map[string]string       `json:"filters,omitempty"`
+	DidYouMean   string                  `json:"did_you_mean,omitempty"`
+	Offset       int                     `json:"offset"`
+	Limit        int                     `json:"limit"`
+	Sort         string                  `json:"sort"`
+	NextCursor   string                  `json:"next_cursor,omitempty"`
+	// Prices converted into the requested currency, by product ID
+	Currency      string           `json:"currency,omitempty"`
+	DisplayPrices map[string]Money `json:"display_prices,omitempty"`
 }
 
 // Agent framework types (ADK-inspired)
@@ -57,15 +185,170 @@ type UserContext struct {
 	Preferences map[string]string `json:"preferences"`
 	History     []string          `json:"history"`
 	CartItems   []string          `json:"cart_items"`
-	Location    string            `json:"location,omitempty"`
+	Location    string            `json:"location,omitempty"` // Also decides the display currency unless Preferences["currency"] is set
+	// Last search and its filters, so follow-ups can refine it
+	LastQuery     string            `json:"last_query,omitempty"`
+	ActiveFilters map[string]string `json:"active_filters,omitempty"`
+	// IDs of the products shown in the last reply, for "this one" references
+	RecentProducts []string `json:"recent_products,omitempty"`
+	// Learned from queries and interactions, alongside the stated Preferences
+	Learned PreferenceProfile `json:"learned"`
+	// Earlier turns, so follow-ups can refer back to what was shown
+	Conversation Conversation `json:"conversation"`
+}
+
+// A visit identified by a server-issued ID. Its state lives in a context of
+// its own until the shopper logs in, when it is linked to their user.
+type Session struct {
+	ID        string    `json:"session_id"`
+	UserID    string    `json:"user_id,omitempty"` // Empty while anonymous
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// A shopper's conversation with Céleste: the most recent turns in full and
+// a summary of the ones before them
+type Conversation struct {
+	Turns      []ConversationTurn `json:"turns,omitempty"`
+	Summary    string             `json:"summary,omitempty"`
+	Summarized int                `json:"summarized,omitempty"` // Turns folded into the summary
+}
+
+// One exchange: what the shopper asked and what Céleste showed and said
+type ConversationTurn struct {
+	Query      string    `json:"query"`
+	Resolved   string    `json:"resolved,omitempty"` // The search run, when it differs from the query
+	Intent     string    `json:"intent,omitempty"`
+	Products   []string  `json:"products,omitempty"`   // IDs shown, in order
+	Referenced []string  `json:"referenced,omitempty"` // IDs from earlier turns the query referred to
+	Message    string    `json:"message,omitempty"`
+	Agents     []string  `json:"agents,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// What a shopper tends to look for, learned from their searches and
+// interactions. Weights decay over time so recent interest counts most.
+type PreferenceProfile struct {
+	Categories map[string]float64 `json:"categories,omitempty"`
+	Colors     map[string]float64 `json:"colors,omitempty"`
+	Sizes      map[string]float64 `json:"sizes,omitempty"`
+	Brands     map[string]float64 `json:"brands,omitempty"`
+	PriceBand  *PriceBand         `json:"price_band,omitempty"`
+	UpdatedAt  time.Time          `json:"updated_at,omitzero"`
+	// Decayed sums over the prices of products the shopper showed interest
+	// in, from which PriceBand is derived
+	PriceWeight  float64 `json:"-"`
+	PriceSum     float64 `json:"-"`
+	PriceSquares float64 `json:"-"`
+}
+
+// The range of prices a shopper usually buys in
+type PriceBand struct {
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+// A shopper viewing, adding to cart or buying a product
+type Interaction struct {
+	UserID    string    `json:"user_id"`
+	ProductID string    `json:"product_id"`
+	Type      string    `json:"type"` // view, cart_add or purchase
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// A list of product IDs as ranked before and after personalization
+type Ranking struct {
+	Baseline     []string `json:"baseline"`
+	Personalized []string `json:"personalized"`
+}
+
+// One reply's rankings, logged so personalization can be evaluated offline
+// against what the shopper went on to do
+type RankingEvent struct {
+	UserID          string    `json:"user_id"`
+	Query           string    `json:"query"`
+	WorkflowID      string    `json:"workflow_id"`
+	Timestamp       time.Time `json:"timestamp"`
+	Results         Ranking   `json:"results"`
+	Recommendations Ranking   `json:"recommendations"`
+	Score           float64   `json:"score"` // The reply's personalization score
+}
+
+// A recommended product and the model that suggested it
+type Recommendation struct {
+	Product Product  `json:"product"`
+	Score   float64  `json:"score"`
+	Source  string   `json:"source"` // collaborative or content
+	Reasons []Reason `json:"reasons,omitempty"`
+}
+
+// Why a product or action was suggested
+type Reason struct {
+	Code    string `json:"code"` // Stable identifier, e.g. low_stock or searched_for
+	Message string `json:"message"`
+}
+
+// A request to be told when a product's price drops to a threshold
+type PriceAlert struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	ProductID   string    `json:"product_id"`
+	Threshold   Money     `json:"threshold"`
+	WebhookURL  string    `json:"webhook_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	TriggeredAt time.Time `json:"triggered_at,omitzero"`
+}
+
+// A message recorded for a user, such as a triggered price alert
+type Notification struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	AlertID   string    `json:"alert_id,omitempty"`
+	ProductID string    `json:"product_id,omitempty"`
+	Message   string    `json:"message"`
+	Price     *Money    `json:"price,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Webhook delivery outcome, when the alert has a webhook
+	Delivered     bool   `json:"delivered,omitempty"`
+	DeliveryError string `json:"delivery_error,omitempty"`
 }
 
 // Enhanced chat response
 type CelesteResponse struct {
-	Message      string    `json:"message"`
-	Products     []Product `json:"products,omitempty"`
-	Actions      []string  `json:"actions,omitempty"`
-	WorkflowID   string    `json:"workflow_id"`
-	AgentPath    []string  `json:"agent_path"` // Shows which agents were involved
-	Personalized bool      `json:"personalized"`
+	Message      string                  `json:"message"`
+	Products     []Product               `json:"products,omitempty"`
+	Scores       map[string]float64      `json:"scores,omitempty"` // Relevance score by product ID
+	TotalMatches int                     `json:"total_matches"`
+	NextCursor   string                  `json:"next_cursor,omitempty"`
+	Facets       map[string][]FacetValue `json:"facets,omitempty"`
+	Filters      map[string]string       `json:"filters,omitempty"` // Filters applied to this search
+	DidYouMean   string                  `json:"did_you_mean,omitempty"`
+	// Prices converted into the shopper's currency, by product ID
+	Currency      string           `json:"currency,omitempty"`
+	DisplayPrices map[string]Money `json:"display_prices,omitempty"`
+	// Promotional prices by product ID, for price enquiries
+	Prices     map[string]PriceQuote `json:"prices,omitempty"`
+	Comparison *ComparisonTable      `json:"comparison,omitempty"`
+	Outfits    []Outfit              `json:"outfits,omitempty"`
+	// Size guidance by product ID
+	SizeAdvice map[string]SizeRecommendation `json:"size_advice,omitempty"`
+	SizeCharts map[string]SizeChart          `json:"size_charts,omitempty"`
+	// Products related to these: what other shoppers also bought, then the
+	// most similar in the catalogue
+	RecommendedProducts []Recommendation `json:"recommended_products,omitempty"`
+	// Products from earlier turns that a follow-up such as "the cheaper one"
+	// or "do those come in black?" referred to
+	ReferencedProducts []string `json:"referenced_products,omitempty"`
+	// Why each product and action was suggested, by product ID and action
+	ProductReasons map[string][]Reason `json:"product_reasons,omitempty"`
+	ActionReasons  map[string][]Reason `json:"action_reasons,omitempty"`
+	Actions        []string            `json:"actions,omitempty"`
+	WorkflowID     string              `json:"workflow_id"`
+	AgentPath      []string            `json:"agent_path"` // Shows which agents were involved
+	// How far the shopper's signals moved the results and recommended
+	// products from their unpersonalized order: 0 not at all, 1 reversed
+	PersonalizationScore float64 `json:"personalization_score"`
+	Personalized         bool    `json:"personalized"` // Whether anything moved
 }
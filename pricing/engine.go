@@ -0,0 +1,76 @@
+package pricing
+
+import (
+	"time"
+
+	"celeste/currency"
+	"celeste/models"
+)
+
+// Engine prices products against a fixed set of promotions.
+type Engine struct {
+	promotions []Promotion
+	now        func() time.Time
+}
+
+func NewEngine(promotions []Promotion) *Engine {
+	return &Engine{promotions: promotions, now: time.Now}
+}
+
+// Active lists the promotions running now.
+func (e *Engine) Active() []Promotion {
+	now := e.now()
+	var active []Promotion
+	for _, promotion := range e.promotions {
+		if promotion.Active(now) {
+			active = append(active, promotion)
+		}
+	}
+	return active
+}
+
+// Quote prices a quantity of a product, or of one of its variants when
+// variant is not nil, at the variant's own price if it has one. Of the
+// active promotions the product qualifies for, the one saving the most is
+// applied; bundles that need a larger quantity are listed as offers instead.
+func (e *Engine) Quote(product models.Product, variant *models.Variant, quantity int) models.PriceQuote {
+	quantity = max(quantity, 1)
+	unit := product.PriceUsd
+	var sku string
+	if variant != nil {
+		sku = variant.SKU
+		if variant.PriceUsd != nil {
+			unit = *variant.PriceUsd
+		}
+	}
+	original := unit.Mul(int64(quantity))
+
+	quote := models.PriceQuote{
+		ProductID: product.ID,
+		SKU:       sku,
+		Quantity:  quantity,
+		Original:  original,
+		Final:     original,
+		Discount:  models.Money{CurrencyCode: unit.CurrencyCode},
+	}
+
+	for _, promotion := range e.Active() {
+		if !promotion.Applies(product) {
+			continue
+		}
+		summary := models.PromotionSummary{ID: promotion.ID, Name: promotion.Name, Description: promotion.Description()}
+
+		discount := promotion.discount(unit, quantity).Round(currency.MinorUnits(unit.CurrencyCode))
+		if discount.IsZero() {
+			quote.Offers = append(quote.Offers, summary)
+			continue
+		}
+		if better, _ := discount.Compare(quote.Discount); better > 0 {
+			quote.Discount = discount
+			quote.Promotion = &summary
+		}
+	}
+
+	quote.Final, _ = original.Sub(quote.Discount)
+	return quote
+}
@@ -0,0 +1,112 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"celeste/models"
+)
+
+func usd(units int64, nanos int32) models.Money {
+	return models.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+}
+
+func TestQuote(t *testing.T) {
+	saleStart := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	saleEnd := time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)
+	engine := NewEngine([]Promotion{
+		{ID: "boot10", Type: TypePercentage, PercentOff: 10, ProductIDs: []string{"boot"}},
+		{ID: "boots25", Type: TypeCategorySale, PercentOff: 25, Categories: []string{"Boots"}, StartsAt: saleStart, EndsAt: saleEnd},
+		{ID: "3for2", Type: TypeBundle, BuyQuantity: 3, PayQuantity: 2},
+	})
+	boot := models.Product{ID: "boot", PriceUsd: usd(89, 950_000_000), Categories: []string{"boots"}}
+	hat := models.Product{ID: "hat", PriceUsd: usd(20, 0), Categories: []string{"hats"}}
+	yen := models.Product{ID: "boot", PriceUsd: models.Money{CurrencyCode: "JPY", Units: 1999}, Categories: []string{"boots"}}
+	sale := &models.Variant{SKU: "boot-sale", PriceUsd: &models.Money{CurrencyCode: "USD", Units: 45}}
+	plain := &models.Variant{SKU: "boot-plain"}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		product   models.Product
+		variant   *models.Variant
+		quantity  int
+		final     models.Money
+		promotion string
+		offers    int
+	}{
+		// 10% of 89.95 is 8.995, rounded half away from zero to 9.00
+		{"percentage, rounded to cents", saleStart.AddDate(0, 0, -1), boot, nil, 1, usd(80, 950_000_000), "boot10", 1},
+		{"quantity below one", saleStart.AddDate(0, 0, -1), boot, nil, 0, usd(80, 950_000_000), "boot10", 1},
+		// The bundle's free boot saves more than 10% off three
+		{"bundle beats percentage", saleStart.AddDate(0, 0, -1), boot, nil, 3, usd(179, 900_000_000), "3for2", 0},
+		{"bundle on four", saleStart.AddDate(0, 0, -1), hat, nil, 4, usd(60, 0), "3for2", 0},
+		// 25% of 89.95 is 22.4875; promotions do not stack
+		{"category sale from its start", saleStart, boot, nil, 1, usd(67, 460_000_000), "boots25", 1},
+		{"category sale until its end", saleEnd.Add(-time.Second), boot, nil, 1, usd(67, 460_000_000), "boots25", 1},
+		{"category sale over", saleEnd, boot, nil, 1, usd(80, 950_000_000), "boot10", 1},
+		{"no promotion applies", saleStart, hat, nil, 1, usd(20, 0), "", 1},
+		{"variant's own price", saleStart.AddDate(0, 0, -1), boot, sale, 1, usd(40, 500_000_000), "boot10", 1},
+		{"variant without its own price", saleStart.AddDate(0, 0, -1), boot, plain, 1, usd(80, 950_000_000), "boot10", 1},
+		// 10% of ¥1999 rounds to whole yen
+		{"currency without cents", saleStart.AddDate(0, 0, -1), yen, nil, 1, models.Money{CurrencyCode: "JPY", Units: 1799}, "boot10", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine.now = func() time.Time { return tt.now }
+			quote := engine.Quote(tt.product, tt.variant, tt.quantity)
+
+			if quote.Final != tt.final {
+				t.Errorf("final = %v, want %v", quote.Final, tt.final)
+			}
+			if sum, _ := quote.Final.Add(quote.Discount); sum != quote.Original {
+				t.Errorf("final %v and discount %v do not add up to original %v", quote.Final, quote.Discount, quote.Original)
+			}
+			promotion := ""
+			if quote.Promotion != nil {
+				promotion = quote.Promotion.ID
+			}
+			if promotion != tt.promotion || len(quote.Offers) != tt.offers {
+				t.Errorf("promotion = %q with %d offers, want %q with %d", promotion, len(quote.Offers), tt.promotion, tt.offers)
+			}
+			if tt.variant != nil && quote.SKU != tt.variant.SKU {
+				t.Errorf("sku = %q, want %q", quote.SKU, tt.variant.SKU)
+			}
+		})
+	}
+}
+
+func TestPromotionValidate(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		promotion Promotion
+		valid     bool
+	}{
+		{Promotion{ID: "p", Type: TypePercentage, PercentOff: 100}, true},
+		{Promotion{ID: "p", Type: TypePercentage, PercentOff: 0}, false},
+		{Promotion{ID: "p", Type: TypePercentage, PercentOff: 120}, false},
+		{Promotion{ID: "p", Type: TypeCategorySale, PercentOff: 20}, false},
+		{Promotion{ID: "p", Type: TypeBundle, BuyQuantity: 3, PayQuantity: 2}, true},
+		{Promotion{ID: "p", Type: TypeBundle, BuyQuantity: 2, PayQuantity: 2}, false},
+		{Promotion{ID: "p", Type: "fixed"}, false},
+		{Promotion{Type: TypePercentage, PercentOff: 10}, false},
+		{Promotion{ID: "p", Type: TypePercentage, PercentOff: 10, StartsAt: start, EndsAt: start}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.promotion.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate(%+v) = %v, want valid %v", tt.promotion, err, tt.valid)
+		}
+	}
+}
+
+func TestDescription(t *testing.T) {
+	for promotion, want := range map[*Promotion]string{
+		{Type: TypePercentage, PercentOff: 20}:             "20% off",
+		{Type: TypePercentage, PercentOff: 12.5}:           "12.5% off",
+		{Type: TypeBundle, BuyQuantity: 3, PayQuantity: 2}: "Buy 3, pay for 2",
+	} {
+		if got := promotion.Description(); got != want {
+			t.Errorf("Description() = %q, want %q", got, want)
+		}
+	}
+}
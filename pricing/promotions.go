@@ -0,0 +1,134 @@
+// Package pricing applies promotion rules to catalogue prices.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"celeste/models"
+)
+
+// Promotion types.
+const (
+	TypePercentage   = "percentage"    // percent off the listed products
+	TypeCategorySale = "category_sale" // percent off everything in the listed categories
+	TypeBundle       = "bundle"        // buy BuyQuantity, pay for PayQuantity
+)
+
+// Promotion is one rule from the promotions file. Products qualify by ID or
+// by category; a rule with neither applies to the whole catalogue. StartsAt
+// and EndsAt bound when it runs and may be left out.
+type Promotion struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	PercentOff  float64   `json:"percent_off,omitempty"`
+	BuyQuantity int       `json:"buy_quantity,omitempty"`
+	PayQuantity int       `json:"pay_quantity,omitempty"`
+	ProductIDs  []string  `json:"product_ids,omitempty"`
+	Categories  []string  `json:"categories,omitempty"`
+	StartsAt    time.Time `json:"starts_at,omitzero"`
+	EndsAt      time.Time `json:"ends_at,omitzero"`
+}
+
+// DefaultPath is CELESTE_PROMOTIONS_PATH, or data/promotions.json.
+func DefaultPath() string {
+	if path := os.Getenv("CELESTE_PROMOTIONS_PATH"); path != "" {
+		return path
+	}
+	return "data/promotions.json"
+}
+
+func LoadPromotions(path string) ([]Promotion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Promotions []Promotion `json:"promotions"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for _, promotion := range file.Promotions {
+		if err := promotion.validate(); err != nil {
+			return nil, fmt.Errorf("promotion %q: %v", promotion.ID, err)
+		}
+	}
+	return file.Promotions, nil
+}
+
+func (p Promotion) validate() error {
+	if p.ID == "" {
+		return fmt.Errorf("missing id")
+	}
+	switch p.Type {
+	case TypePercentage, TypeCategorySale:
+		if p.PercentOff <= 0 || p.PercentOff > 100 {
+			return fmt.Errorf("percent_off must be between 0 and 100")
+		}
+		if p.Type == TypeCategorySale && len(p.Categories) == 0 {
+			return fmt.Errorf("category sale needs categories")
+		}
+	case TypeBundle:
+		if p.BuyQuantity < 2 || p.PayQuantity < 1 || p.PayQuantity >= p.BuyQuantity {
+			return fmt.Errorf("bundle needs buy_quantity above pay_quantity, which must be at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", p.Type)
+	}
+	if !p.StartsAt.IsZero() && !p.EndsAt.IsZero() && !p.EndsAt.After(p.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// Active reports whether the promotion runs at the given time.
+func (p Promotion) Active(now time.Time) bool {
+	return (p.StartsAt.IsZero() || !now.Before(p.StartsAt)) && (p.EndsAt.IsZero() || now.Before(p.EndsAt))
+}
+
+// Applies reports whether a product qualifies for the promotion.
+func (p Promotion) Applies(product models.Product) bool {
+	if len(p.ProductIDs) == 0 && len(p.Categories) == 0 {
+		return true
+	}
+	for _, id := range p.ProductIDs {
+		if id == product.ID {
+			return true
+		}
+	}
+	for _, category := range p.Categories {
+		for _, c := range product.Categories {
+			if strings.EqualFold(category, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Description is a short shopper-facing summary, e.g. "20% off".
+func (p Promotion) Description() string {
+	if p.Type == TypeBundle {
+		return fmt.Sprintf("Buy %d, pay for %d", p.BuyQuantity, p.PayQuantity)
+	}
+	return fmt.Sprintf("%s%% off", strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", p.PercentOff), "0"), "."))
+}
+
+// discount is how much the promotion takes off the given quantity of a
+// product at unit price.
+func (p Promotion) discount(unit models.Money, quantity int) models.Money {
+	total := unit.Mul(int64(quantity))
+	switch p.Type {
+	case TypeBundle:
+		free := (quantity / p.BuyQuantity) * (p.BuyQuantity - p.PayQuantity)
+		return unit.Mul(int64(free))
+	default:
+		return total.Scale(p.PercentOff / 100)
+	}
+}
@@ -0,0 +1,111 @@
+// Package ratelimit limits how often clients may call the API, with token
+// buckets, and how many LLM tokens they may spend a day.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets idle this long are full again and can be forgotten.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps a token bucket per key: each request takes a token, and
+// tokens come back at rate per second up to burst.
+type Limiter struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+	allowed uint64
+	limited uint64
+	mutex   sync.Mutex
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{rate: rate, burst: float64(max(burst, 1)), buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket. When it is empty it reports how
+// long until the next token.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		l.limited++
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	l.allowed++
+	return true, 0
+}
+
+// sweep forgets the buckets that have refilled; callers hold the mutex.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+type LimiterMetrics struct {
+	Rate    string `json:"rate"`
+	Burst   int    `json:"burst"`
+	Allowed uint64 `json:"allowed"`
+	Limited uint64 `json:"limited"`
+	Keys    int    `json:"keys"` // Clients with a bucket that is not full
+}
+
+func (l *Limiter) Metrics() LimiterMetrics {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return LimiterMetrics{
+		Rate:    fmt.Sprintf("%g/s", l.rate),
+		Burst:   int(l.burst),
+		Allowed: l.allowed,
+		Limited: l.limited,
+		Keys:    len(l.buckets),
+	}
+}
+
+// ParseRate reads a rate such as "20/m", "5/s" or "1000/h" as requests per
+// second.
+func ParseRate(value string) (float64, error) {
+	count, unit, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return 0, fmt.Errorf("rate %q must look like 20/m", value)
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("rate %q must have a positive count", value)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[unit]
+	if !ok {
+		return 0, fmt.Errorf("rate %q must be per s, m or h", value)
+	}
+	return n / period.Seconds(), nil
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterRefill(t *testing.T) {
+	limiter := NewLimiter(1, 2) // One token a second, two at most
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after time.Duration
+		key   string
+		ok    bool
+		wait  time.Duration
+	}{
+		{0, "a", true, 0},
+		{0, "a", true, 0},
+		{0, "a", false, time.Second},
+		{0, "b", true, 0}, // Keys have their own buckets
+		{250 * time.Millisecond, "a", false, 750 * time.Millisecond},
+		{time.Second, "a", true, 0},
+		{time.Second, "a", false, time.Second},
+		{10 * time.Second, "a", true, 0}, // Refilled only up to the burst
+		{10 * time.Second, "a", true, 0},
+		{10 * time.Second, "a", false, time.Second},
+	}
+	for i, step := range steps {
+		ok, wait := limiter.Allow(step.key, start.Add(step.after))
+		if ok != step.ok || wait.Round(time.Millisecond) != step.wait {
+			t.Errorf("step %d: Allow = %v, %v; want %v, %v", i, ok, wait, step.ok, step.wait)
+		}
+	}
+
+	metrics := limiter.Metrics()
+	if metrics.Allowed != 6 || metrics.Limited != 4 {
+		t.Errorf("metrics = %+v, want 6 allowed and 4 limited", metrics)
+	}
+}
+
+func TestLimiterSweepsFullBuckets(t *testing.T) {
+	limiter := NewLimiter(1, 1)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.Allow("a", start)
+	limiter.Allow("b", start)
+	if keys := limiter.Metrics().Keys; keys != 2 {
+		t.Fatalf("keys = %d, want 2", keys)
+	}
+	limiter.Allow("c", start.Add(sweepInterval))
+	if keys := limiter.Metrics().Keys; keys != 1 {
+		t.Errorf("keys = %d after the sweep, want 1", keys)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"5/s", 5, true},
+		{"30/m", 0.5, true},
+		{" 3600/h ", 1, true},
+		{"1.5/s", 1.5, true},
+		{"30", 0, false},
+		{"0/m", 0, false},
+		{"-1/m", 0, false},
+		{"x/m", 0, false},
+		{"30/d", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseRate(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
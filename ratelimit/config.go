@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultRate  = "30/m"
+	defaultBurst = 10
+)
+
+// LimiterFromEnv reads CELESTE_RATE_LIMIT (default 30/m, "off" disables)
+// and CELESTE_RATE_BURST (default 10). It returns nil when disabled.
+func LimiterFromEnv() *Limiter {
+	value := os.Getenv("CELESTE_RATE_LIMIT")
+	if value == "off" {
+		return nil
+	}
+	if value == "" {
+		value = defaultRate
+	}
+	rate, err := ParseRate(value)
+	if err != nil {
+		log.Printf("Invalid CELESTE_RATE_LIMIT: %v, using %s", err, defaultRate)
+		rate, _ = ParseRate(defaultRate)
+	}
+
+	burst := defaultBurst
+	if value := os.Getenv("CELESTE_RATE_BURST"); value != "" {
+		if burst, err = strconv.Atoi(value); err != nil || burst <= 0 {
+			log.Printf("Invalid CELESTE_RATE_BURST %q, using %d", value, defaultBurst)
+			burst = defaultBurst
+		}
+	}
+	return NewLimiter(rate, burst)
+}
+
+// QuotaFromEnv reads CELESTE_LLM_DAILY_TOKENS, the LLM tokens each client
+// may spend a day. Without it tokens are counted but not limited.
+func QuotaFromEnv() *DailyQuota {
+	value := os.Getenv("CELESTE_LLM_DAILY_TOKENS")
+	if value == "" {
+		return NewDailyQuota(0)
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		log.Printf("Invalid CELESTE_LLM_DAILY_TOKENS %q, not limiting", value)
+		limit = 0
+	}
+	return NewDailyQuota(limit)
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type dailyUsage struct {
+	day    string
+	tokens int
+}
+
+// DailyQuota counts the LLM tokens each key spends per UTC day. With a
+// limit above zero, keys that have spent it are refused until midnight.
+// Requests already running when the limit is reached still finish, so a
+// key can overshoot by one request's worth.
+type DailyQuota struct {
+	limit    int
+	usage    map[string]*dailyUsage
+	swept    string // The day usage was last cleared of earlier days
+	rejected uint64
+	mutex    sync.Mutex
+}
+
+func NewDailyQuota(limit int) *DailyQuota {
+	return &DailyQuota{limit: limit, usage: make(map[string]*dailyUsage)}
+}
+
+func (dq *DailyQuota) Enabled() bool {
+	return dq.limit > 0
+}
+
+// Check reports whether key may spend more tokens today, and if not how
+// long until the quota resets.
+func (dq *DailyQuota) Check(key string, now time.Time) (bool, time.Duration) {
+	if !dq.Enabled() {
+		return true, 0
+	}
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	if dq.used(key, now) < dq.limit {
+		return true, 0
+	}
+	dq.rejected++
+	midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return false, midnight.Sub(now)
+}
+
+// Add records tokens spent by key.
+func (dq *DailyQuota) Add(key string, tokens int, now time.Time) {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	day := now.UTC().Format(time.DateOnly)
+	dq.sweep(day)
+	usage := dq.usage[key]
+	if usage == nil || usage.day != day {
+		usage = &dailyUsage{day: day}
+		dq.usage[key] = usage
+	}
+	usage.tokens += tokens
+}
+
+// Used is how many tokens key has spent today.
+func (dq *DailyQuota) Used(key string, now time.Time) int {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+	return dq.used(key, now)
+}
+
+// used is Used for callers holding the mutex.
+func (dq *DailyQuota) used(key string, now time.Time) int {
+	usage := dq.usage[key]
+	if usage == nil || usage.day != now.UTC().Format(time.DateOnly) {
+		return 0
+	}
+	return usage.tokens
+}
+
+// sweep forgets usage from before day, once a day; callers hold the mutex.
+func (dq *DailyQuota) sweep(day string) {
+	if dq.swept == day {
+		return
+	}
+	for key, usage := range dq.usage {
+		if usage.day != day {
+			delete(dq.usage, key)
+		}
+	}
+	dq.swept = day
+}
+
+type QuotaMetrics struct {
+	DailyLimit  int    `json:"daily_limit"` // 0 when unlimited
+	TokensToday int    `json:"tokens_today"`
+	Keys        int    `json:"keys"` // Clients that spent tokens today
+	Rejected    uint64 `json:"rejected"`
+}
+
+func (dq *DailyQuota) Metrics(now time.Time) QuotaMetrics {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	dq.sweep(now.UTC().Format(time.DateOnly))
+	metrics := QuotaMetrics{DailyLimit: dq.limit, Rejected: dq.rejected}
+	for _, usage := range dq.usage {
+		metrics.TokensToday += usage.tokens
+		metrics.Keys++
+	}
+	return metrics
+}
+
+type chargeKey struct{}
+
+type charge struct {
+	quota *DailyQuota
+	key   string
+}
+
+// WithCharge makes LLM tokens spent under ctx count against key's quota.
+func WithCharge(ctx context.Context, quota *DailyQuota, key string) context.Context {
+	return context.WithValue(ctx, chargeKey{}, charge{quota: quota, key: key})
+}
+
+// ChargeTokens records tokens against the quota ctx carries, if any.
+func ChargeTokens(ctx context.Context, tokens int) {
+	if c, ok := ctx.Value(chargeKey{}).(charge); ok && tokens > 0 {
+		c.quota.Add(c.key, tokens, time.Now())
+	}
+}
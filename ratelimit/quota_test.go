@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDailyQuotaRollsOverAtUTCMidnight(t *testing.T) {
+	quota := NewDailyQuota(100)
+	// 23:30 UTC, though it is already the next day in UTC+1
+	evening := time.Date(2025, 1, 2, 0, 30, 0, 0, time.FixedZone("UTC+1", 3600))
+
+	quota.Add("a", 100, evening)
+	ok, wait := quota.Check("a", evening)
+	if ok || wait != 30*time.Minute {
+		t.Errorf("Check = %v, %v; want false, 30m", ok, wait)
+	}
+	if ok, _ := quota.Check("b", evening); !ok {
+		t.Error("refused a key that has spent nothing")
+	}
+
+	midnight := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	if ok, _ := quota.Check("a", midnight); !ok {
+		t.Error("still refused after midnight UTC")
+	}
+	if used := quota.Used("a", midnight); used != 0 {
+		t.Errorf("used = %d after midnight, want 0", used)
+	}
+	if metrics := quota.Metrics(midnight); metrics.Rejected != 1 {
+		t.Errorf("rejected = %d, want 1", metrics.Rejected)
+	}
+}
+
+func TestDailyQuotaSweepsEarlierDays(t *testing.T) {
+	quota := NewDailyQuota(0)
+	day := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	quota.Add("a", 10, day)
+	quota.Add("b", 20, day)
+
+	next := day.Add(24 * time.Hour)
+	quota.Add("c", 5, next)
+	if keys := len(quota.usage); keys != 1 {
+		t.Errorf("kept %d keys after the day changed, want 1", keys)
+	}
+	if metrics := quota.Metrics(next); metrics.TokensToday != 5 || metrics.Keys != 1 {
+		t.Errorf("metrics = %+v, want 5 tokens from 1 key", metrics)
+	}
+	if metrics := quota.Metrics(next.Add(24 * time.Hour)); metrics.TokensToday != 0 || len(quota.usage) != 0 {
+		t.Errorf("metrics = %+v with %d keys kept, want none", metrics, len(quota.usage))
+	}
+}
+
+func TestChargeTokens(t *testing.T) {
+	quota := NewDailyQuota(0)
+	ChargeTokens(context.Background(), 10) // Nothing to charge
+	ctx := WithCharge(context.Background(), quota, "a")
+	ChargeTokens(ctx, 10)
+	ChargeTokens(ctx, 5)
+	if used := quota.Used("a", time.Now()); used != 15 {
+		t.Errorf("used = %d, want 15", used)
+	}
+}
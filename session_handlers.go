@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"celeste/agents"
+	"celeste/auth"
+	"celeste/models"
+)
+
+// Clients send the session ID back in either the cookie or the header;
+// browsers get the cookie and API clients can use the header.
+const (
+	sessionCookie = "celeste_session"
+	sessionHeader = "X-Session-ID"
+)
+
+type loginRequest struct {
+	UserID string `json:"user_id"`
+}
+
+func (s *CelesteService) registerSessionRoutes(router *mux.Router) {
+	router.HandleFunc("/session", s.handleGetSession).Methods("GET")
+	router.HandleFunc("/session/login", s.handleLogin).Methods("POST")
+	router.HandleFunc("/session/logout", s.handleLogout).Methods("POST")
+}
+
+// session resumes the request's session, starting a new one when it has
+// none or it has expired, and sends the ID back.
+func (s *CelesteService) session(w http.ResponseWriter, r *http.Request) models.Session {
+	session := s.requestSession(r)
+	writeSession(w, r, session)
+	return session
+}
+
+func (s *CelesteService) requestSession(r *http.Request) models.Session {
+	session, ok := s.existingSession(r)
+	if !ok {
+		session = s.orchestrator.StartSession()
+	}
+	return session
+}
+
+// existingSession resumes the request's session, if it has one that has
+// not expired.
+func (s *CelesteService) existingSession(r *http.Request) (models.Session, bool) {
+	sessionID := r.Header.Get(sessionHeader)
+	if sessionID == "" {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			sessionID = cookie.Value
+		}
+	}
+	return s.orchestrator.ResumeSession(sessionID)
+}
+
+func writeSession(w http.ResponseWriter, r *http.Request, session models.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set(sessionHeader, session.ID)
+}
+
+// chatUserID decides whose context a chat request uses: the authenticated
+// principal's, the session's user once logged in, or the session's own. A
+// user_id in the request must agree; naming a user without either needs
+// authentication.
+func (s *CelesteService) chatUserID(r *http.Request, session models.Session, requested string) (string, int, error) {
+	userID := session.UserID
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		userID = principal.UserID
+	}
+	switch {
+	case userID != "" && requested != "" && requested != userID:
+		return "", http.StatusForbidden, errors.New("user_id does not match the authenticated user")
+	case userID != "":
+		return userID, 0, nil
+	case requested == "":
+		return agents.SessionUserID(session), 0, nil
+	case !s.auth.Enabled():
+		return "", http.StatusForbidden, errors.New("authentication is disabled, so requests cannot act as a user")
+	}
+	return "", http.StatusUnauthorized, errors.New("authentication required to act as a user")
+}
+
+func (s *CelesteService) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.session(w, r))
+}
+
+func (s *CelesteService) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid login", http.StatusBadRequest)
+		return
+	}
+
+	// A session can only be linked to the user the request is
+	// authenticated as
+	principal, ok := auth.FromContext(r.Context())
+	switch {
+	case !s.auth.Enabled():
+		auth.Disabled(w)
+		return
+	case !ok:
+		auth.Unauthorized(w, "authentication required")
+		return
+	case req.UserID == "":
+		req.UserID = principal.UserID
+	case req.UserID != principal.UserID:
+		http.Error(w, "user_id does not match the authenticated user", http.StatusForbidden)
+		return
+	}
+
+	session, err := s.orchestrator.Login(r.Context(), s.requestSession(r).ID, req.UserID)
+	switch {
+	case errors.Is(err, agents.ErrInvalidUserID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, agents.ErrSessionNotFound):
+		http.Error(w, "Session expired", http.StatusConflict)
+	case err != nil:
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+	default:
+		writeSession(w, r, session)
+		writeJSON(w, http.StatusOK, session)
+	}
+}
+
+func (s *CelesteService) handleLogout(w http.ResponseWriter, r *http.Request) {
+	session, err := s.orchestrator.Logout(s.requestSession(r).ID)
+	if err != nil {
+		http.Error(w, "Session expired", http.StatusConflict)
+		return
+	}
+	writeSession(w, r, session)
+	writeJSON(w, http.StatusOK, session)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"celeste/agents"
+	"celeste/auth"
+)
+
+func TestChatUserID(t *testing.T) {
+	s := testService(map[string]auth.Principal{"alice": {UserID: "alice"}})
+	disabled := testService(nil)
+	anonymous := s.orchestrator.StartSession()
+	aliceSession, _ := s.orchestrator.ResumeSession(loggedInSession(t, s, "alice"))
+
+	tests := []struct {
+		name        string
+		service     *CelesteService
+		credentials string
+		session     string
+		requested   string
+		want        string
+		status      int
+	}{
+		{"anonymous", s, "", anonymous.ID, "", agents.SessionUserID(anonymous), 0},
+		{"anonymous naming a user", s, "", anonymous.ID, "alice", "", http.StatusUnauthorized},
+		{"principal", s, "alice", anonymous.ID, "", "alice", 0},
+		{"principal naming itself", s, "alice", anonymous.ID, "alice", "alice", 0},
+		{"principal naming another", s, "alice", anonymous.ID, "bob", "", http.StatusForbidden},
+		{"logged in", s, "", aliceSession.ID, "", "alice", 0},
+		{"logged in naming another", s, "", aliceSession.ID, "bob", "", http.StatusForbidden},
+		{"disabled naming a user", disabled, "", "", "alice", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := testRequest(tt.service, tt.credentials, "")
+			session, _ := tt.service.orchestrator.ResumeSession(tt.session)
+			if tt.session == "" {
+				session = tt.service.orchestrator.StartSession()
+			}
+			userID, status, err := tt.service.chatUserID(request, session, tt.requested)
+			if userID != tt.want || status != tt.status || (status != 0) != (err != nil) {
+				t.Errorf("chatUserID = %q, %d, %v; want %q, %d", userID, status, err, tt.want, tt.status)
+			}
+		})
+	}
+}
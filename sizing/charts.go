@@ -0,0 +1,213 @@
+// Package sizing converts sizes between sizing systems and picks a size
+// for a shopper from per-brand size charts.
+package sizing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"celeste/models"
+)
+
+// Sizing systems, the keys of SizeChartRow.Sizes.
+const (
+	SystemUS  = "us"
+	SystemUK  = "uk"
+	SystemEU  = "eu"
+	SystemInt = "int" // XS to XXL
+)
+
+// How a brand's sizes compare to the default chart for their categories.
+const (
+	FitTrueToSize = "true_to_size"
+	FitRunsSmall  = "runs_small"
+	FitRunsLarge  = "runs_large"
+)
+
+// Groups are the garment groups a fit profile holds a usual size for.
+var Groups = []string{"shoes", "tops", "bottoms", "dresses"}
+
+// DefaultPath is CELESTE_SIZE_CHARTS_PATH, or data/sizeCharts.json.
+func DefaultPath() string {
+	if path := os.Getenv("CELESTE_SIZE_CHARTS_PATH"); path != "" {
+		return path
+	}
+	return "data/sizeCharts.json"
+}
+
+// Charts finds the size chart for a product: its brand's chart for one of
+// its categories, else the default chart for that category.
+type Charts struct {
+	charts []models.SizeChart
+}
+
+func NewCharts(charts []models.SizeChart) *Charts {
+	return &Charts{charts: charts}
+}
+
+func LoadCharts(path string) (*Charts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Charts []models.SizeChart `json:"charts"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for i := range file.Charts {
+		normalize(&file.Charts[i])
+		if err := validate(file.Charts[i]); err != nil {
+			return nil, fmt.Errorf("chart %d (%s %s): %v", i+1, file.Charts[i].Brand, strings.Join(file.Charts[i].Categories, "/"), err)
+		}
+	}
+	return NewCharts(file.Charts), nil
+}
+
+func normalize(chart *models.SizeChart) {
+	chart.Brand = strings.TrimSpace(chart.Brand)
+	for i, category := range chart.Categories {
+		chart.Categories[i] = strings.ToLower(strings.TrimSpace(category))
+	}
+	for i, row := range chart.Rows {
+		sizes := make(map[string]string, len(row.Sizes))
+		for system, size := range row.Sizes {
+			system = strings.ToLower(system)
+			if system == SystemInt {
+				size = strings.ToUpper(size)
+			}
+			sizes[system] = size
+		}
+		chart.Rows[i].Sizes = sizes
+	}
+}
+
+func validate(chart models.SizeChart) error {
+	if len(chart.Categories) == 0 {
+		return fmt.Errorf("missing categories")
+	}
+	if !isGroup(chart.Group) {
+		return fmt.Errorf("group must be one of %s", strings.Join(Groups, ", "))
+	}
+	switch chart.Fit {
+	case "", FitTrueToSize, FitRunsSmall, FitRunsLarge:
+	default:
+		return fmt.Errorf("unknown fit %q", chart.Fit)
+	}
+	if len(chart.Rows) == 0 {
+		return fmt.Errorf("no rows")
+	}
+	for _, row := range chart.Rows {
+		if row.Label == "" {
+			return fmt.Errorf("row without a label")
+		}
+		for system := range row.Sizes {
+			switch system {
+			case SystemUS, SystemUK, SystemEU, SystemInt:
+			default:
+				return fmt.Errorf("size %s: unknown system %q", row.Label, system)
+			}
+		}
+		for measurement, bounds := range row.Measurements {
+			if bounds[0] <= 0 || bounds[1] < bounds[0] {
+				return fmt.Errorf("size %s: invalid %s range", row.Label, measurement)
+			}
+		}
+	}
+	return nil
+}
+
+func isGroup(group string) bool {
+	for _, g := range Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Charts) Len() int {
+	return len(c.charts)
+}
+
+// For returns the chart that sizes a product.
+func (c *Charts) For(product models.Product) (models.SizeChart, bool) {
+	for _, brand := range []string{product.Brand, ""} {
+		for _, chart := range c.charts {
+			if strings.EqualFold(chart.Brand, brand) && coversCategory(chart, product.Categories) {
+				return chart, true
+			}
+		}
+	}
+	return models.SizeChart{}, false
+}
+
+// Default returns the brand-neutral chart for a fit profile group.
+func (c *Charts) Default(group string) (models.SizeChart, bool) {
+	for _, chart := range c.charts {
+		if chart.Brand == "" && chart.Group == group {
+			return chart, true
+		}
+	}
+	return models.SizeChart{}, false
+}
+
+func coversCategory(chart models.SizeChart, categories []string) bool {
+	for _, category := range categories {
+		for _, c := range chart.Categories {
+			if strings.EqualFold(category, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Convert gives a size in another system: UK 8 in the shoe chart is EU 42.
+func Convert(chart models.SizeChart, system, size, to string) (string, bool) {
+	i, ok := findRow(chart, system, size)
+	if !ok {
+		return "", false
+	}
+	converted, ok := chart.Rows[i].Sizes[to]
+	return converted, ok
+}
+
+// findRow finds the row for a size in a system, or for a label when system
+// is empty. A numeric size between two rows, such as a half size, rounds up.
+func findRow(chart models.SizeChart, system, size string) (int, bool) {
+	for i, row := range chart.Rows {
+		value := row.Label
+		if system != "" {
+			value = row.Sizes[system]
+		}
+		if strings.EqualFold(value, size) {
+			return i, true
+		}
+	}
+
+	wanted, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0, false
+	}
+	best, bestValue := -1, 0.0
+	for i, row := range chart.Rows {
+		value := row.Label
+		if system != "" {
+			value = row.Sizes[system]
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < wanted || v-wanted >= 1 {
+			continue
+		}
+		if best < 0 || v < bestValue {
+			best, bestValue = i, v
+		}
+	}
+	return best, best >= 0
+}
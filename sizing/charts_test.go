@@ -0,0 +1,38 @@
+package sizing
+
+import (
+	"testing"
+
+	"celeste/models"
+)
+
+func TestFindRow(t *testing.T) {
+	chart := models.SizeChart{Rows: []models.SizeChartRow{
+		{Label: "7", Sizes: map[string]string{SystemUS: "7", SystemUK: "6", SystemEU: "40"}},
+		{Label: "8", Sizes: map[string]string{SystemUS: "8", SystemUK: "7", SystemEU: "41"}},
+		{Label: "9", Sizes: map[string]string{SystemUS: "9", SystemUK: "8", SystemEU: "42"}},
+	}}
+
+	tests := []struct {
+		system, size string
+		want         int
+		found        bool
+	}{
+		{SystemUS, "8", 1, true},
+		{SystemUS, "7.5", 1, true}, // half sizes round up
+		{SystemUK, "6.5", 1, true},
+		{SystemEU, "40.5", 1, true},
+		{SystemUS, "8.9", 2, true},
+		{SystemUS, "6.5", 0, true},
+		{SystemUS, "5", 0, false}, // more than a size below the smallest row
+		{SystemUS, "9.5", 0, false},
+		{SystemUS, "M", 0, false},
+		{"", "9", 2, true},
+	}
+	for _, tt := range tests {
+		row, found := findRow(chart, tt.system, tt.size)
+		if found != tt.found || (found && row != tt.want) {
+			t.Errorf("findRow(%s %s) = %d, %v; want %d, %v", tt.system, tt.size, row, found, tt.want, tt.found)
+		}
+	}
+}
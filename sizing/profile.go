@@ -0,0 +1,192 @@
+package sizing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"celeste/models"
+)
+
+// Fit preferences.
+const (
+	PreferFitted  = "fitted"
+	PreferRegular = "regular"
+	PreferRelaxed = "relaxed"
+)
+
+// FitKey is the preference key holding the shopper's fit preference.
+const FitKey = "fit"
+
+// Measurements are the body measurements a profile can hold, in cm. Each
+// is also its preference key.
+var Measurements = []string{"foot_cm", "chest_cm", "bust_cm", "waist_cm", "hips_cm"}
+
+var measurementNames = map[string]string{
+	"foot_cm":  "foot length",
+	"chest_cm": "chest",
+	"bust_cm":  "bust",
+	"waist_cm": "waist",
+	"hips_cm":  "hips",
+}
+
+// SizeKey is the preference key holding the usual size for a group.
+func SizeKey(group string) string {
+	return "size_" + group
+}
+
+// Profile is a shopper's fit profile. It is kept in UserContext.Preferences
+// so it travels with the rest of their preferences.
+type Profile struct {
+	Sizes        map[string]string  // Usual size by group, e.g. "shoes": "UK 8"
+	Measurements map[string]float64 // Body measurements in cm
+	Fit          string             // fitted, regular or relaxed
+}
+
+func ProfileFromPreferences(preferences map[string]string) Profile {
+	profile := Profile{
+		Sizes:        make(map[string]string),
+		Measurements: make(map[string]float64),
+		Fit:          preferences[FitKey],
+	}
+	for _, group := range Groups {
+		if size := preferences[SizeKey(group)]; size != "" {
+			profile.Sizes[group] = size
+		}
+	}
+	for _, measurement := range Measurements {
+		if value, err := strconv.ParseFloat(preferences[measurement], 64); err == nil && value > 0 {
+			profile.Measurements[measurement] = value
+		}
+	}
+	return profile
+}
+
+func (p Profile) Empty() bool {
+	return len(p.Sizes) == 0 && len(p.Measurements) == 0
+}
+
+// ParseSize splits a size such as "UK 8", "M" or "9" into its system and
+// value. Letter sizes are in the int system; a bare number has no system
+// and matches chart labels.
+func ParseSize(text string) (system, size string) {
+	fields := strings.Fields(strings.ToLower(text))
+	switch {
+	case len(fields) == 2 && (fields[0] == SystemUS || fields[0] == SystemUK || fields[0] == SystemEU):
+		return fields[0], fields[1]
+	case len(fields) == 1 && isLetterSize(fields[0]):
+		return SystemInt, strings.ToUpper(fields[0])
+	}
+	return "", strings.TrimSpace(text)
+}
+
+// FormatSize is the inverse of ParseSize.
+func FormatSize(system, size string) string {
+	if system == "" || system == SystemInt {
+		return size
+	}
+	return strings.ToUpper(system) + " " + size
+}
+
+func isLetterSize(size string) bool {
+	switch strings.ToUpper(size) {
+	case "XXS", "XS", "S", "M", "L", "XL", "XXL":
+		return true
+	}
+	return false
+}
+
+// Choice is the size picked from a chart and why.
+type Choice struct {
+	Row   models.SizeChartRow
+	Basis string
+	Note  string
+}
+
+// Recommend picks a size from a chart. Body measurements win over a usual
+// size, since brand charts already account for how the brand is cut; a
+// usual size is moved up or down for brands that run small or large.
+func Recommend(chart models.SizeChart, profile Profile) (Choice, bool) {
+	if value, ok := profile.Measurements[chart.Measure]; ok {
+		return byMeasurement(chart, value, profile.Fit), true
+	}
+
+	size := profile.Sizes[chart.Group]
+	if size == "" {
+		// "I usually wear a medium" holds for any letter-sized chart
+		for _, group := range Groups {
+			if system, _ := ParseSize(profile.Sizes[group]); system == SystemInt {
+				size = profile.Sizes[group]
+				break
+			}
+		}
+	}
+	if size == "" {
+		return Choice{}, false
+	}
+	system, value := ParseSize(size)
+	i, ok := findRow(chart, system, value)
+	if !ok {
+		return Choice{}, false
+	}
+
+	choice := Choice{Basis: "your usual " + FormatSize(system, value)}
+	switch chart.Fit {
+	case FitRunsSmall:
+		if next := step(chart, i, 1); next != i {
+			i, choice.Note = next, "Runs small, so we've gone a size up."
+		} else {
+			choice.Note = "Runs small."
+		}
+	case FitRunsLarge:
+		if next := step(chart, i, -1); next != i {
+			i, choice.Note = next, "Runs large, so we've gone a size down."
+		} else {
+			choice.Note = "Runs large."
+		}
+	}
+	choice.Row = chart.Rows[i]
+	return choice, true
+}
+
+// byMeasurement takes the first size whose range reaches the measurement.
+// Between the middle and the top of a range, a relaxed fit goes a size up;
+// between the bottom and the middle, a fitted one goes a size down.
+func byMeasurement(chart models.SizeChart, value float64, fit string) Choice {
+	i := len(chart.Rows) - 1
+	for j, row := range chart.Rows {
+		if bounds, ok := row.Measurements[chart.Measure]; ok && value <= bounds[1] {
+			i = j
+			break
+		}
+	}
+
+	choice := Choice{Basis: fmt.Sprintf("your %s of %s cm", measurementNames[chart.Measure], strconv.FormatFloat(value, 'f', -1, 64))}
+	bounds := chart.Rows[i].Measurements[chart.Measure]
+	middle := (bounds[0] + bounds[1]) / 2
+	switch {
+	case value > bounds[1]:
+		choice.Note = "You're above our largest size's measurements, so check the chart."
+	case fit == PreferRelaxed && value > middle:
+		if next := step(chart, i, 1); next != i {
+			i, choice.Note = next, "Sized up for the relaxed fit you like."
+		}
+	case fit == PreferFitted && value < middle && value >= bounds[0]:
+		if next := step(chart, i, -1); next != i {
+			i, choice.Note = next, "Sized down for the fitted look you like."
+		}
+	}
+	choice.Row = chart.Rows[i]
+	return choice
+}
+
+// step moves to the nearest row with a different label in the given
+// direction, staying put at either end of the chart.
+func step(chart models.SizeChart, i, direction int) int {
+	for j := i + direction; j >= 0 && j < len(chart.Rows); j += direction {
+		if chart.Rows[j].Label != chart.Rows[i].Label {
+			return j
+		}
+	}
+	return i
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"celeste/agents"
+	"celeste/auth"
+	"celeste/catalog"
+	"celeste/models"
+)
+
+type priceAlertRequest struct {
+	ProductID string `json:"product_id"`
+	// A Money object, or a price such as "49.99", "$49.99" or "45 EUR".
+	// Without a currency the product's own is assumed.
+	Threshold  json.RawMessage `json:"threshold"`
+	WebhookURL string          `json:"webhook_url,omitempty"`
+}
+
+type interactionRequest struct {
+	ProductID string `json:"product_id"`
+	Type      string `json:"type"` // view, cart_add or purchase
+}
+
+type preferencesBody struct {
+	// Stated preferences such as currency, style, brands, colors, budget
+	// and the fit profile
+	Preferences map[string]string `json:"preferences"`
+	// Learned from searches and interactions; leave out to keep as is
+	Learned *models.PreferenceProfile `json:"learned,omitempty"`
+}
+
+func (s *CelesteService) registerUserRoutes(router *mux.Router) {
+	router.HandleFunc("/users/{id}/alerts", s.requireUser(s.handleListAlerts)).Methods("GET")
+	router.HandleFunc("/users/{id}/alerts", s.requireUser(s.handleCreateAlert)).Methods("POST")
+	router.HandleFunc("/users/{id}/alerts/{alertID}", s.requireUser(s.handleDeleteAlert)).Methods("DELETE")
+	router.HandleFunc("/users/{id}/notifications", s.requireUser(s.handleListNotifications)).Methods("GET")
+	router.HandleFunc("/users/{id}/interactions", s.requireUser(s.handleRecordInteraction)).Methods("POST")
+	router.HandleFunc("/users/{id}/preferences", s.requireUser(s.handleGetPreferences)).Methods("GET")
+	router.HandleFunc("/users/{id}/preferences", s.requireUser(s.handlePutPreferences)).Methods("PUT")
+	router.HandleFunc("/users/{id}/conversation", s.requireUser(s.handleGetConversation)).Methods("GET")
+}
+
+// requireUser only lets a user's own requests through, by authentication
+// or a session logged in as them, and principals with ScopeUsers. With
+// authentication disabled nobody can prove who they are, so none do.
+func (s *CelesteService) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["id"]
+		principal, authenticated := auth.FromContext(r.Context())
+		session, _ := s.existingSession(r)
+		switch {
+		case !s.auth.Enabled():
+			auth.Disabled(w)
+		case authenticated && (principal.UserID == userID || principal.HasScope(auth.ScopeUsers)):
+			next(w, r)
+		case !authenticated && session.UserID == userID && userID != "":
+			next(w, r)
+		case !authenticated && session.UserID == "":
+			auth.Unauthorized(w, "authentication required")
+		default:
+			http.Error(w, "not allowed to access another user", http.StatusForbidden)
+		}
+	}
+}
+
+func (s *CelesteService) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := s.orchestrator.PriceAlerts(mux.Vars(r)["id"])
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+func (s *CelesteService) handleCreateAlert(w http.ResponseWriter, r *http.Request) {
+	var req priceAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid price alert", http.StatusBadRequest)
+		return
+	}
+
+	product, ok := s.orchestrator.Catalog().Product(req.ProductID)
+	if !ok {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	threshold, err := parseThreshold(req.Threshold, product.PriceUsd.CurrencyCode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	alert, err := s.orchestrator.CreatePriceAlert(mux.Vars(r)["id"], product.ID, threshold, req.WebhookURL)
+	switch {
+	case errors.Is(err, agents.ErrInvalidAlert):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, catalog.ErrNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	case err != nil:
+		log.Printf("Failed to create price alert: %v", err)
+		http.Error(w, "Failed to create price alert", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusCreated, alert)
+	}
+}
+
+func (s *CelesteService) handleDeleteAlert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	err := s.orchestrator.DeletePriceAlert(vars["id"], vars["alertID"])
+	switch {
+	case errors.Is(err, agents.ErrAlertNotFound):
+		http.Error(w, "Price alert not found", http.StatusNotFound)
+	case err != nil:
+		log.Printf("Failed to delete price alert: %v", err)
+		http.Error(w, "Failed to delete price alert", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *CelesteService) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	notifications := s.orchestrator.Notifications(mux.Vars(r)["id"])
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"notifications": notifications,
+		"count":         len(notifications),
+	})
+}
+
+func parseThreshold(raw json.RawMessage, defaultCurrency string) (models.Money, error) {
+	text := strings.TrimSpace(string(raw))
+	if strings.HasPrefix(text, "{") {
+		var money models.Money
+		if err := json.Unmarshal(raw, &money); err != nil {
+			return money, errors.New("invalid threshold")
+		}
+		if money.CurrencyCode == "" {
+			money.CurrencyCode = defaultCurrency
+		}
+		return money, nil
+	}
+
+	var price string
+	if err := json.Unmarshal(raw, &price); err != nil {
+		// A bare JSON number
+		price = text
+	}
+	if price == "" {
+		return models.Money{}, errors.New("threshold is required")
+	}
+	return catalog.ParsePrice(price, defaultCurrency)
+}
+
+func (s *CelesteService) handleRecordInteraction(w http.ResponseWriter, r *http.Request) {
+	var req interactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid interaction", http.StatusBadRequest)
+		return
+	}
+
+	interaction, err := s.orchestrator.RecordInteraction(mux.Vars(r)["id"], req.ProductID, req.Type)
+	switch {
+	case errors.Is(err, agents.ErrInvalidInteraction):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, catalog.ErrNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	case err != nil:
+		log.Printf("Failed to record interaction: %v", err)
+		http.Error(w, "Failed to record interaction", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusCreated, interaction)
+	}
+}
+
+func (s *CelesteService) handleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	preferences, learned := s.orchestrator.UserPreferences(mux.Vars(r)["id"])
+	writeJSON(w, http.StatusOK, preferencesBody{Preferences: preferences, Learned: &learned})
+}
+
+func (s *CelesteService) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.orchestrator.Conversation(mux.Vars(r)["id"]))
+}
+
+func (s *CelesteService) handlePutPreferences(w http.ResponseWriter, r *http.Request) {
+	var req preferencesBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid preferences", http.StatusBadRequest)
+		return
+	}
+	if req.Preferences == nil {
+		req.Preferences = make(map[string]string)
+	}
+
+	userID := mux.Vars(r)["id"]
+	if err := s.orchestrator.SetUserPreferences(userID, req.Preferences, req.Learned); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.handleGetPreferences(w, r)
+}
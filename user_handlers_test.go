@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"celeste/agents"
+	"celeste/auth"
+)
+
+// testService is a service whose only authenticator accepts any bearer
+// token as the principal it names, or one without authentication when
+// principals is nil.
+func testService(principals map[string]auth.Principal) *CelesteService {
+	var authenticators []auth.Authenticator
+	if principals != nil {
+		authenticators = append(authenticators, testAuthenticator(principals))
+	}
+	return &CelesteService{
+		orchestrator: agents.NewAgentOrchestrator(nil),
+		auth:         auth.NewMiddleware(authenticators...),
+	}
+}
+
+type testAuthenticator map[string]auth.Principal
+
+func (ta testAuthenticator) Authenticate(r *http.Request) (auth.Principal, error) {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		return auth.Principal{}, auth.ErrNoCredentials
+	}
+	principal, ok := ta[token]
+	if !ok {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	return principal, nil
+}
+
+// testRequest is a request with the given credentials and session, as the
+// auth middleware would pass it on.
+func testRequest(s *CelesteService, credentials, sessionID string) *http.Request {
+	request := httptest.NewRequest("GET", "/", nil)
+	if credentials != "" {
+		request.Header.Set("Authorization", credentials)
+	}
+	if sessionID != "" {
+		request.Header.Set(sessionHeader, sessionID)
+	}
+	s.auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+	})).ServeHTTP(httptest.NewRecorder(), request)
+	return request
+}
+
+func loggedInSession(t *testing.T, s *CelesteService, userID string) string {
+	t.Helper()
+	session, err := s.orchestrator.Login(context.Background(), s.orchestrator.StartSession().ID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session.ID
+}
+
+func TestRequireUser(t *testing.T) {
+	s := testService(map[string]auth.Principal{
+		"alice": {UserID: "alice"},
+		"ops":   {UserID: "ops", Scopes: []string{auth.ScopeUsers}},
+		"other": {UserID: "ops", Scopes: []string{auth.ScopeCatalog}},
+	})
+	aliceSession := loggedInSession(t, s, "alice")
+	anonymousSession := s.orchestrator.StartSession().ID
+
+	tests := []struct {
+		name        string
+		credentials string
+		session     string
+		user        string
+		want        int
+	}{
+		{"nobody", "", "", "alice", http.StatusUnauthorized},
+		{"anonymous session", "", anonymousSession, "alice", http.StatusUnauthorized},
+		{"own user", "alice", "", "alice", http.StatusOK},
+		{"another user", "alice", "", "bob", http.StatusForbidden},
+		{"users admin", "ops", "", "bob", http.StatusOK},
+		{"other admin", "other", "", "bob", http.StatusForbidden},
+		{"own session", "", aliceSession, "alice", http.StatusOK},
+		{"another user's session", "", aliceSession, "bob", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := mux.SetURLVars(testRequest(s, tt.credentials, tt.session), map[string]string{"id": tt.user})
+			recorder := httptest.NewRecorder()
+			s.requireUser(func(w http.ResponseWriter, r *http.Request) {})(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireUserDisabled(t *testing.T) {
+	s := testService(nil)
+	request := mux.SetURLVars(testRequest(s, "", ""), map[string]string{"id": "alice"})
+	recorder := httptest.NewRecorder()
+	s.requireUser(func(w http.ResponseWriter, r *http.Request) {})(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+}